@@ -2,13 +2,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/xitonix/xvault/obfuscate"
 	"github.com/xitonix/xvault/taps"
@@ -16,6 +17,9 @@ import (
 )
 
 func main() {
+	decrypt := flag.Bool("decrypt", false, "decrypts the encoded files of the source directory")
+	encryptNames := flag.Bool("encrypt-names", false, "encrypts (or decrypts) the names of the files and directories")
+	flag.Parse()
 
 	fmt.Print("Enter your password: ")
 	password, err := terminal.ReadPassword(int(syscall.Stdin))
@@ -30,13 +34,35 @@ func main() {
 
 	fmt.Println("\nStarting the service...")
 
-	tap, err := taps.NewDirectoryWatcherTap("src", "target", 100*time.Millisecond, master, true, true, true)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	newTap := taps.NewDirectoryWatcherTapWithOptions
+	if *decrypt {
+		newTap = taps.NewDecryptingDirectoryWatcherTap
+	}
+	tap, err := newTap("src", "target", master,
+		taps.WithErrorNotification(true),
+		taps.WithProgressReport(true),
+		taps.WithDeleteCompleted(true),
+		taps.WithNameEncryption(*encryptNames),
+		taps.WithLogger(logger.With(obfuscate.LogKeyTap, obfuscate.DefaultTapName)))
+
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	journal, err := obfuscate.OpenFileJournal("xvault.journal")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer journal.Close()
 
-	engine := obfuscate.NewEngine(10, tap)
+	engine, err := obfuscate.NewEngineWithOptions(tap,
+		obfuscate.WithQueueSize(10),
+		obfuscate.WithJournal(journal),
+		obfuscate.WithLogger(logger))
+	if err != nil {
+		log.Fatal(err)
+	}
 	wg := &sync.WaitGroup{}
 
 	wg.Add(1)
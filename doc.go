@@ -11,7 +11,6 @@
 //		"os/signal"
 //		"sync"
 //		"syscall"
-//		"time"
 //
 //		"github.com/xitonix/xvault/obfuscate"
 //		"github.com/xitonix/xvault/taps"
@@ -23,13 +22,19 @@
 //			log.Fatal(err)
 //		}
 //
-//		tap, err := taps.NewDirectoryWatcherTap("src", "target", 100*time.Millisecond, master, true, true, true)
+//		tap, err := taps.NewDirectoryWatcherTapWithOptions("src", "target", master,
+//			taps.WithErrorNotification(true),
+//			taps.WithProgressReport(true),
+//			taps.WithDeleteCompleted(true))
 //
 //		if err != nil {
 //			log.Fatal(err)
 //		}
 //
-//		engine := obfuscate.NewEngine(10, tap)
+//		engine, err := obfuscate.NewEngineWithOptions(tap, obfuscate.WithQueueSize(10))
+//		if err != nil {
+//			log.Fatal(err)
+//		}
 //		wg := &sync.WaitGroup{}
 //
 //		wg.Add(1)
@@ -2,8 +2,10 @@
 package hash
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
+	gohash "hash"
 )
 
 // SHA256 returns a 32 bytes SHA256 hash of the input
@@ -35,3 +37,18 @@ func SHA512(in []byte) ([]byte, error) {
 	}
 	return h.Sum(nil), nil
 }
+
+// HMAC256 returns a 32 bytes keyed HMAC-SHA256 hash of the input
+func HMAC256(key, in []byte) ([]byte, error) {
+	h := NewHMAC256(key)
+	_, err := h.Write(in)
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// NewHMAC256 returns a keyed HMAC-SHA256 hash to calculate the hash of a stream
+func NewHMAC256(key []byte) gohash.Hash {
+	return hmac.New(sha256.New, key)
+}
@@ -18,6 +18,9 @@ const (
 	defaultBufferSize = 1024
 	signatureLength   = 28
 	keyLength         = 32
+	headerLength      = prefixLength + signatureLength + aes.BlockSize
+	// legacyHeaderLength the header length of the un-versioned streams of the earlier releases
+	legacyHeaderLength = signatureLength + aes.BlockSize
 )
 
 var (
@@ -53,38 +56,44 @@ func getRandomIV() []byte {
 	return iv
 }
 
-func processData(input io.Reader, output io.Writer, bufferSize int, stream cipher.Stream, cancelled *bool) (Status, error) {
+// offsets represents the positions of the input and the output streams
+type offsets struct {
+	input, output int64
+}
+
+func processData(ctx context.Context, input io.Reader, output io.Writer, bufferSize int, stream cipher.Stream, limit limiter, offset offsets) (Status, error) {
 	buffer := make([]byte, bufferSize)
 	for {
-		if *cancelled {
-			break
+		if ctx.Err() != nil {
+			return Cancelled, nil
 		}
 		count, err := input.Read(buffer)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return Failed, err
+			if ctx.Err() != nil {
+				// The blocked read has been interrupted by the cancellation
+				return Cancelled, nil
+			}
+			if _, ok := err.(*IOError); ok {
+				// The input has already reported the position of the failure
+				return Failed, err
+			}
+			return Failed, readError(offset.input, err)
 		}
 		if count > 0 {
+			offset.input += int64(count)
+			if limit != nil && limit.waitBytes(ctx, count) != nil {
+				return Cancelled, nil
+			}
 			stream.XORKeyStream(buffer[:count], buffer[:count])
-			_, err := output.Write(buffer[:count])
+			written, err := output.Write(buffer[:count])
 			if err != nil && err != io.EOF {
-				return Failed, err
+				return Failed, writeError(offset.output+int64(written), err)
 			}
+			offset.output += int64(written)
 		}
 	}
 	return Completed, nil
 }
-
-func monitorCancellation(ctx context.Context) *bool {
-	var cancelled bool
-	go func() {
-		select {
-		case <-ctx.Done():
-			cancelled = true
-			return
-		}
-	}()
-	return &cancelled
-}
@@ -0,0 +1,131 @@
+package obfuscate
+
+import "time"
+
+// Duration is a time.Duration which can be loaded from its text representation (i.e. "1m30s").
+type Duration time.Duration
+
+// MarshalText returns the text representation of the duration
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses the text representation of the duration
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return invalidConfig("%s", err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// OffPeakWindow is the loadable representation of a TimeWindow
+type OffPeakWindow struct {
+	// From the start of the window since midnight (i.e. "22h")
+	From Duration `json:"from"`
+	// To the end of the window since midnight (i.e. "6h")
+	To Duration `json:"to"`
+}
+
+// Config is the configuration of an Engine which can be loaded from a file (i.e. using encoding/json).
+// The zero values mean the default settings.
+//
+// The runtime dependencies of the engine such as the journal, the logger, the metrics or the taps are not part of
+// the config and need to be passed to NewEngineWithOptions as extra options:
+//
+//	opts := append(config.Options(), obfuscate.WithLogger(logger))
+//	engine, err := obfuscate.NewEngineWithOptions(tap, opts...)
+type Config struct {
+	// QueueSize the capacity of the engine's work queue (See WithQueueSize)
+	QueueSize int `json:"queue_size"`
+	// TaskBufferSize the size of the buffer used to read the input of the tasks (See WithTaskBufferSize)
+	TaskBufferSize int `json:"task_buffer_size"`
+	// Cipher is reserved for the future versions of the format (See WithTaskCipher)
+	Cipher Cipher `json:"cipher"`
+	// Compression is reserved for the future versions of the format (See WithTaskCompression)
+	Compression Compression `json:"compression"`
+	// Workers the initial number of the workers (See WithWorkers)
+	Workers int `json:"workers"`
+	// MinWorkers the lower boundary of autoscaling. Autoscaling is enabled if MaxWorkers is set.
+	MinWorkers int `json:"min_workers"`
+	// MaxWorkers the upper boundary of autoscaling
+	MaxWorkers int `json:"max_workers"`
+	// ScalingInterval the interval of autoscaling (Default: 1s)
+	ScalingInterval Duration `json:"scaling_interval"`
+	// Aging the interval after which a waiting work unit gets promoted by one priority level (See WithScheduling)
+	Aging Duration `json:"aging"`
+	// Lanes the size based lanes of the work queue (See WithScheduling)
+	Lanes []Lane `json:"lanes"`
+	// Limit the global processing rate limit (See WithLimit)
+	Limit Limit `json:"limit"`
+	// TapLimits the processing rate limits of the taps by name (See WithTapLimit)
+	TapLimits map[string]Limit `json:"tap_limits"`
+	// OffPeak the daily time windows during which the limits do not apply (See WithOffPeak)
+	OffPeak []OffPeakWindow `json:"off_peak"`
+	// Timeout the maximum processing time of the work units (See WithTimeout)
+	Timeout Duration `json:"timeout"`
+}
+
+// Options returns the engine options of the config
+func (c Config) Options() []EngineOption {
+	var opts []EngineOption
+	if c.QueueSize != 0 {
+		opts = append(opts, WithQueueSize(c.QueueSize))
+	}
+	if c.TaskBufferSize != 0 {
+		opts = append(opts, WithTaskBufferSize(c.TaskBufferSize))
+	}
+	if c.Cipher != "" {
+		opts = append(opts, WithTaskCipher(c.Cipher))
+	}
+	if c.Compression != "" {
+		opts = append(opts, WithTaskCompression(c.Compression))
+	}
+	if c.Workers != 0 {
+		opts = append(opts, WithWorkers(c.Workers))
+	}
+	if c.MinWorkers != 0 || c.MaxWorkers != 0 {
+		interval := time.Duration(c.ScalingInterval)
+		if interval == 0 {
+			interval = time.Second
+		}
+		min := c.MinWorkers
+		if min == 0 {
+			min = 1
+		}
+		opts = append(opts, WithAutoscaling(min, c.MaxWorkers, interval))
+	}
+	if c.Aging != 0 || len(c.Lanes) > 0 {
+		opts = append(opts, WithScheduling(time.Duration(c.Aging), c.Lanes...))
+	}
+	if c.Limit != (Limit{}) {
+		opts = append(opts, WithLimit(c.Limit))
+	}
+	for name, limit := range c.TapLimits {
+		opts = append(opts, WithTapLimit(name, limit))
+	}
+	if len(c.OffPeak) > 0 {
+		windows := make([]TimeWindow, len(c.OffPeak))
+		for i, w := range c.OffPeak {
+			windows[i] = TimeWindow{From: time.Duration(w.From), To: time.Duration(w.To)}
+		}
+		opts = append(opts, WithOffPeak(windows...))
+	}
+	if c.Timeout != 0 {
+		opts = append(opts, WithTimeout(time.Duration(c.Timeout)))
+	}
+	return opts
+}
+
+// Validate checks the config without creating an engine.
+// An error of type obfuscate.ErrInvalidConfig will be returned if the config is not valid.
+func (c Config) Validate() error {
+	o := &engineOptions{}
+	for _, opt := range c.Options() {
+		if err := opt(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
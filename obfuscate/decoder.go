@@ -5,7 +5,10 @@ import (
 	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 )
 
 // Decoder is the type that decrypts an io Reader into one or more io Writers using the specified master key
@@ -14,10 +17,30 @@ type Decoder struct {
 	output     io.Writer
 	bufferSize int
 	master     *MasterKey
+	limit      limiter
 }
 
-// NewDecoder creates a new Decoder object
+// NewDecoderWithOptions creates a new Decoder object which decrypts the input into the output.
+//
+// The decoder can be configured using the CodecOption functions (i.e. WithBufferSize).
+// An error of type obfuscate.ErrInvalidConfig will be returned if the configuration is not valid.
+// The output can be nil if the decoder is only used to verify the input (See Verify).
+func NewDecoderWithOptions(master *MasterKey, input io.Reader, output io.Writer, opts ...CodecOption) (*Decoder, error) {
+	o, err := newCodecOptions(input, output, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(master, input, o.bufferSize, o.outputs...), nil
+}
+
+// NewDecoder creates a new Decoder object which decrypts the input into the outputs.
+//
+// Deprecated: Use NewDecoderWithOptions instead.
 func NewDecoder(bufferSize int, master *MasterKey, input io.Reader, outputs ...io.Writer) *Decoder {
+	return newDecoder(master, input, bufferSize, outputs...)
+}
+
+func newDecoder(master *MasterKey, input io.Reader, bufferSize int, outputs ...io.Writer) *Decoder {
 	if bufferSize <= 0 {
 		bufferSize = defaultBufferSize
 	}
@@ -44,19 +67,48 @@ func (d *Decoder) Decode() (Status, error) {
 //
 // It will return an error if the key is invalid or the decryption process fails.
 // The content of the input stream must be encoded using the same master key.
+//
+// The plaintext is written to the Writer(s) as it gets decrypted, while the authentication tag at the end
+// of the stream can only be checked once the stream has been read in full. If the stream has been modified,
+// ErrCorrupted will be returned, and the plaintext which has already been written must be discarded.
 func (d *Decoder) DecodeContext(ctx context.Context) (Status, error) {
+	return d.decode(ctx, d.output)
+}
+
+// Verify decrypts the encoded content of the Reader to check its integrity without writing the plaintext
+// to the Writer(s). The returned error can be classified using the CheckHealth function.
+//
+// The verification proves that the content has been encoded using the same master key, and that
+// it has not been modified or truncated since, by checking the authentication tag at the end of the stream.
+// The un-versioned streams of the earlier releases carry no authentication tag, so only the key can be verified.
+func (d *Decoder) Verify() (Status, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	return d.VerifyContext(ctx)
+}
+
+// VerifyContext verifies the encoded content of the Reader and receives cancellation signal on the context parameter.
+// See Verify for details.
+func (d *Decoder) VerifyContext(ctx context.Context) (Status, error) {
+	return d.decode(ctx, ioutil.Discard)
+}
+
+func (d *Decoder) decode(ctx context.Context, output io.Writer) (Status, error) {
 	if !d.master.isValid() {
-		return Failed, errInvalidKey
+		return Failed, ErrInvalidKey
 	}
 
-	cancelled := monitorCancellation(ctx)
+	mac, err := newStreamMac(d.master)
+	if err != nil {
+		return Failed, err
+	}
 
-	iv, err := d.readMetadata()
+	iv, legacy, err := d.readMetadata(mac)
 	if err != nil {
 		return Failed, err
 	}
 
-	if *cancelled {
+	if ctx.Err() != nil {
 		return Cancelled, nil
 	}
 
@@ -66,19 +118,63 @@ func (d *Decoder) DecodeContext(ctx context.Context) (Status, error) {
 	}
 
 	stream := cipher.NewCFBDecrypter(block, iv)
+	if legacy {
+		return processData(ctx, d.input, output, d.bufferSize, stream, d.limit, offsets{input: legacyHeaderLength})
+	}
 
-	return processData(d.input, d.output, d.bufferSize, stream, cancelled)
+	input := newAuthReader(d.input, mac)
+	status, err := processData(ctx, input, output, d.bufferSize, stream, d.limit, offsets{input: headerLength})
+	if status != Completed {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The input (i.e. a compressed or a length prefixed stream) has ended in the middle of the payload
+			err = fmt.Errorf("%w: %w", ErrCorrupted, err)
+		}
+		return status, err
+	}
+	if err := input.verify(); err != nil {
+		return Failed, err
+	}
+	return Completed, nil
 }
 
-func (d *Decoder) readMetadata() ([]byte, error) {
-	meta := make([]byte, signatureLength+aes.BlockSize)
-	_, err := d.input.Read(meta)
+// readMetadata reads the header of the stream and feeds it into the MAC.
+//
+// The streams which do not start with the format magic have been produced by the earlier releases,
+// with the signature and the IV at the beginning of the stream and no authentication tag at the end.
+// The returned flag will be true if the header belongs to such a legacy stream.
+func (d *Decoder) readMetadata(mac io.Writer) ([]byte, bool, error) {
+	meta := make([]byte, headerLength)
+	n, err := io.ReadFull(d.input, meta[:prefixLength])
+	legacy := false
+	if err == nil {
+		if string(meta[:len(formatMagic)]) != formatMagic {
+			// The prefix which has already been read is the beginning of the legacy signature
+			legacy = true
+			meta = meta[:legacyHeaderLength]
+		} else if meta[len(formatMagic)] != formatVersion {
+			return nil, false, ErrUnsupportedVersion
+		}
+		var m int
+		m, err = io.ReadFull(d.input, meta[prefixLength:])
+		n += m
+	}
 	if err != nil {
-		return nil, err
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, false, ErrTruncated
+		}
+		return nil, false, readError(int64(n), err)
 	}
-	if !bytes.Equal(d.master.signature, meta[:signatureLength]) {
-		return nil, errInvalidSignature
+
+	if legacy {
+		if !bytes.Equal(d.master.signature, meta[:signatureLength]) {
+			return nil, false, ErrWrongKey
+		}
+		return meta[signatureLength:], true, nil
 	}
 
-	return meta[signatureLength:], nil
+	if !bytes.Equal(d.master.signature, meta[prefixLength:prefixLength+signatureLength]) {
+		return nil, false, ErrWrongKey
+	}
+	mac.Write(meta)
+	return meta[prefixLength+signatureLength:], false, nil
 }
@@ -24,7 +24,11 @@ func ExampleDecoder_decode() {
 		log.Fatal(err)
 	}
 
-	decoder := NewDecoder(1024, master, input, output)
+	decoder, err := NewDecoderWithOptions(master, input, output, WithBufferSize(1024))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	_, err = decoder.Decode()
 
 	if err != nil {
@@ -49,7 +53,11 @@ func ExampleDecoder_decodeContext() {
 		log.Fatal(err)
 	}
 
-	decoder := NewDecoder(1024, master, input, output)
+	decoder, err := NewDecoderWithOptions(master, input, output, WithBufferSize(1024))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Queued the time consuming process of decoding a big file
@@ -1,6 +1,9 @@
 package obfuscate
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mattetti/filebuffer"
@@ -72,7 +75,7 @@ func TestDecode(t *testing.T) {
 			if !assert.Errors(t, tc.expectKeyGenerationError, err, assert.Fields{"password": tc.password}) {
 				return
 			}
-			encoder := NewEncoder(tc.bufferSize, key, in, out)
+			encoder := newTestEncoder(t, key, in, out, WithBufferSize(tc.bufferSize))
 			status, err := encoder.Encode()
 			if err != nil {
 				t.Errorf("failed to encode: %v", err)
@@ -143,7 +146,7 @@ func TestDecodeMultipleEncodedOutputs(t *testing.T) {
 			if !assert.Errors(t, false, err, assert.Fields{"password": tc.password}) {
 				return
 			}
-			encoder := NewEncoder(tc.bufferSize, key, in, out1, out2)
+			encoder := newTestEncoder(t, key, in, out1, WithBufferSize(tc.bufferSize), WithOutputs(out2))
 			status, err := encoder.Encode()
 			if err != nil {
 				t.Errorf("failed to encode: %v", err)
@@ -214,7 +217,7 @@ func TestDecodeMultipleDecodedOutputs(t *testing.T) {
 			if !assert.Errors(t, false, err, assert.Fields{"password": tc.password}) {
 				return
 			}
-			encoder := NewEncoder(tc.bufferSize, key, in, out)
+			encoder := newTestEncoder(t, key, in, out, WithBufferSize(tc.bufferSize))
 			status, err := encoder.Encode()
 			if err != nil {
 				t.Errorf("failed to encode: %v", err)
@@ -229,7 +232,7 @@ func TestDecodeMultipleDecodedOutputs(t *testing.T) {
 			out1 := filebuffer.New(nil)
 			out2 := filebuffer.New(nil)
 
-			decoder := NewDecoder(defaultBufferSize, key, in, out1, out2)
+			decoder := newTestDecoder(t, key, in, out1, WithOutputs(out2))
 			status, err = decoder.Decode()
 			if err != nil {
 				t.Errorf("failed to decode: %v", err)
@@ -288,7 +291,7 @@ func TestDecodeInvalidKey(t *testing.T) {
 		t.Run(tc.title, func(t *testing.T) {
 			in := filebuffer.New([]byte("input"))
 			out := filebuffer.New(nil)
-			decoder := NewDecoder(defaultBufferSize, tc.master, in, out)
+			decoder := newTestDecoder(t, tc.master, in, out)
 			status, err := decoder.Decode()
 			assert.Errors(t, true, err, nil)
 			if status != Failed {
@@ -298,12 +301,95 @@ func TestDecodeInvalidKey(t *testing.T) {
 	}
 }
 
+func TestVerify(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	another, _ := KeyFromPassword("another password")
+
+	encoded := filebuffer.New(nil)
+	if _, err := newTestEncoder(t, master, filebuffer.New([]byte("Go")), encoded).Encode(); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	content := encoded.Buff.Bytes()
+	modified := append([]byte{}, content...)
+	modified[headerLength] ^= 1
+	unknown := append([]byte{}, content...)
+	unknown[prefixLength-1]++
+
+	testCases := []struct {
+		title          string
+		input          []byte
+		master         *MasterKey
+		expectedStatus Status
+		expectedHealth Health
+	}{
+		{
+			title:          "healthy_stream",
+			input:          content,
+			master:         master,
+			expectedStatus: Completed,
+			expectedHealth: Healthy,
+		},
+		{
+			title:          "stream_encoded_with_another_key",
+			input:          content,
+			master:         another,
+			expectedStatus: Failed,
+			expectedHealth: WrongKey,
+		},
+		{
+			title:          "empty_stream",
+			input:          []byte{},
+			master:         master,
+			expectedStatus: Failed,
+			expectedHealth: Truncated,
+		},
+		{
+			title:          "stream_with_partial_header",
+			input:          content[:signatureLength+2],
+			master:         master,
+			expectedStatus: Failed,
+			expectedHealth: Truncated,
+		},
+		{
+			title:          "modified_stream",
+			input:          modified,
+			master:         master,
+			expectedStatus: Failed,
+			expectedHealth: Corrupted,
+		},
+		{
+			title:          "unknown_version",
+			input:          unknown,
+			master:         master,
+			expectedStatus: Failed,
+			expectedHealth: Unsupported,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			out := filebuffer.New(nil)
+			decoder := newTestDecoder(t, tc.master, filebuffer.New(tc.input), out)
+			status, err := decoder.Verify()
+			if status != tc.expectedStatus {
+				t.Errorf("expected verification status to be '%s', actual '%s'", tc.expectedStatus, status)
+			}
+			if health := CheckHealth(status, err); health != tc.expectedHealth {
+				t.Errorf("expected health to be '%s', actual '%s'", tc.expectedHealth, health)
+			}
+			if out.Buff.Len() != 0 {
+				t.Errorf("expected no plaintext to be written, but received '%s'", out.Buff.String())
+			}
+		})
+	}
+}
+
 func decodedAndAssert(t *testing.T, encoded []byte, master *MasterKey, expected string) {
 	t.Helper()
 	in := filebuffer.New(encoded)
 	out := filebuffer.New(nil)
 
-	decoder := NewDecoder(defaultBufferSize, master, in, out)
+	decoder := newTestDecoder(t, master, in, out)
 	status, err := decoder.Decode()
 	if err != nil {
 		t.Errorf("failed to decode: %v", err)
@@ -319,3 +405,71 @@ func decodedAndAssert(t *testing.T, encoded []byte, master *MasterKey, expected
 		t.Errorf("expected %s, received %s", expected, actual)
 	}
 }
+
+func TestDecodeLegacyStream(t *testing.T) {
+	// legacy.xv has been encoded by an earlier release, before the format got versioned
+	encoded, err := os.ReadFile(filepath.Join("testdata", "legacy.xv"))
+	if err != nil {
+		t.Fatalf("failed to read the legacy stream: %v", err)
+	}
+	master, _ := KeyFromPassword("legacy password")
+	another, _ := KeyFromPassword("another password")
+
+	testCases := []struct {
+		title          string
+		input          []byte
+		master         *MasterKey
+		expectedOutput string
+		expectedStatus Status
+		expectedError  error
+	}{
+		{
+			title:          "legacy_stream",
+			input:          encoded,
+			master:         master,
+			expectedOutput: "content encoded by the un-versioned format",
+			expectedStatus: Completed,
+		},
+		{
+			title:          "legacy_stream_encoded_with_another_key",
+			input:          encoded,
+			master:         another,
+			expectedStatus: Failed,
+			expectedError:  ErrWrongKey,
+		},
+		{
+			title:          "legacy_stream_with_partial_header",
+			input:          encoded[:legacyHeaderLength-1],
+			master:         master,
+			expectedStatus: Failed,
+			expectedError:  ErrTruncated,
+		},
+		{
+			title:          "legacy_stream_with_no_payload",
+			input:          encoded[:legacyHeaderLength],
+			master:         master,
+			expectedStatus: Completed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			out := filebuffer.New(nil)
+			status, err := newTestDecoder(t, tc.master, filebuffer.New(tc.input), out).Decode()
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if status != tc.expectedStatus {
+				t.Errorf("expected decoding status to be '%s', actual '%s'", tc.expectedStatus, status)
+			}
+			if actual := out.Buff.String(); actual != tc.expectedOutput {
+				t.Errorf("expected '%s' as the decoded content, actual '%s'", tc.expectedOutput, actual)
+			}
+
+			status, err = newTestDecoder(t, tc.master, filebuffer.New(tc.input), nil).Verify()
+			if !errors.Is(err, tc.expectedError) || status != tc.expectedStatus {
+				t.Errorf("expected the verification to return '%s' and '%v', actual '%s' and '%v'", tc.expectedStatus, tc.expectedError, status, err)
+			}
+		})
+	}
+}
@@ -5,7 +5,7 @@
 //
 // Every engine is connected to a pipe of work units from which it receives the requests.
 // In order to flow the work units into the associated pipe, you need to implement a Tap and
-// connect it to the engine by passing it to obfuscate.NewEngine(...) method.
+// connect it to the engine by passing it to obfuscate.NewEngineWithOptions(...) method.
 //
 //	tap, err := taps.YourImplementationOfTap(...)
 //
@@ -13,7 +13,13 @@
 //		log.Fatal(err)
 //	}
 //
-//	engine := obfuscate.NewEngine(bufferSize, tap)
+//	engine, err := obfuscate.NewEngineWithOptions(tap, obfuscate.WithQueueSize(queueSize))
+//
+// The engine can also be configured using a Config which can be loaded from a file:
+//	engine, err := obfuscate.NewEngineWithOptions(tap, config.Options()...)
+//
+// More taps can be attached to the same engine, before or after it gets started:
+//	err = engine.Attach("another", anotherTap)
 //
 // Once you initialised the engine, you need to start it:
 //	engine.Start()
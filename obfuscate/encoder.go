@@ -14,10 +14,32 @@ type Encoder struct {
 	output     io.Writer
 	bufferSize int
 	master     *MasterKey
+	limit      limiter
 }
 
-// NewEncoder creates a new Encoder object
+// NewEncoderWithOptions creates a new Encoder object which encrypts the input into the output.
+//
+// The encoder can be configured using the CodecOption functions (i.e. WithBufferSize).
+// An error of type obfuscate.ErrInvalidConfig will be returned if the configuration is not valid.
+func NewEncoderWithOptions(master *MasterKey, input io.Reader, output io.Writer, opts ...CodecOption) (*Encoder, error) {
+	if output == nil {
+		return nil, invalidConfig("the output cannot be nil")
+	}
+	o, err := newCodecOptions(input, output, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoder(master, input, o.bufferSize, o.outputs...), nil
+}
+
+// NewEncoder creates a new Encoder object which encrypts the input into the outputs.
+//
+// Deprecated: Use NewEncoderWithOptions instead.
 func NewEncoder(bufferSize int, master *MasterKey, input io.Reader, outputs ...io.Writer) *Encoder {
+	return newEncoder(master, input, bufferSize, outputs...)
+}
+
+func newEncoder(master *MasterKey, input io.Reader, bufferSize int, outputs ...io.Writer) *Encoder {
 	if bufferSize <= 0 {
 		bufferSize = defaultBufferSize
 	}
@@ -41,20 +63,26 @@ func (e *Encoder) Encode() (Status, error) {
 
 // EncodeContext encrypts the Reader into the specified Writer outputs and receives cancellation signal on the context parameter.
 //
+// The encoded stream is terminated by an authentication tag, so the streams which have not been
+// completed (i.e. cancelled or failed) cannot be decoded.
+//
 // This methods will return an error if the key is invalid or the encryption process fails.
 func (e *Encoder) EncodeContext(ctx context.Context) (Status, error) {
 	if !e.master.isValid() {
-		return Failed, errInvalidKey
+		return Failed, ErrInvalidKey
 	}
 
-	cancelled := monitorCancellation(ctx)
+	mac, err := newStreamMac(e.master)
+	if err != nil {
+		return Failed, err
+	}
 
-	iv, err := e.writeMetadata()
+	iv, err := e.writeMetadata(mac)
 	if err != nil {
 		return Failed, err
 	}
 
-	if *cancelled {
+	if ctx.Err() != nil {
 		return Cancelled, nil
 	}
 
@@ -63,19 +91,30 @@ func (e *Encoder) EncodeContext(ctx context.Context) (Status, error) {
 		return Failed, err
 	}
 	stream := cipher.NewCFBEncrypter(block, iv)
-	return processData(e.input, e.output, e.bufferSize, stream, cancelled)
+	output := &authWriter{output: e.output, mac: mac}
+	status, err := processData(ctx, e.input, output, e.bufferSize, stream, e.limit, offsets{output: headerLength})
+	if status != Completed {
+		return status, err
+	}
+	if err := output.seal(); err != nil {
+		return Failed, err
+	}
+	return Completed, nil
 }
 
-func (e *Encoder) writeMetadata() ([]byte, error) {
+// writeMetadata writes the header of the stream and feeds it into the MAC
+func (e *Encoder) writeMetadata(mac io.Writer) ([]byte, error) {
 	iv := getRandomIV()
-	_, err := e.output.Write(e.master.signature)
-	if err != nil {
-		return nil, err
-	}
+	header := make([]byte, 0, headerLength)
+	header = append(header, formatMagic...)
+	header = append(header, formatVersion)
+	header = append(header, e.master.signature...)
+	header = append(header, iv...)
 
-	_, err = e.output.Write(iv)
+	n, err := e.output.Write(header)
 	if err != nil {
-		return nil, err
+		return nil, writeError(int64(n), err)
 	}
+	mac.Write(header)
 	return iv, nil
 }
@@ -24,7 +24,11 @@ func ExampleEncoder_encode() {
 		log.Fatal(err)
 	}
 
-	encoder := NewEncoder(1024, master, input, output)
+	encoder, err := NewEncoderWithOptions(master, input, output, WithBufferSize(1024))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	_, err = encoder.Encode()
 
 	if err != nil {
@@ -49,7 +53,11 @@ func ExampleEncoder_encodeContext() {
 		log.Fatal(err)
 	}
 
-	encoder := NewEncoder(1024, master, input, output)
+	encoder, err := NewEncoderWithOptions(master, input, output, WithBufferSize(1024))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	//Queued the time consuming process of encoding a big file
 	_, err = encoder.EncodeContext(ctx)
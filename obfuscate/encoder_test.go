@@ -1,6 +1,7 @@
 package obfuscate
 
 import (
+	"io"
 	"testing"
 
 	"github.com/mattetti/filebuffer"
@@ -11,6 +12,9 @@ func TestEncode(t *testing.T) {
 	const (
 		ivLength        = 16
 		signatureLength = 28
+		// the versioned format adds the magic and the version before the signature,
+		// and the authentication tag after the payload
+		formatOverhead = prefixLength + tagLength
 	)
 	testCases := []struct {
 		title                    string
@@ -23,7 +27,7 @@ func TestEncode(t *testing.T) {
 	}{
 		{
 			title:              "empty_input",
-			expectedLength:     ivLength + signatureLength,
+			expectedLength:     ivLength + signatureLength + formatOverhead,
 			input:              "",
 			bufferSize:         100,
 			expectedBufferSize: 100,
@@ -31,7 +35,7 @@ func TestEncode(t *testing.T) {
 		},
 		{
 			title:              "whitespace_input",
-			expectedLength:     ivLength + signatureLength + 1,
+			expectedLength:     ivLength + signatureLength + formatOverhead + 1,
 			input:              " ",
 			bufferSize:         100,
 			expectedBufferSize: 100,
@@ -39,7 +43,7 @@ func TestEncode(t *testing.T) {
 		},
 		{
 			title:              "non_empty_input",
-			expectedLength:     ivLength + signatureLength + 2,
+			expectedLength:     ivLength + signatureLength + formatOverhead + 2,
 			input:              "Go",
 			bufferSize:         100,
 			expectedBufferSize: 100,
@@ -47,7 +51,7 @@ func TestEncode(t *testing.T) {
 		},
 		{
 			title:              "invalid_buffer_size_should_get_fixed_automatically",
-			expectedLength:     ivLength + signatureLength + 2,
+			expectedLength:     ivLength + signatureLength + formatOverhead + 2,
 			input:              "Go",
 			bufferSize:         0,
 			expectedBufferSize: defaultBufferSize,
@@ -73,7 +77,7 @@ func TestEncode(t *testing.T) {
 			if !assert.Errors(t, tc.expectKeyGenerationError, err, assert.Fields{"password": tc.password}) {
 				return
 			}
-			encoder := NewEncoder(tc.bufferSize, key, in, out)
+			encoder := newTestEncoder(t, key, in, out, WithBufferSize(tc.bufferSize))
 			status, err := encoder.Encode()
 			if err != nil {
 				t.Errorf("failed to encode: %v", err)
@@ -99,6 +103,9 @@ func TestEncodeMultipleOutputs(t *testing.T) {
 	const (
 		ivLength        = 16
 		signatureLength = 28
+		// the versioned format adds the magic and the version before the signature,
+		// and the authentication tag after the payload
+		formatOverhead = prefixLength + tagLength
 	)
 	testCases := []struct {
 		title              string
@@ -110,7 +117,7 @@ func TestEncodeMultipleOutputs(t *testing.T) {
 	}{
 		{
 			title:              "empty_input",
-			expectedLength:     ivLength + signatureLength,
+			expectedLength:     ivLength + signatureLength + formatOverhead,
 			input:              "",
 			bufferSize:         100,
 			expectedBufferSize: 100,
@@ -118,7 +125,7 @@ func TestEncodeMultipleOutputs(t *testing.T) {
 		},
 		{
 			title:              "whitespace_input",
-			expectedLength:     ivLength + signatureLength + 1,
+			expectedLength:     ivLength + signatureLength + formatOverhead + 1,
 			input:              " ",
 			bufferSize:         100,
 			expectedBufferSize: 100,
@@ -126,7 +133,7 @@ func TestEncodeMultipleOutputs(t *testing.T) {
 		},
 		{
 			title:              "non_empty_input",
-			expectedLength:     ivLength + signatureLength + 2,
+			expectedLength:     ivLength + signatureLength + formatOverhead + 2,
 			input:              "Go",
 			bufferSize:         100,
 			expectedBufferSize: 100,
@@ -143,7 +150,7 @@ func TestEncodeMultipleOutputs(t *testing.T) {
 			if !assert.Errors(t, false, err, assert.Fields{"password": tc.password}) {
 				return
 			}
-			encoder := NewEncoder(tc.bufferSize, key, in, out1, out2)
+			encoder := newTestEncoder(t, key, in, out1, WithBufferSize(tc.bufferSize), WithOutputs(out2))
 			status, err := encoder.Encode()
 			if err != nil {
 				t.Errorf("failed to encode: %v", err)
@@ -204,7 +211,7 @@ func TestEncodeInvalidKey(t *testing.T) {
 		t.Run(tc.title, func(t *testing.T) {
 			in := filebuffer.New([]byte("input"))
 			out := filebuffer.New(nil)
-			encoder := NewEncoder(defaultBufferSize, tc.master, in, out)
+			encoder := newTestEncoder(t, tc.master, in, out)
 			status, err := encoder.Encode()
 			assert.Errors(t, true, err, nil)
 			if status != Failed {
@@ -213,3 +220,37 @@ func TestEncodeInvalidKey(t *testing.T) {
 		})
 	}
 }
+
+func TestDeprecatedCodecs(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	encoded := filebuffer.New(nil)
+	if _, err := NewEncoder(0, master, filebuffer.New([]byte("input")), encoded).Encode(); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	encoded.Seek(0, io.SeekStart)
+	decoded := filebuffer.New(nil)
+	if _, err := NewDecoder(0, master, encoded, decoded).Decode(); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if actual := decoded.Buff.String(); actual != "input" {
+		t.Errorf("expected 'input' as the decoded content, actual '%s'", actual)
+	}
+}
+
+func newTestEncoder(t *testing.T, master *MasterKey, input io.Reader, output io.Writer, opts ...CodecOption) *Encoder {
+	t.Helper()
+	encoder, err := NewEncoderWithOptions(master, input, output, opts...)
+	if err != nil {
+		t.Fatalf("failed to create the encoder: %v", err)
+	}
+	return encoder
+}
+
+func newTestDecoder(t *testing.T, master *MasterKey, input io.Reader, output io.Writer, opts ...CodecOption) *Decoder {
+	t.Helper()
+	decoder, err := NewDecoderWithOptions(master, input, output, opts...)
+	if err != nil {
+		t.Fatalf("failed to create the decoder: %v", err)
+	}
+	return decoder
+}
@@ -2,7 +2,9 @@ package obfuscate
 
 import (
 	"context"
+	"log/slog"
 	"sync"
+	"time"
 )
 
 // Engine is the type that processes an stream of encrypt/decrypt work units.
@@ -12,12 +14,35 @@ import (
 // to the function.
 //
 // In order to feed the engine with work units, you need to connect
-// your implementation of the Tap interface to it
+// your implementation of the Tap interface to it. Any number of taps can be
+// attached to (or detached from) the same engine at runtime (See Attach).
+//
+// The work units are kept in memory by default. Attaching a Journal to the engine
+// makes the work list crash-safe (See SetJournal).
 type Engine struct {
-	stream     *stream
-	wg         sync.WaitGroup
-	cancel     context.CancelFunc
-	bufferSize uint16
+	stream    *stream
+	wg        sync.WaitGroup
+	cancel    context.CancelFunc
+	queueSize uint16
+	journal   Journal
+	pool      *workerPool
+	throttle  *throttle
+	events    *eventBus
+	logger    *slog.Logger
+	tracer    Tracer
+	metrics   Metrics
+
+	interceptors []Interceptor
+
+	// the size of the buffer used to read the input of the tasks
+	taskBufferSize int
+	// the default processing timeout of the work units
+	timeout time.Duration
+	// the cancel functions of the in-progress work units
+	running  map[string]context.CancelFunc
+	unitsMux sync.Mutex
+	// autoscaling interval
+	interval time.Duration
 
 	startOnce sync.Once
 	stopOnce  sync.Once
@@ -28,18 +53,378 @@ type Engine struct {
 	isRunning bool
 }
 
-// NewEngine creates a new instance of the Engine type.
+// NewEngineWithOptions creates a new instance of the Engine type.
+//
+// The engine can be configured using the EngineOption functions (i.e. WithQueueSize) or a Config.
+// By default, the engine has a work queue of DefaultQueueSize capacity and runs the same number of workers.
+// An error of type obfuscate.ErrInvalidConfig will be returned if the configuration is not valid.
+//
+// The input tap (if not nil) will be attached to the engine under the DefaultTapName name.
+func NewEngineWithOptions(tap Tap, opts ...EngineOption) (*Engine, error) {
+	o := &engineOptions{
+		queueSize: DefaultQueueSize,
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	queueSize := uint16(o.queueSize)
+	s := newStream(queueSize, tap)
+	e := &Engine{
+		stream:         s,
+		queueSize:      queueSize,
+		taskBufferSize: o.bufferSize,
+		pool:           newWorkerPool(o.queueSize),
+		throttle:       newThrottle(),
+		events:         s.events,
+		logger:         discardLogger,
+		tracer:         noopTracer{},
+		metrics:        noopMetrics{},
+		running:        make(map[string]context.CancelFunc),
+	}
+	if err := e.configure(o); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NewEngine creates a new instance of the Engine type with a work queue of bufferSize capacity.
+// Zero means DefaultQueueSize.
+//
+// Deprecated: Use NewEngineWithOptions instead.
 func NewEngine(bufferSize uint16, tap Tap) *Engine {
-	return &Engine{
-		stream:     newStream(bufferSize, tap),
-		bufferSize: bufferSize,
+	var opts []EngineOption
+	if bufferSize > 0 {
+		opts = append(opts, WithQueueSize(int(bufferSize)))
+	}
+	// The queue size is always valid here
+	e, _ := NewEngineWithOptions(tap, opts...)
+	return e
+}
+
+// configure applies the options to a new engine
+func (e *Engine) configure(o *engineOptions) error {
+	if o.maxWorkers > 0 {
+		if err := e.SetAutoscaling(o.minWorkers, o.maxWorkers, o.interval); err != nil {
+			return err
+		}
+	}
+	if o.workers > 0 {
+		e.SetWorkers(o.workers)
+	}
+	if o.journal != nil {
+		if err := e.SetJournal(o.journal); err != nil {
+			return err
+		}
+	}
+	if o.aging != 0 || len(o.lanes) > 0 {
+		if err := e.SetScheduling(o.aging, o.lanes...); err != nil {
+			return err
+		}
+	}
+	if o.limit != nil {
+		e.SetLimit(*o.limit)
+	}
+	for name, limit := range o.tapLimits {
+		e.SetTapLimit(name, limit)
+	}
+	if len(o.offPeak) > 0 {
+		e.SetOffPeak(o.offPeak...)
+	}
+	e.SetTimeout(o.timeout)
+	if err := e.Use(o.interceptors...); err != nil {
+		return err
+	}
+	if err := e.SetLogger(o.logger); err != nil {
+		return err
+	}
+	if err := e.SetTracer(o.tracer); err != nil {
+		return err
+	}
+	if err := e.SetMetrics(o.metrics); err != nil {
+		return err
+	}
+	for _, t := range o.taps {
+		if err := e.Attach(t.name, t.tap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTracer sets the tracer which traces the work units through the engine. Nothing will be traced by default.
+//
+// The engine creates a span for the time every work unit spends in the queue (SpanQueue) and a span for processing
+// its task (i.e. xvault.encode) which includes the number of the processed bytes. The spans continue the trace
+// carried by the work unit's context (See WorkUnit.SetContext).
+// Calling this method on a running engine will return an error of type obfuscate.ErrOperationInProgress.
+func (e *Engine) SetTracer(tracer Tracer) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
+	}
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	e.tracer = tracer
+	e.stream.tracer = tracer
+	return nil
+}
+
+// SetMetrics sets the collector of the engine's measurements (See Metrics). Nothing will be measured by default.
+// Calling this method on a running engine will return an error of type obfuscate.ErrOperationInProgress.
+func (e *Engine) SetMetrics(metrics Metrics) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
 	}
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+	e.metrics = metrics
+	return nil
+}
+
+// SetLogger sets the structured logger of the engine. Nothing will be logged by default.
+//
+// The engine logs the outcome of every work unit with consistent attributes (See the LogKey* constants),
+// as well as the life cycle of the taps and the journal recovery.
+// Calling this method on a running engine will return an error of type obfuscate.ErrOperationInProgress.
+func (e *Engine) SetLogger(logger *slog.Logger) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
+	}
+	if logger == nil {
+		logger = discardLogger
+	}
+	e.logger = logger
+	e.stream.logger = logger
+	return nil
+}
+
+// SetJournal attaches a durable journal to the engine which records the life cycle of the work units.
+//
+// Once a tap gets opened by the engine, every pending work unit of the journal which had been dispatched by
+// a tap with the same name will get rebuilt by the tap and re-processed. The tap must implement the RecoverableTap
+// interface to rebuild the pending work units, otherwise they will be discarded from the journal.
+//
+// The journal must be attached before the engine gets started. Calling this method on a running
+// engine will return an error of type obfuscate.ErrOperationInProgress.
+// The engine does not close the journal when it stops.
+func (e *Engine) SetJournal(journal Journal) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
+	}
+	e.journal = journal
+	e.stream.journal = journal
+	return nil
+}
+
+// SetScheduling configures the order in which the work units will be served.
+//
+// The engine always serves the work units with higher Priority first. The units with the same
+// priority will be served in the order they have been received. To prevent the low priority units
+// from starving, a waiting unit gets promoted by one priority level every 'aging' interval.
+// Zero or negative aging disables the promotion.
+//
+// The work queue can optionally be split into size based lanes (See Lane). Each lane gets its own
+// share of the engine's workers, so that the small inputs don't get stuck behind the big ones.
+// The work units are assigned to the smallest lane which can take their Size.
+//
+// The scheduling must be configured before the engine gets started. Calling this method on a running
+// engine will return an error of type obfuscate.ErrOperationInProgress.
+func (e *Engine) SetScheduling(aging time.Duration, lanes ...Lane) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
+	}
+	e.stream.schedule(aging, lanes...)
+	return nil
+}
+
+// SetWorkers changes the number of the workers which process the work units concurrently.
+//
+// The number of the workers is independent of the queue capacity and can be changed while the engine is running.
+// Reducing the number of workers does not interrupt the in-progress tasks. The retiring workers quit once their current
+// task has been finished. If autoscaling has been enabled, the number will be adjusted to stay between its boundaries.
+// Every scheduling lane always gets at least one worker.
+func (e *Engine) SetWorkers(n int) {
+	e.pool.resize(n)
+}
+
+// Workers returns the current number of the engine's workers.
+func (e *Engine) Workers() int {
+	return e.pool.count()
+}
+
+// SetAutoscaling enables the engine to grow or shrink the number of its workers between min and max.
+//
+// The queue is checked every 'interval'. As long as there are work units waiting in the queue while all the workers
+// are busy, the engine adds more workers, until it reaches max, or adding more workers no longer increases
+// the throughput (which means that the CPU or the I/O has been saturated). The idle workers will
+// gradually be retired when the queue is empty.
+//
+// Calling this method on a running engine will return an error of type obfuscate.ErrOperationInProgress.
+func (e *Engine) SetAutoscaling(min, max int, interval time.Duration) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
+	}
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	e.interval = interval
+	e.pool.limit(min, max)
+	return nil
+}
+
+// SetLimit throttles the processing rate of the engine across all the taps.
+//
+// The bytes limit is applied while the input of a task is being read, so it also caps the
+// I/O of the engine. The tasks limit is applied before the engine starts processing each work unit.
+// The limits can be changed while the engine is running. A zero Limit removes the throttling.
+func (e *Engine) SetLimit(limit Limit) {
+	e.throttle.setGlobal(limit)
+}
+
+// SetTapLimit throttles the processing rate of the work units dispatched by the specified tap.
+//
+// The tap limits are applied in addition to the global limit of the engine (See SetLimit).
+// The limits can be changed while the engine is running, before or after the tap gets attached.
+func (e *Engine) SetTapLimit(name string, limit Limit) {
+	e.throttle.setTap(name, limit)
 }
 
-// Start starts processing the work unit stream provided by the input Tap.
+// SetOffPeak sets the daily windows of time during which the engine runs at full speed, regardless of the limits.
+// Calling this method without any windows removes the off-peak schedule.
+func (e *Engine) SetOffPeak(windows ...TimeWindow) {
+	e.throttle.setOffPeak(windows)
+}
+
+// SetTimeout sets the maximum processing time of the work units which don't have a Deadline.
+// Zero or negative timeout means no timeout. The new timeout only applies to the units which have not been started yet.
+func (e *Engine) SetTimeout(timeout time.Duration) {
+	e.unitsMux.Lock()
+	defer e.unitsMux.Unlock()
+	e.timeout = timeout
+}
+
+// Cancel cancels the queued or in-progress work unit with the specified ID, without affecting the rest of the units.
+//
+// A queued unit will be finished as Cancelled as soon as it's been picked by a worker. Cancelling an in-progress
+// unit interrupts its blocked reads if the input supports read deadlines (i.e. net.Conn) or can be closed.
+// Cancelling a work unit which is neither queued nor in progress will return an error of type obfuscate.ErrUnitNotFound.
+func (e *Engine) Cancel(id string) error {
+	e.unitsMux.Lock()
+	defer e.unitsMux.Unlock()
+
+	if cancel, ok := e.running[id]; ok {
+		cancel()
+		return nil
+	}
+
+	if wu, ok := e.stream.queue.find(id); ok {
+		wu.cancel()
+		return nil
+	}
+
+	return ErrUnitNotFound
+}
+
+// Use registers the interceptors which will be called around the processing of every work unit.
+//
+// The interceptors are called in the order they have been registered, the first one being the outermost.
+// They must be registered before the engine gets started. Calling this method on a running
+// engine will return an error of type obfuscate.ErrOperationInProgress.
+func (e *Engine) Use(interceptors ...Interceptor) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.isRunning {
+		return ErrOperationInProgress
+	}
+	e.interceptors = append(e.interceptors, interceptors...)
+	return nil
+}
+
+// Subscribe subscribes to the life cycle events of the work units processed by the engine.
+//
+// Every subscription receives its own copy of the events on a channel with the specified buffer size.
+// The policy decides what happens to the new events once the buffer is full. Any number of subscribers
+// can observe the same engine independently. Subscribing to a stopped engine returns a closed subscription.
+//
+// The subscription channels will be closed once the engine stops.
+func (e *Engine) Subscribe(buffer int, policy DeliveryPolicy) *Subscription {
+	return e.events.subscribe(buffer, policy)
+}
+
+// Unsubscribe cancels the subscription and closes its channel.
+func (e *Engine) Unsubscribe(s *Subscription) {
+	e.events.unsubscribe(s)
+}
+
+// Attach attaches a new tap to the engine.
+//
+// The work units of all the attached taps will be merged fairly into the engine's work queue.
+// If the engine is already running, the tap will get opened immediately. Otherwise it will be opened once the engine starts.
+// A tap which closes its pipe will be detached automatically without affecting the other taps.
+//
+// The name of the tap must be unique, otherwise an error of type obfuscate.ErrTapAlreadyAttached will be returned.
+// Attaching a tap to a stopped engine will return an error of type obfuscate.ErrEngineStopped.
+func (e *Engine) Attach(name string, tap Tap) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	err := e.stream.attach(name, tap)
+	if err != nil {
+		return err
+	}
+	e.logger.Info("tap attached", slog.String(LogKeyTap, name))
+
+	if e.isRunning {
+		e.stream.replay(e.recoverPending(name, tap))
+		e.stream.open()
+	}
+	return nil
+}
+
+// Detach closes the tap and detaches it from the engine.
+// The work units which have already been received from the tap will still be processed.
+//
+// Detaching a tap which is not attached to the engine will return an error of type obfuscate.ErrTapNotFound.
+func (e *Engine) Detach(name string) error {
+	err := e.stream.detach(name)
+	if err != nil {
+		return err
+	}
+	e.logger.Info("tap detached", slog.String(LogKeyTap, name))
+	return nil
+}
+
+// Taps returns the sorted names of the taps which are currently attached to the engine.
+func (e *Engine) Taps() []string {
+	return e.stream.names()
+}
+
+// Start starts processing the work unit stream provided by the attached taps.
 // Once you are finished with the Engine, you need to call the Stop function.
 //
-// Starting the engine automatically opens the input tap. You SHOULD NOT
+// Starting the engine automatically opens the taps. You SHOULD NOT
 // call the tap's Open function explicitly.
 //
 // NOTE: You can only call the Start method once.
@@ -52,17 +437,25 @@ func (e *Engine) Start() {
 		ctx, cancel := context.WithCancel(context.Background())
 		e.cancel = cancel
 
-		for i := 0; uint16(i) < e.bufferSize; i++ {
+		e.pool.start(ctx, &e.wg, e.stream.queue, e.monitorStream)
+		if e.interval > 0 {
 			e.wg.Add(1)
-			go e.monitorStream(ctx)
+			go func() {
+				defer e.wg.Done()
+				e.pool.autoscale(e.interval)
+			}()
+		}
+		for name, tap := range e.stream.taps() {
+			e.stream.replay(e.recoverPending(name, tap))
 		}
 		e.stream.open()
 		e.isRunning = true
+		e.logger.Info("engine started", slog.Int("workers", e.pool.count()))
 	})
 }
 
 // Stop stops the engine and releases the resources.
-// Stopping the engine will automatically close the input tap, so you don't need to
+// Stopping the engine will automatically close all the attached taps, so you don't need to
 // explicitly call the tap's Close function.
 //
 // NOTE: Once the engine has been stopped, starting it will have no effect.
@@ -76,6 +469,8 @@ func (e *Engine) Stop() {
 			e.stream.shutdown()
 			e.cancel()
 			e.wg.Wait()
+			e.events.close()
+			e.logger.Info("engine stopped")
 		}
 	})
 }
@@ -87,32 +482,207 @@ func (e *Engine) IsON() bool {
 	return e.isRunning
 }
 
-func (e *Engine) monitorStream(ctx context.Context) {
-	defer e.wg.Done()
+func (e *Engine) monitorStream(ctx context.Context, lane int, quit <-chan None) {
 	for {
-		select {
-		case wu, more := <-e.stream.workList:
-			if !more {
-				return
+		wu, more := e.stream.queue.pop(ctx, lane, quit)
+		if !more {
+			return
+		}
+
+		e.pool.busy()
+		e.serve(ctx, wu)
+		e.pool.idle()
+	}
+}
+
+func (e *Engine) serve(engineCtx context.Context, wu *WorkUnit) {
+	ctx, cancel := e.track(engineCtx, wu)
+	defer e.untrack(wu, cancel)
+
+	// The work unit will get cancelled if the engine stops while we are waiting
+	e.throttle.waitTask(ctx, wu.Tap)
+
+	var read int64
+	start := time.Now()
+	if wu.isCancelled() || ctx.Err() == context.Canceled {
+		wu.Task.markAsComplete(Cancelled)
+	} else {
+		e.record(wu, JournalStarted)
+		e.events.publish(EventStarted, wu, 0)
+		e.logger.Debug("work unit started", unitAttrs(wu)...)
+		start = time.Now()
+
+		handler := chain(e.interceptors, func(ctx context.Context, w *WorkUnit) error {
+			read = e.processTask(ctx, w)
+			return w.Error
+		})
+
+		err := handler(ctx, wu)
+		if err != nil {
+			wu.Error = err
+			if status := wu.Task.Status(); status == Queued || status == Completed {
+				// The unit has been vetoed or failed by an interceptor
+				wu.Task.markAsComplete(Failed)
 			}
+		}
 
-			processTask(ctx, wu)
-			wu.callBack()
-		case <-ctx.Done():
-			return
+		if ctx.Err() == context.DeadlineExceeded && wu.Task.Status() == Cancelled {
+			wu.Error = ctx.Err()
+			wu.Task.markAsComplete(Failed)
 		}
 	}
+
+	if engineCtx.Err() == nil || wu.Task.Status() != Cancelled {
+		// The units which have been cancelled by stopping the engine
+		// must be processed again once the engine restarts
+		e.record(wu, JournalFinished)
+	}
+	wu.Bytes = read
+	elapsed := time.Since(start)
+	e.metrics.ObserveUnit(wu, read, elapsed)
+	logResult(e.logger, wu, elapsed)
+	e.events.publish(completionEvent(wu.Task.Status()), wu, read)
+	wu.callBack()
 }
 
-func processTask(ctx context.Context, wu *WorkUnit) {
+// track registers the work unit as in-progress and returns its cancellable context
+func (e *Engine) track(ctx context.Context, wu *WorkUnit) (context.Context, context.CancelFunc) {
+	e.unitsMux.Lock()
+	defer e.unitsMux.Unlock()
+
+	var cancel context.CancelFunc
+	switch {
+	case !wu.Deadline.IsZero():
+		ctx, cancel = context.WithDeadline(ctx, wu.Deadline)
+	case e.timeout > 0:
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+	default:
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	e.running[wu.ID] = cancel
+	e.stream.queue.release(wu)
+	if wu.queueSpan != nil {
+		wu.queueSpan.End(nil)
+		wu.queueSpan = nil
+	}
+	return ctx, cancel
+}
+
+func (e *Engine) untrack(wu *WorkUnit, cancel context.CancelFunc) {
+	e.unitsMux.Lock()
+	defer e.unitsMux.Unlock()
+	delete(e.running, wu.ID)
+	cancel()
+}
+
+// recoverPending rebuilds the pending work units of the journal which have been dispatched by the specified tap
+func (e *Engine) recoverPending(name string, tap Tap) []*WorkUnit {
+	if e.journal == nil {
+		return nil
+	}
+
+	pending, err := e.journal.Pending()
+	if err != nil {
+		e.logger.Error("failed to read the journal",
+			slog.String(LogKeyTap, name),
+			slog.Any(LogKeyError, err),
+			slog.String(LogKeyErrorClass, ErrorClass(err)))
+		return nil
+	}
+
+	recoverable, _ := tap.(RecoverableTap)
+	var units []*WorkUnit
+	for _, entry := range pending {
+		if entry.Tap == "" {
+			entry.Tap = DefaultTapName
+		}
+		if entry.Tap != name {
+			continue
+		}
+		var wu *WorkUnit
+		if recoverable != nil {
+			wu, err = recoverable.Recover(entry)
+		}
+		if recoverable == nil || err != nil || wu == nil {
+			e.logger.Warn("work unit cannot be recovered",
+				slog.String(LogKeyUnit, entry.ID),
+				slog.String(LogKeyTap, name),
+				slog.Any(LogKeyError, err),
+				slog.String(LogKeyErrorClass, ErrorClass(err)))
+			// The work unit cannot be rebuilt. There is no point to keep it in the journal.
+			entry.Event = JournalFinished
+			entry.Status = Failed
+			entry.Time = time.Time{}
+			e.journal.Record(entry)
+			continue
+		}
+		wu.ID = entry.ID
+		wu.Tap = name
+		units = append(units, wu)
+	}
+	if len(units) > 0 {
+		e.logger.Info("work units recovered from the journal", slog.String(LogKeyTap, name), slog.Int("count", len(units)))
+	}
+	return units
+}
+
+// record records the life cycle event of the work unit in the journal (if any)
+func (e *Engine) record(wu *WorkUnit, event JournalEvent) {
+	if e.journal == nil || wu.transient {
+		return
+	}
+	// A failure to record the event is not fatal. In the worst case scenario,
+	// the work unit will get processed again after restart.
+	if err := e.journal.Record(wu.journalEntry(event)); err != nil {
+		e.logger.Warn("failed to record the work unit in the journal", append(unitAttrs(wu),
+			slog.String("event", event.String()),
+			slog.Any(LogKeyError, err),
+			slog.String(LogKeyErrorClass, ErrorClass(err)))...)
+	}
+}
+
+// processTask processes the task of the work unit and returns the number of the input bytes which have been processed
+func (e *Engine) processTask(ctx context.Context, wu *WorkUnit) int64 {
 	wu.Task.markAsInProgress()
+	stop := interruptOnCancel(ctx, wu.Task)
+	defer stop()
+
+	ctx, span := startSpan(ctx, e.tracer, SpanProcess+wu.Task.mode.String(), wu)
+
 	var status Status
-	if wu.Task.mode == Encode {
-		encoder := NewEncoder(defaultBufferSize, wu.master, wu.Task.input, wu.Task.outputs...)
+	input := &progressReader{
+		input:  e.pool.meter(wu.Task.input),
+		unit:   wu,
+		events: e.events,
+		last:   time.Now(),
+	}
+	switch wu.Task.mode {
+	case Encode:
+		encoder := newEncoder(wu.master, input, e.taskBufferSize, wu.Task.outputs...)
+		encoder.limit = e.throttle.forTap(wu.Tap)
 		status, wu.Error = encoder.EncodeContext(ctx)
-	} else {
-		encoder := NewDecoder(defaultBufferSize, wu.master, wu.Task.input, wu.Task.outputs...)
-		status, wu.Error = encoder.DecodeContext(ctx)
+	case Verify:
+		decoder := newDecoder(wu.master, input, e.taskBufferSize)
+		decoder.limit = e.throttle.forTap(wu.Tap)
+		status, wu.Error = decoder.VerifyContext(ctx)
+	default:
+		decoder := newDecoder(wu.master, input, e.taskBufferSize, wu.Task.outputs...)
+		decoder.limit = e.throttle.forTap(wu.Tap)
+		status, wu.Error = decoder.DecodeContext(ctx)
 	}
 	wu.Task.markAsComplete(status)
+	span.SetAttribute(LogKeyBytes, input.read)
+	span.SetAttribute(LogKeyStatus, status.String())
+	span.End(wu.Error)
+	return input.read
+}
+
+func completionEvent(status Status) EventType {
+	switch status {
+	case Completed:
+		return EventCompleted
+	case Cancelled:
+		return EventCancelled
+	}
+	return EventFailed
 }
@@ -2,6 +2,8 @@ package obfuscate
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"testing"
 	"time"
 
@@ -10,7 +12,7 @@ import (
 
 func TestStartStop(t *testing.T) {
 	tap := newMockedTap()
-	engine := NewEngine(1, tap)
+	engine := newTestEngine(t, tap, WithQueueSize(1))
 	engine.Start()
 
 	if !tap.IsOpen() {
@@ -32,12 +34,25 @@ func TestStartStop(t *testing.T) {
 	}
 }
 
+func TestDeprecatedEngine(t *testing.T) {
+	for _, bufferSize := range []uint16{0, 1} {
+		engine := NewEngine(bufferSize, newMockedTap())
+		expected := int(bufferSize)
+		if expected == 0 {
+			expected = DefaultQueueSize
+		}
+		if engine.Workers() != expected {
+			t.Errorf("expected %d workers, actual %d", expected, engine.Workers())
+		}
+	}
+}
+
 func TestInvalidMasterKey(t *testing.T) {
-	var count int
+	done := make(chan None, 16)
 	cb := func(w *WorkUnit) {
-		count++
-		if w.Error != errInvalidKey {
-			t.Errorf("expected '%v' as error, but received '%v", errInvalidKey, w.Error)
+		defer func() { done <- None{} }()
+		if w.Error != ErrInvalidKey {
+			t.Errorf("expected '%v' as error, but received '%v", ErrInvalidKey, w.Error)
 		}
 		status := w.Task.Status()
 		if status != Failed {
@@ -89,7 +104,7 @@ func TestInvalidMasterKey(t *testing.T) {
 	}
 
 	tap := newMockedTap()
-	engine := NewEngine(1, tap)
+	engine := newTestEngine(t, tap, WithQueueSize(1))
 	engine.Start()
 	in := filebuffer.New([]byte("input"))
 	out := filebuffer.New(nil)
@@ -104,9 +119,7 @@ func TestInvalidMasterKey(t *testing.T) {
 		})
 	}
 
-	time.Sleep(1 * time.Millisecond)
-
-	if count != len(testCases)*2 {
+	if count := waitForCallbacks(done, len(testCases)*2); count != len(testCases)*2 {
 		t.Errorf("the callback function was supposed to get called %d times, but it was called %d time(s)", len(testCases)*2, count)
 	}
 
@@ -114,11 +127,11 @@ func TestInvalidMasterKey(t *testing.T) {
 }
 
 func TestEncDec(t *testing.T) {
-	var count int
+	done := make(chan None, 16)
 	cb := func(w *WorkUnit) {
+		defer func() { done <- None{} }()
 		w.Task.CloseOutputs()
 		w.Task.CloseInput()
-		count++
 		if w.Error != nil {
 			t.Errorf("expected 'nil' as error, but received '%v", w.Error)
 		}
@@ -147,10 +160,11 @@ func TestEncDec(t *testing.T) {
 	}
 
 	tap := newMockedTap()
-	engine := NewEngine(1, tap)
+	engine := newTestEngine(t, tap, WithQueueSize(1))
 	engine.Start()
 
 	master, _ := KeyFromPassword("password")
+	var count int
 
 	for _, tc := range testCases {
 		t.Run(tc.title, func(t *testing.T) {
@@ -161,7 +175,7 @@ func TestEncDec(t *testing.T) {
 			tap.Push(NewWorkUnit(task, master, cb))
 
 			//wait until the request is served
-			time.Sleep(1 * time.Millisecond)
+			count += waitForCallbacks(done, 1)
 
 			encoded := out.Buff.Bytes()
 
@@ -176,7 +190,7 @@ func TestEncDec(t *testing.T) {
 			tap.Push(NewWorkUnit(task, master, cb))
 
 			//wait until the request is served
-			time.Sleep(1 * time.Millisecond)
+			count += waitForCallbacks(done, 1)
 
 			if !bytes.Equal(tc.input, out.Buff.Bytes()) {
 				t.Errorf("decoded result does not match the input")
@@ -184,11 +198,242 @@ func TestEncDec(t *testing.T) {
 		})
 	}
 
-	time.Sleep(1 * time.Millisecond)
-
 	if count != len(testCases)*2 {
 		t.Errorf("the callback function was supposed to get called %d times, but it was called %d time(s)", len(testCases)*2, count)
 	}
 
 	engine.Stop()
 }
+
+func TestAttachDetach(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	processed := make(chan string, 10)
+	cb := func(w *WorkUnit) {
+		processed <- w.Tap
+	}
+	push := func(tap *mockedTap) {
+		task := NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+		tap.Push(NewWorkUnit(task, master, cb))
+	}
+
+	first := newMockedTap()
+	second := newMockedTap()
+	engine := newTestEngine(t, first, WithQueueSize(2))
+	if err := engine.Attach(DefaultTapName, second); err != ErrTapAlreadyAttached {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrTapAlreadyAttached, err)
+	}
+	engine.Start()
+
+	if err := engine.Attach("second", second); err != nil {
+		t.Fatalf("failed to attach the second tap: %v", err)
+	}
+
+	if !second.IsOpen() {
+		t.Error("attaching a tap to a running engine must open the tap")
+	}
+
+	push(first)
+	push(second)
+	received := map[string]bool{<-processed: true, <-processed: true}
+	if !received[DefaultTapName] || !received["second"] {
+		t.Errorf("expected the work units of both taps to be processed, actual %v", received)
+	}
+
+	if err := engine.Detach("second"); err != nil {
+		t.Fatalf("failed to detach the second tap: %v", err)
+	}
+
+	if second.IsOpen() {
+		t.Error("detaching a tap must close it")
+	}
+
+	if err := engine.Detach("second"); err != ErrTapNotFound {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrTapNotFound, err)
+	}
+
+	// Closing the pipe of a tap must not affect the others
+	close(first.pipe)
+	third := newMockedTap()
+	engine.Attach("third", third)
+	push(third)
+	if tap := <-processed; tap != "third" {
+		t.Errorf("expected the work unit of the third tap to be processed, actual '%s'", tap)
+	}
+
+	if taps := engine.Taps(); len(taps) != 1 || taps[0] != "third" {
+		t.Errorf("expected 'third' to be the only attached tap, actual %v", taps)
+	}
+
+	engine.Stop()
+
+	if third.IsOpen() {
+		t.Error("stopping the engine must close all the taps")
+	}
+
+	if err := engine.Attach("fourth", newMockedTap()); err != ErrEngineStopped {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrEngineStopped, err)
+	}
+}
+
+func TestSetWorkers(t *testing.T) {
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap)
+	engine.SetWorkers(2)
+
+	if workers := engine.Workers(); workers != 2 {
+		t.Errorf("expected 2 workers before start, actual %d", workers)
+	}
+
+	engine.Start()
+	defer engine.Stop()
+
+	if workers := engine.Workers(); workers != 2 {
+		t.Errorf("expected 2 workers, actual %d", workers)
+	}
+
+	engine.SetWorkers(5)
+	if workers := engine.Workers(); workers != 5 {
+		t.Errorf("expected 5 workers, actual %d", workers)
+	}
+
+	engine.SetWorkers(1)
+	if workers := engine.Workers(); workers != 1 {
+		t.Errorf("expected 1 worker, actual %d", workers)
+	}
+
+	master, _ := KeyFromPassword("password")
+	done := make(chan None)
+	task := NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+	tap.Push(NewWorkUnit(task, master, func(*WorkUnit) {
+		close(done)
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the remaining worker did not process the work unit")
+	}
+}
+
+func TestAutoscaling(t *testing.T) {
+	engine := newTestEngine(t, newMockedTap())
+	if err := engine.SetAutoscaling(2, 4, time.Hour); err != nil {
+		t.Fatalf("failed to enable autoscaling: %v", err)
+	}
+
+	if workers := engine.Workers(); workers != 4 {
+		t.Errorf("expected the workers to be capped at 4, actual %d", workers)
+	}
+
+	engine.SetWorkers(1)
+	if workers := engine.Workers(); workers != 2 {
+		t.Errorf("expected the workers not to go below 2, actual %d", workers)
+	}
+
+	engine.Start()
+	defer engine.Stop()
+
+	if err := engine.SetAutoscaling(1, 2, time.Hour); err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.SetWorkers(1)
+	engine.Start()
+	defer engine.Stop()
+
+	done := make(chan *WorkUnit, 2)
+	cb := func(w *WorkUnit) {
+		done <- w
+	}
+
+	blocked, writer := io.Pipe()
+	defer writer.Close()
+	first := NewWorkUnit(NewTask(Encode, blocked, filebuffer.New(nil)), master, cb)
+	second := NewWorkUnit(NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil)), master, cb)
+	tap.Push(first, second)
+
+	// wait for the first unit to block the only worker
+	time.Sleep(10 * time.Millisecond)
+
+	if err := engine.Cancel(second.ID); err != nil {
+		t.Fatalf("failed to cancel the queued work unit: %v", err)
+	}
+
+	if err := engine.Cancel(first.ID); err != nil {
+		t.Fatalf("failed to cancel the in-progress work unit: %v", err)
+	}
+
+	for _, expected := range []*WorkUnit{first, second} {
+		select {
+		case w := <-done:
+			if w != expected {
+				t.Errorf("expected '%s' to be finished, actual '%s'", expected.ID, w.ID)
+			}
+			if status := w.Task.Status(); status != Cancelled {
+				t.Errorf("expected status '%v', actual '%v'", Cancelled, status)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the work unit did not get cancelled")
+		}
+	}
+
+	if err := engine.Cancel(first.ID); err != ErrUnitNotFound {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrUnitNotFound, err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.Start()
+	defer engine.Stop()
+
+	done := make(chan *WorkUnit)
+	blocked, writer := io.Pipe()
+	defer writer.Close()
+	wu := NewWorkUnit(NewTask(Encode, blocked, filebuffer.New(nil)), master, func(w *WorkUnit) {
+		done <- w
+	})
+	wu.Deadline = time.Now().Add(10 * time.Millisecond)
+	tap.Push(wu)
+
+	select {
+	case w := <-done:
+		if status := w.Task.Status(); status != Failed {
+			t.Errorf("expected status '%v', actual '%v'", Failed, status)
+		}
+		if w.Error != context.DeadlineExceeded {
+			t.Errorf("expected '%v' as error, but received '%v'", context.DeadlineExceeded, w.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the work unit did not time out")
+	}
+}
+
+func newTestEngine(t *testing.T, tap Tap, opts ...EngineOption) *Engine {
+	t.Helper()
+	engine, err := NewEngineWithOptions(tap, opts...)
+	if err != nil {
+		t.Fatalf("failed to create the engine: %v", err)
+	}
+	return engine
+}
+
+// waitForCallbacks waits for the expected number of callbacks and returns the number of the received ones
+func waitForCallbacks(done <-chan None, expected int) int {
+	timeout := time.After(time.Second)
+	for count := 0; count < expected; count++ {
+		select {
+		case <-done:
+		case <-timeout:
+			return count
+		}
+	}
+	return expected
+}
@@ -1,12 +1,68 @@
 package obfuscate
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	errInvalidSignature = errors.New("invalid signature")
-	errInvalidKey       = errors.New("invalid key")
-	errEmptyPassword    = errors.New("password cannot be empty")
-	errInvalidPassword  = errors.New("password must be at least eight characters long")
+	// ErrInvalidKey the master key is malformed (i.e. it has not been created by KeyFromPassword)
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrWrongKey the content has not been encoded using the master key
+	ErrWrongKey = errors.New("the content has not been encoded using the master key")
+	// ErrTruncated the encoded content is shorter than the minimum valid length
+	ErrTruncated = errors.New("the encoded content is truncated")
+	// ErrCorrupted the encoded content has been damaged or encrypted using another key, so it cannot be decoded
+	ErrCorrupted = errors.New("the encoded content is corrupted")
+	// ErrUnsupportedVersion the encoded content has been produced by an unsupported version of the format
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	// ErrEmptyPassword the password is empty
+	ErrEmptyPassword = errors.New("password cannot be empty")
+	// ErrInvalidPassword the password is too short
+	ErrInvalidPassword = errors.New("password must be at least eight characters long")
 	// ErrOperationInProgress an invalid request has been sent to an in-progress operation
 	ErrOperationInProgress = errors.New("the operation is in progress")
+	// ErrTapAlreadyAttached another tap with the same name has already been attached to the engine
+	ErrTapAlreadyAttached = errors.New("a tap with the same name has already been attached")
+	// ErrTapNotFound the tap has not been attached to the engine
+	ErrTapNotFound = errors.New("the tap is not attached")
+	// ErrUnitNotFound the work unit is neither queued nor in progress
+	ErrUnitNotFound = errors.New("the work unit is neither queued nor in progress")
+	// ErrEngineStopped the engine has already been stopped
+	ErrEngineStopped = errors.New("the engine has been stopped")
+	// ErrCancelled the processing of the work unit has been cancelled
+	ErrCancelled = errors.New("the work unit has been cancelled")
+	// ErrInvalidConfig the configuration options are not valid
+	ErrInvalidConfig = errors.New("invalid configuration")
+	// ErrNameTooLong the encrypted file name is longer than the maximum length supported by the filesystems
+	ErrNameTooLong = errors.New("the encrypted name is too long")
 )
+
+// IOError is the error returned by the Encoder and the Decoder when reading from the input
+// or writing to the outputs fails. The original error can be inspected using errors.Is and errors.As.
+type IOError struct {
+	// Op the failed operation (read or write)
+	Op string
+	// Offset the position of the failure in the input (read) or the output (write) stream
+	Offset int64
+	// Err the original error
+	Err error
+}
+
+// Error returns the error message
+func (e *IOError) Error() string {
+	return fmt.Sprintf("%s failed at offset %d: %s", e.Op, e.Offset, e.Err)
+}
+
+// Unwrap returns the original error
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+func readError(offset int64, err error) error {
+	return &IOError{Op: "read", Offset: offset, Err: err}
+}
+
+func writeError(offset int64, err error) error {
+	return &IOError{Op: "write", Offset: offset, Err: err}
+}
@@ -0,0 +1,237 @@
+package obfuscate
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestDecodeErrors(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	another, _ := KeyFromPassword("another password")
+	failure := errors.New("disk failure")
+
+	encoded := filebuffer.New(nil)
+	if _, err := newTestEncoder(t, master, filebuffer.New(make([]byte, 100)), encoded).Encode(); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	content := encoded.Buff.Bytes()
+	modify := func(index int, value byte) []byte {
+		modified := append([]byte{}, content...)
+		modified[index] ^= value
+		return modified
+	}
+
+	testCases := []struct {
+		title          string
+		master         *MasterKey
+		input          *faultyStream
+		expectedError  error
+		expectedOffset int64
+	}{
+		{
+			title:         "invalid_master_key",
+			master:        &MasterKey{},
+			input:         &faultyStream{data: content, limit: len(content)},
+			expectedError: ErrInvalidKey,
+		},
+		{
+			title:         "wrong_key",
+			master:        another,
+			input:         &faultyStream{data: content, limit: len(content)},
+			expectedError: ErrWrongKey,
+		},
+		{
+			title:         "truncated_header",
+			master:        master,
+			input:         &faultyStream{data: content, limit: 10},
+			expectedError: ErrTruncated,
+		},
+		{
+			title:         "unversioned_stream_with_another_key",
+			master:        another,
+			input:         &faultyStream{data: content[prefixLength:], limit: len(content) - prefixLength},
+			expectedError: ErrWrongKey,
+		},
+		{
+			title:         "truncated_unversioned_header",
+			master:        master,
+			input:         &faultyStream{data: content[prefixLength:], limit: legacyHeaderLength - 1},
+			expectedError: ErrTruncated,
+		},
+		{
+			title:         "unknown_version",
+			master:        master,
+			input:         &faultyStream{data: modify(prefixLength-1, 0xff), limit: len(content)},
+			expectedError: ErrUnsupportedVersion,
+		},
+		{
+			title:         "modified_payload",
+			master:        master,
+			input:         &faultyStream{data: modify(headerLength+10, 1), limit: len(content)},
+			expectedError: ErrCorrupted,
+		},
+		{
+			title:         "modified_iv",
+			master:        master,
+			input:         &faultyStream{data: modify(headerLength-1, 1), limit: len(content)},
+			expectedError: ErrCorrupted,
+		},
+		{
+			title:         "modified_tag",
+			master:        master,
+			input:         &faultyStream{data: modify(len(content)-1, 1), limit: len(content)},
+			expectedError: ErrCorrupted,
+		},
+		{
+			title:         "truncated_payload",
+			master:        master,
+			input:         &faultyStream{data: content, limit: len(content) - 1},
+			expectedError: ErrCorrupted,
+		},
+		{
+			title:         "truncated_tag",
+			master:        master,
+			input:         &faultyStream{data: content, limit: headerLength + tagLength - 1},
+			expectedError: ErrTruncated,
+		},
+		{
+			title:          "read_failure_in_the_header",
+			master:         master,
+			input:          &faultyStream{data: content, limit: 10, err: failure},
+			expectedError:  failure,
+			expectedOffset: 10,
+		},
+		{
+			title:          "unexpected_end_of_the_payload",
+			master:         master,
+			input:          &faultyStream{data: content, limit: headerLength + 20, err: io.ErrUnexpectedEOF},
+			expectedError:  ErrCorrupted,
+			expectedOffset: headerLength + 20,
+		},
+		{
+			title:          "read_failure_in_the_payload",
+			master:         master,
+			input:          &faultyStream{data: content, limit: headerLength + 20, err: failure},
+			expectedError:  failure,
+			expectedOffset: headerLength + 20,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			decoder := newTestDecoder(t, tc.master, tc.input, filebuffer.New(nil))
+			status, err := decoder.Decode()
+			if status != Failed {
+				t.Errorf("expected decoding status to be '%s', actual '%s'", Failed, status)
+			}
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			var ioErr *IOError
+			if errors.As(err, &ioErr) {
+				if ioErr.Op != "read" {
+					t.Errorf("expected read operation, actual %s", ioErr.Op)
+				}
+				if ioErr.Offset != tc.expectedOffset {
+					t.Errorf("expected failure at offset %d, actual %d", tc.expectedOffset, ioErr.Offset)
+				}
+			} else if tc.expectedOffset > 0 {
+				t.Errorf("expected an I/O error, but received '%v'", err)
+			}
+		})
+	}
+}
+
+func TestEncodeWriteError(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	failure := errors.New("disk full")
+
+	testCases := []struct {
+		title          string
+		limit          int
+		expectedOffset int64
+	}{
+		{
+			title:          "write_failure_in_the_signature",
+			limit:          prefixLength + 5,
+			expectedOffset: prefixLength + 5,
+		},
+		{
+			title:          "write_failure_in_the_iv",
+			limit:          prefixLength + signatureLength + 3,
+			expectedOffset: prefixLength + signatureLength + 3,
+		},
+		{
+			title:          "write_failure_in_the_payload",
+			limit:          headerLength + 50,
+			expectedOffset: headerLength + 50,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			output := &faultyStream{limit: tc.limit, err: failure}
+			encoder := newTestEncoder(t, master, filebuffer.New(make([]byte, 100)), output)
+			status, err := encoder.Encode()
+			if status != Failed {
+				t.Errorf("expected encoding status to be '%s', actual '%s'", Failed, status)
+			}
+			var ioErr *IOError
+			if !errors.As(err, &ioErr) {
+				t.Fatalf("expected an I/O error, but received '%v'", err)
+			}
+			if !errors.Is(err, failure) {
+				t.Errorf("expected '%v' as error, but received '%v'", failure, err)
+			}
+			if ioErr.Op != "write" {
+				t.Errorf("expected write operation, actual %s", ioErr.Op)
+			}
+			if ioErr.Offset != tc.expectedOffset {
+				t.Errorf("expected failure at offset %d, actual %d", tc.expectedOffset, ioErr.Offset)
+			}
+		})
+	}
+}
+
+func TestDecryptBytesErrors(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	another, _ := KeyFromPassword("another password")
+	encrypted, err := EncryptBytes(master.key, []byte("a secret which is long enough to be corrupted"))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	testCases := []struct {
+		title         string
+		key           []byte
+		input         []byte
+		expectedError error
+	}{
+		{
+			title:         "truncated_input",
+			key:           master.key,
+			input:         encrypted[:5],
+			expectedError: ErrTruncated,
+		},
+		{
+			title:         "wrong_key",
+			key:           another.key,
+			input:         encrypted,
+			expectedError: ErrCorrupted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			input := make([]byte, len(tc.input))
+			copy(input, tc.input)
+			_, err := DecryptBytes(tc.key, input)
+			if !errors.Is(err, tc.expectedError) {
+				t.Errorf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package obfuscate
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is the minimum interval between two progress events of the same work unit
+const progressInterval = 250 * time.Millisecond
+
+// EventType represents the type of an engine event
+type EventType int8
+
+const (
+	// EventQueued the work unit has been received by the engine
+	EventQueued EventType = iota
+	// EventStarted the engine has started processing the work unit
+	EventStarted
+	// EventProgressed a part of the work unit's input has been processed
+	EventProgressed
+	// EventCompleted the work unit has been processed successfully
+	EventCompleted
+	// EventFailed the processing of the work unit has failed
+	EventFailed
+	// EventCancelled the processing of the work unit has been cancelled
+	EventCancelled
+	// EventRetried the unfinished work unit has been recovered from the journal and queued again
+	EventRetried
+)
+
+// String returns the string representation of the event type
+func (t EventType) String() string {
+	switch t {
+	case EventQueued:
+		return "queued"
+	case EventStarted:
+		return "started"
+	case EventProgressed:
+		return "progressed"
+	case EventCompleted:
+		return "completed"
+	case EventFailed:
+		return "failed"
+	case EventCancelled:
+		return "cancelled"
+	case EventRetried:
+		return "retried"
+	}
+	return "unknown"
+}
+
+// Event is a notification published by the engine about the life cycle of a work unit
+type Event struct {
+	// Type the type of the event
+	Type EventType
+	// Unit the work unit
+	Unit *WorkUnit
+	// Bytes the number of input bytes processed so far
+	Bytes int64
+	// Error the error happened during the processing of the work unit (if any)
+	Error error
+	// Time the time at which the event has been published
+	Time time.Time
+}
+
+// DeliveryPolicy specifies what happens to an event when the buffer of a subscription is full
+type DeliveryPolicy int8
+
+const (
+	// Block blocks the engine until the subscriber receives the event.
+	// Use this policy with care, since a slow subscriber will stall the processing.
+	Block DeliveryPolicy = iota
+	// DropNewest discards the new event
+	DropNewest
+	// DropOldest discards the oldest event in the buffer to make room for the new one
+	DropOldest
+)
+
+// Subscription is a subscriber's view of the engine events
+type Subscription struct {
+	events  chan Event
+	policy  DeliveryPolicy
+	dropped uint64
+	done    chan None
+	once    sync.Once
+}
+
+// Events returns the channel on which the events will be delivered.
+// The channel will be closed once the subscription has been cancelled or the engine stops.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of the events which have been discarded due to the full buffer
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) deliver(event Event) {
+	switch s.policy {
+	case DropNewest:
+		select {
+		case s.events <- event:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+			select {
+			case <-s.events:
+				atomic.AddUint64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+	}
+}
+
+// eventBus fans the engine events out to the subscriptions
+type eventBus struct {
+	subscriptions map[*Subscription]None
+	count         int32
+	closed        bool
+	mux           sync.RWMutex
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscriptions: make(map[*Subscription]None),
+	}
+}
+
+func (b *eventBus) subscribe(buffer int, policy DeliveryPolicy) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &Subscription{
+		events: make(chan Event, buffer),
+		policy: policy,
+		done:   make(chan None),
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.closed {
+		close(s.done)
+		close(s.events)
+		return s
+	}
+	b.subscriptions[s] = None{}
+	atomic.AddInt32(&b.count, 1)
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *Subscription) {
+	s.once.Do(func() {
+		// release the publishers which are blocked on the subscription
+		close(s.done)
+		b.mux.Lock()
+		if _, ok := b.subscriptions[s]; ok {
+			delete(b.subscriptions, s)
+			atomic.AddInt32(&b.count, -1)
+			close(s.events)
+		}
+		b.mux.Unlock()
+	})
+}
+
+// active returns true if there is at least one subscriber
+func (b *eventBus) active() bool {
+	return atomic.LoadInt32(&b.count) > 0
+}
+
+func (b *eventBus) publish(t EventType, w *WorkUnit, bytes int64) {
+	if !b.active() {
+		return
+	}
+	event := Event{
+		Type:  t,
+		Unit:  w,
+		Bytes: bytes,
+		Error: w.Error,
+		Time:  time.Now(),
+	}
+
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	for s := range b.subscriptions {
+		s.deliver(event)
+	}
+}
+
+// close cancels all the subscriptions
+func (b *eventBus) close() {
+	b.mux.Lock()
+	b.closed = true
+	subscriptions := make([]*Subscription, 0, len(b.subscriptions))
+	for s := range b.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	b.mux.Unlock()
+
+	for _, s := range subscriptions {
+		b.unsubscribe(s)
+	}
+}
+
+// progressReader publishes the progress events of a work unit while its input is being read
+type progressReader struct {
+	input  io.Reader
+	unit   *WorkUnit
+	events *eventBus
+	read   int64
+	last   time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.input.Read(b)
+	p.read += int64(n)
+	if n > 0 && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.events.publish(EventProgressed, p.unit, p.read)
+	}
+	return n, err
+}
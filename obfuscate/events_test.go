@@ -0,0 +1,127 @@
+package obfuscate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestSubscribe(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	testCases := []struct {
+		title    string
+		master   *MasterKey
+		expected []EventType
+	}{
+		{
+			title:    "successful_work_unit",
+			master:   master,
+			expected: []EventType{EventQueued, EventStarted, EventCompleted},
+		},
+		{
+			title:    "failed_work_unit",
+			master:   nil,
+			expected: []EventType{EventQueued, EventStarted, EventFailed},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			tap := newMockedTap()
+			engine := newTestEngine(t, tap, WithQueueSize(1))
+			first := engine.Subscribe(10, Block)
+			second := engine.Subscribe(10, DropNewest)
+			engine.Start()
+
+			task := NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+			wu := NewWorkUnit(task, tc.master, nil)
+			tap.Push(wu)
+
+			for _, s := range []*Subscription{first, second} {
+				for _, expected := range tc.expected {
+					select {
+					case event := <-s.Events():
+						if event.Type != expected {
+							t.Errorf("expected '%v' event, actual '%v'", expected, event.Type)
+						}
+						if event.Unit != wu {
+							t.Errorf("expected the event of the pushed work unit")
+						}
+					case <-time.After(time.Second):
+						t.Fatalf("expected '%v' event, but nothing received", expected)
+					}
+				}
+			}
+
+			engine.Stop()
+
+			if _, more := <-first.Events(); more {
+				t.Error("stopping the engine must close the subscriptions")
+			}
+		})
+	}
+}
+
+func TestSubscriptionPolicies(t *testing.T) {
+	testCases := []struct {
+		title    string
+		policy   DeliveryPolicy
+		expected EventType
+	}{
+		{
+			title:    "drop_newest_must_keep_the_first_event",
+			policy:   DropNewest,
+			expected: EventQueued,
+		},
+		{
+			title:    "drop_oldest_must_keep_the_last_event",
+			policy:   DropOldest,
+			expected: EventCompleted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			bus := newEventBus()
+			s := bus.subscribe(1, tc.policy)
+			w := &WorkUnit{}
+			bus.publish(EventQueued, w, 0)
+			bus.publish(EventStarted, w, 0)
+			bus.publish(EventCompleted, w, 0)
+
+			if s.Dropped() != 2 {
+				t.Errorf("expected 2 dropped events, actual %d", s.Dropped())
+			}
+
+			event := <-s.Events()
+			if event.Type != tc.expected {
+				t.Errorf("expected '%v' event, actual '%v'", tc.expected, event.Type)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeReleasesBlockedPublishers(t *testing.T) {
+	bus := newEventBus()
+	s := bus.subscribe(1, Block)
+	done := make(chan None)
+	go func() {
+		bus.publish(EventQueued, &WorkUnit{}, 0)
+		bus.publish(EventStarted, &WorkUnit{}, 0)
+		close(done)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	bus.unsubscribe(s)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the publisher is still blocked")
+	}
+
+	if bus.active() {
+		t.Error("the bus must not have any subscribers")
+	}
+}
@@ -0,0 +1,158 @@
+package obfuscate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	gohash "hash"
+	"io"
+
+	"github.com/xitonix/xvault/hash"
+)
+
+const (
+	// formatMagic identifies the encoded streams
+	formatMagic = "XVLT"
+	// formatVersion the current version of the stream format
+	formatVersion = 1
+	// prefixLength the length of the magic and the version which precede the signature
+	prefixLength = 5
+	// tagLength the length of the authentication tag which terminates the encoded stream
+	tagLength = sha256.Size
+	// streamMacKeyPurpose is the purpose of the key derived from the master key to authenticate the streams
+	streamMacKeyPurpose = "xvault/stream/mac"
+)
+
+// The layout of an encoded stream (version 1):
+//
+//	magic (4) | version (1) | signature (28) | IV (16) | cipher text | tag (32)
+//
+// The tag is the HMAC-SHA256 of everything which precedes it, calculated using a key derived from the master key.
+// The streams produced by the earlier versions of the package (the signature followed by the IV) carry no
+// magic, and are rejected with ErrUnsupportedVersion.
+
+// Cipher is the cipher of the encoded streams (i.e. "aes-256-cfb")
+type Cipher string
+
+// Compression is the compression of the content of the encoded streams (i.e. "none")
+type Compression string
+
+const (
+	// CipherAES256CFB encrypts the content using AES-256 in CFB mode and authenticates it using HMAC-SHA256.
+	// It is the only cipher supported by the current version of the format.
+	CipherAES256CFB Cipher = "aes-256-cfb"
+	// CompressionNone stores the content uncompressed.
+	// The current version of the format does not support compression.
+	CompressionNone Compression = "none"
+)
+
+// validate returns an error of type ErrInvalidConfig if the cipher is not supported
+func (c Cipher) validate() error {
+	if c != "" && c != CipherAES256CFB {
+		return invalidConfig("unsupported cipher '%s': only '%s' is supported by the stream format version %d", c, CipherAES256CFB, formatVersion)
+	}
+	return nil
+}
+
+// validate returns an error of type ErrInvalidConfig if the compression is not supported
+func (c Compression) validate() error {
+	if c != "" && c != CompressionNone {
+		return invalidConfig("unsupported compression '%s': the stream format version %d does not support compression", c, formatVersion)
+	}
+	return nil
+}
+
+// newStreamMac creates the MAC which authenticates the encoded streams of the master key
+func newStreamMac(master *MasterKey) (gohash.Hash, error) {
+	key, err := master.DeriveKey(streamMacKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return hash.NewHMAC256(key), nil
+}
+
+// authWriter feeds the cipher text written to the output into the MAC
+type authWriter struct {
+	output  io.Writer
+	mac     gohash.Hash
+	written int64
+}
+
+func (a *authWriter) Write(p []byte) (int, error) {
+	n, err := a.output.Write(p)
+	a.mac.Write(p[:n])
+	a.written += int64(n)
+	return n, err
+}
+
+// seal writes the authentication tag to the output
+func (a *authWriter) seal() error {
+	n, err := a.output.Write(a.mac.Sum(nil))
+	if err != nil {
+		return writeError(headerLength+a.written+int64(n), err)
+	}
+	return nil
+}
+
+// authReader feeds the cipher text read from the input into the MAC.
+// The last tagLength bytes of the input are held back, so that the tag never gets decrypted.
+type authReader struct {
+	input  io.Reader
+	mac    gohash.Hash
+	buffer []byte
+	tail   []byte
+	// the position in the input stream
+	offset int64
+	err    error
+}
+
+func newAuthReader(input io.Reader, mac gohash.Hash) *authReader {
+	return &authReader{
+		input:  input,
+		mac:    mac,
+		offset: headerLength,
+	}
+}
+
+func (a *authReader) Read(p []byte) (int, error) {
+	for {
+		if a.err != nil {
+			return 0, a.err
+		}
+		if cap(a.buffer) < len(p)+tagLength {
+			a.buffer = make([]byte, len(p)+tagLength)
+		}
+		buffer := a.buffer[:len(p)+tagLength]
+		held := copy(buffer, a.tail)
+		n, err := a.input.Read(buffer[held:])
+		a.offset += int64(n)
+
+		total := held + n
+		released := total - tagLength
+		if released < 0 {
+			released = 0
+		}
+		copy(p, buffer[:released])
+		a.tail = append(a.tail[:0], buffer[released:total]...)
+		a.mac.Write(p[:released])
+
+		if err == io.EOF {
+			a.err = io.EOF
+		} else if err != nil {
+			a.err = readError(a.offset, err)
+		}
+		if released > 0 {
+			return released, nil
+		}
+	}
+}
+
+// verify checks the tag at the end of the input once it's been read in full
+func (a *authReader) verify() error {
+	if len(a.tail) < tagLength {
+		return ErrTruncated
+	}
+	if !hmac.Equal(a.mac.Sum(nil), a.tail) {
+		return ErrCorrupted
+	}
+	return nil
+}
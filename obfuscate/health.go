@@ -0,0 +1,63 @@
+package obfuscate
+
+import "errors"
+
+// Health represents the integrity of an encoded stream
+type Health int8
+
+const (
+	// Healthy the stream can be decrypted in full using the master key
+	Healthy Health = iota
+	// WrongKey the stream has not been encoded using the master key
+	WrongKey
+	// Truncated the stream is too short to be a valid encoded stream
+	Truncated
+	// Unreadable the stream could not be read
+	Unreadable
+	// Unverified the verification has not been finished
+	Unverified
+	// Corrupted the stream has been modified since it's been encoded
+	Corrupted
+	// Unsupported the stream has been encoded using an unsupported version of the format
+	Unsupported
+)
+
+// String returns the string representation of the health
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "healthy"
+	case WrongKey:
+		return "wrong key"
+	case Truncated:
+		return "truncated"
+	case Unreadable:
+		return "unreadable"
+	case Unverified:
+		return "unverified"
+	case Corrupted:
+		return "corrupted"
+	case Unsupported:
+		return "unsupported"
+	}
+	return "unknown"
+}
+
+// CheckHealth classifies the result of a verification (See Decoder.Verify)
+func CheckHealth(status Status, err error) Health {
+	switch {
+	case status == Completed:
+		return Healthy
+	case errors.Is(err, ErrWrongKey), errors.Is(err, ErrInvalidKey):
+		return WrongKey
+	case errors.Is(err, ErrTruncated):
+		return Truncated
+	case errors.Is(err, ErrCorrupted):
+		return Corrupted
+	case errors.Is(err, ErrUnsupportedVersion):
+		return Unsupported
+	case status == Failed:
+		return Unreadable
+	}
+	return Unverified
+}
@@ -0,0 +1,76 @@
+package obfuscate
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DurationMetadataKey is the metadata key under which the TimingInterceptor stores the processing time of a work unit
+const DurationMetadataKey = "duration"
+
+// Handler processes a work unit
+type Handler func(ctx context.Context, w *WorkUnit) error
+
+// Interceptor is a function which gets called by the engine around the processing of every work unit.
+//
+// An interceptor can:
+//	- veto the processing by returning an error without calling next
+//	- wrap the input and the output streams of the task (See Task.WrapInput and Task.WrapOutputs)
+//	- enrich the work unit's Metadata
+//	- decorate the context which will be passed to the rest of the chain
+//
+// The interceptors MUST call next to carry on processing the work unit. The error returned
+// by an interceptor will fail the work unit.
+type Interceptor func(ctx context.Context, w *WorkUnit, next Handler) error
+
+// chain builds a handler which runs the interceptors in order around the final handler
+func chain(interceptors []Interceptor, final Handler) Handler {
+	handler := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, w *WorkUnit) error {
+			return interceptor(ctx, w, next)
+		}
+	}
+	return handler
+}
+
+// LoggingInterceptor logs the start and the result of every work unit using the specified structured logger.
+// The records carry the same attributes as the engine's (See LogKeyUnit etc).
+// The default logger will be used if the logger is nil.
+func LoggingInterceptor(logger *slog.Logger) Interceptor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(ctx context.Context, w *WorkUnit, next Handler) error {
+		logger.Info("work unit started", unitAttrs(w)...)
+		start := time.Now()
+		err := next(ctx, w)
+		attrs := append(unitAttrs(w),
+			slog.String(LogKeyStatus, w.Task.Status().String()),
+			slog.Duration(LogKeyDuration, time.Since(start)),
+		)
+		if err != nil {
+			attrs = append(attrs,
+				slog.Any(LogKeyError, err),
+				slog.String(LogKeyErrorClass, ErrorClass(err)),
+			)
+			logger.Error("work unit failed", attrs...)
+			return err
+		}
+		logger.Info("work unit finished", attrs...)
+		return nil
+	}
+}
+
+// TimingInterceptor measures the processing time of every work unit and stores
+// it in the unit's Metadata under DurationMetadataKey as a time.Duration value.
+func TimingInterceptor() Interceptor {
+	return func(ctx context.Context, w *WorkUnit, next Handler) error {
+		start := time.Now()
+		err := next(ctx, w)
+		w.Metadata[DurationMetadataKey] = time.Since(start)
+		return err
+	}
+}
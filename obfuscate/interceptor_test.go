@@ -0,0 +1,153 @@
+package obfuscate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestInterceptors(t *testing.T) {
+	errVetoed := errors.New("vetoed")
+	master, _ := KeyFromPassword("password")
+
+	testCases := []struct {
+		title          string
+		interceptors   []Interceptor
+		expectedStatus Status
+		expectedError  error
+		expectedOrder  string
+	}{
+		{
+			title: "interceptors_must_be_called_in_order",
+			interceptors: []Interceptor{
+				func(ctx context.Context, w *WorkUnit, next Handler) error {
+					w.Metadata["order"] = "1"
+					return next(ctx, w)
+				},
+				func(ctx context.Context, w *WorkUnit, next Handler) error {
+					w.Metadata["order"] = w.Metadata["order"].(string) + "2"
+					return next(ctx, w)
+				},
+			},
+			expectedStatus: Completed,
+			expectedOrder:  "12",
+		},
+		{
+			title: "vetoed_work_units_must_fail",
+			interceptors: []Interceptor{
+				func(ctx context.Context, w *WorkUnit, next Handler) error {
+					return errVetoed
+				},
+			},
+			expectedStatus: Failed,
+			expectedError:  errVetoed,
+		},
+		{
+			title: "interceptor_failures_after_processing_must_fail_the_unit",
+			interceptors: []Interceptor{
+				func(ctx context.Context, w *WorkUnit, next Handler) error {
+					if err := next(ctx, w); err != nil {
+						return err
+					}
+					return errVetoed
+				},
+			},
+			expectedStatus: Failed,
+			expectedError:  errVetoed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			tap := newMockedTap()
+			engine := newTestEngine(t, tap, WithQueueSize(1))
+			engine.Use(tc.interceptors...)
+			engine.Start()
+			defer engine.Stop()
+
+			done := make(chan *WorkUnit)
+			task := NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+			tap.Push(NewWorkUnit(task, master, func(w *WorkUnit) {
+				done <- w
+			}))
+
+			w := <-done
+			if status := w.Task.Status(); status != tc.expectedStatus {
+				t.Errorf("expected status '%v', actual '%v'", tc.expectedStatus, status)
+			}
+			if w.Error != tc.expectedError {
+				t.Errorf("expected '%v' as error, but received '%v'", tc.expectedError, w.Error)
+			}
+			if tc.expectedOrder != "" && w.Metadata["order"] != tc.expectedOrder {
+				t.Errorf("expected '%s' order, actual '%v'", tc.expectedOrder, w.Metadata["order"])
+			}
+		})
+	}
+
+	engine := newTestEngine(t, newMockedTap(), WithQueueSize(1))
+	engine.Start()
+	defer engine.Stop()
+	if err := engine.Use(TimingInterceptor()); err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+}
+
+func TestInterceptorsWrappingStreams(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.Use(func(ctx context.Context, w *WorkUnit, next Handler) error {
+		w.Task.WrapInput(func(r io.Reader) io.Reader {
+			return io.MultiReader(strings.NewReader("wrapped "), r)
+		})
+		return next(ctx, w)
+	})
+	engine.Start()
+	defer engine.Stop()
+
+	done := make(chan None)
+	out := filebuffer.New(nil)
+	task := NewTask(Encode, filebuffer.New([]byte("input")), out)
+	tap.Push(NewWorkUnit(task, master, func(w *WorkUnit) {
+		close(done)
+	}))
+	<-done
+
+	decoded := filebuffer.New(nil)
+	newTestDecoder(t, master, filebuffer.New(out.Buff.Bytes()), decoded).Decode()
+	if decoded.Buff.String() != "wrapped input" {
+		t.Errorf("expected 'wrapped input', actual '%s'", decoded.Buff.String())
+	}
+}
+
+func TestBuiltInInterceptors(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	handler := chain([]Interceptor{
+		LoggingInterceptor(slog.New(slog.NewTextHandler(buffer, nil))),
+		TimingInterceptor(),
+	}, func(ctx context.Context, w *WorkUnit) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	w := NewWorkUnit(NewTask(Encode, &OnlyReader{}, &OnlyWriter{}), nil, nil)
+	handler(context.Background(), w)
+
+	duration, ok := w.Metadata[DurationMetadataKey].(time.Duration)
+	if !ok || duration < time.Millisecond {
+		t.Errorf("expected the duration to be stored in the metadata, actual %v", w.Metadata[DurationMetadataKey])
+	}
+
+	for _, expected := range []string{`msg="work unit started"`, `msg="work unit finished"`, LogKeyUnit + "=" + w.ID, LogKeyStatus + "="} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("expected '%s' to be logged, actual '%s'", expected, buffer.String())
+		}
+	}
+}
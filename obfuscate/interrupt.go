@@ -0,0 +1,64 @@
+package obfuscate
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// interruptGracePeriod is the time a cancelled task gets to stop by itself, before its input gets interrupted
+const interruptGracePeriod = 100 * time.Millisecond
+
+// readDeadliner is implemented by the readers which support read deadlines (i.e. net.Conn)
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// interruptOnCancel interrupts the blocked reads of the task's input once the context is done.
+//
+// The task gets a short grace period to notice the cancellation. If it's still blocked afterwards,
+// the read deadline of the input will be set to the past, or if the input does not support deadlines,
+// it will be closed. Call the returned function once the processing has been finished.
+func interruptOnCancel(ctx context.Context, t *Task) func() {
+	finished := make(chan None)
+	go func() {
+		select {
+		case <-finished:
+			return
+		case <-ctx.Done():
+		}
+
+		timer := time.NewTimer(interruptGracePeriod)
+		defer timer.Stop()
+		select {
+		case <-finished:
+			return
+		case <-timer.C:
+		}
+
+		interrupt(t.readers())
+	}()
+	return func() {
+		close(finished)
+	}
+}
+
+// interrupt unblocks the pending reads of the input.
+// The readers must be ordered from the outermost wrapper to the original input.
+func interrupt(readers []io.Reader) {
+	for _, r := range readers {
+		if d, ok := r.(readDeadliner); ok {
+			if d.SetReadDeadline(time.Now()) == nil {
+				return
+			}
+		}
+	}
+
+	// Closing the original input fails the reads of all the wrappers
+	for i := len(readers) - 1; i >= 0; i-- {
+		if c, ok := readers[i].(io.Closer); ok {
+			c.Close()
+			return
+		}
+	}
+}
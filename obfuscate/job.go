@@ -0,0 +1,287 @@
+package obfuscate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RollbackFunc is a function which reverts the outputs of a work unit (i.e. deletes the output files).
+type RollbackFunc func(*WorkUnit) error
+
+// JobStats represents the aggregate progress of a Job
+type JobStats struct {
+	// Total the number of the work units which have been added to the job
+	Total int
+	// Pending the number of the work units which have not been finished yet
+	Pending int
+	// Completed the number of the successfully processed work units
+	Completed int
+	// Failed the number of the failed work units
+	Failed int
+	// Cancelled the number of the cancelled work units
+	Cancelled int
+	// Bytes the total number of input bytes processed by the finished work units
+	Bytes int64
+}
+
+// JobError is the combined error report of a Job
+type JobError struct {
+	// Errors the errors of the unsuccessful work units by ID
+	Errors map[string]error
+	// RollbackErrors the errors happened while reverting the outputs of the work units by ID
+	RollbackErrors map[string]error
+	// RolledBack is true if the outputs of the job members have been reverted
+	RolledBack bool
+}
+
+// Error returns the summary of the failures
+func (e *JobError) Error() string {
+	ids := make([]string, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprintf("%s: %s", id, e.Errors[id])
+	}
+
+	msg := fmt.Sprintf("%d work unit(s) did not complete: %s", len(ids), strings.Join(parts, "; "))
+	if e.RolledBack {
+		msg += " (rolled back)"
+	}
+	return msg
+}
+
+// Unwrap returns the errors of the unsuccessful work units, so that they can be inspected by errors.Is and errors.As
+func (e *JobError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors)+len(e.RollbackErrors))
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	for _, err := range e.RollbackErrors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Job groups a set of related work units and tracks their aggregate progress.
+//
+// In all-or-nothing mode, the first failure cancels the rest of the job members, and once
+// they have all been finished, the outputs of every member will be reverted using their RollbackFunc.
+type Job struct {
+	engine       *Engine
+	allOrNothing bool
+	members      map[string]*jobMember
+	stats        JobStats
+	report       *JobError
+	aborted      bool
+	sealed       bool
+	concluded    bool
+	done         chan None
+
+	mux sync.Mutex
+}
+
+type jobMember struct {
+	unit     *WorkUnit
+	rollback RollbackFunc
+	finished bool
+}
+
+// NewJob creates a new job for the work units which will be processed by the engine.
+//
+// If allOrNothing is true, the failure of a single work unit fails the whole job.
+func (e *Engine) NewJob(allOrNothing bool) *Job {
+	return &Job{
+		engine:       e,
+		allOrNothing: allOrNothing,
+		members:      make(map[string]*jobMember),
+		report: &JobError{
+			Errors:         make(map[string]error),
+			RollbackErrors: make(map[string]error),
+		},
+		done: make(chan None),
+	}
+}
+
+// Add adds a work unit to the job. The unit must be added before it's been pushed into the engine.
+//
+// The rollback function (if not nil) will be called in all-or-nothing mode to revert the outputs
+// of the unit, if any of the job members fails. It will be called after the unit's own callback.
+//
+// Adding a work unit to a sealed job will return an error of type obfuscate.ErrOperationInProgress,
+// and adding it to an all-or-nothing job which has already failed will return obfuscate.ErrCancelled.
+func (j *Job) Add(w *WorkUnit, rollback RollbackFunc) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if j.sealed {
+		return ErrOperationInProgress
+	}
+
+	if j.aborted {
+		return ErrCancelled
+	}
+
+	j.members[w.ID] = &jobMember{
+		unit:     w,
+		rollback: rollback,
+	}
+	j.stats.Total++
+	j.stats.Pending++
+
+	callback := w.callback
+	w.callback = func(w *WorkUnit) {
+		if callback != nil {
+			callback(w)
+		}
+		j.finish(w)
+	}
+	return nil
+}
+
+// Seal marks the job as complete, meaning that no more work units will be added to it.
+// Wait only returns once the job has been sealed and all its members have been finished.
+func (j *Job) Seal() {
+	j.mux.Lock()
+	if j.sealed {
+		j.mux.Unlock()
+		return
+	}
+	j.sealed = true
+	rollbacks, ok := j.conclude()
+	j.mux.Unlock()
+
+	if ok {
+		j.close(rollbacks)
+	}
+}
+
+// Stats returns the aggregate progress of the job
+func (j *Job) Stats() JobStats {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.stats
+}
+
+// Wait blocks until all the members of the sealed job have been finished or the context is done.
+//
+// It returns nil if all the work units have been processed successfully, otherwise
+// a *JobError with the details of the unsuccessful units.
+func (j *Job) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-j.done:
+	}
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	if len(j.report.Errors) == 0 && len(j.report.RollbackErrors) == 0 {
+		return nil
+	}
+	return j.report
+}
+
+func (j *Job) finish(w *WorkUnit) {
+	j.mux.Lock()
+	m, ok := j.members[w.ID]
+	if !ok || m.finished {
+		j.mux.Unlock()
+		return
+	}
+	m.finished = true
+	j.stats.Pending--
+	j.stats.Bytes += w.Bytes
+
+	switch w.Task.Status() {
+	case Completed:
+		j.stats.Completed++
+	case Cancelled:
+		j.stats.Cancelled++
+		j.report.Errors[w.ID] = ErrCancelled
+	default:
+		j.stats.Failed++
+		err := w.Error
+		if err == nil {
+			err = fmt.Errorf("the work unit has failed")
+		}
+		j.report.Errors[w.ID] = err
+	}
+
+	if j.allOrNothing && !j.aborted && w.Task.Status() != Completed {
+		j.aborted = true
+		j.abort()
+	}
+
+	rollbacks, ok := j.conclude()
+	j.mux.Unlock()
+
+	if ok {
+		j.close(rollbacks)
+	}
+}
+
+// abort cancels the unfinished members of the job.
+// The members which have not been received by the engine yet will be cancelled once they get dequeued.
+func (j *Job) abort() {
+	for id, m := range j.members {
+		if m.finished {
+			continue
+		}
+		m.unit.cancel()
+		go func(id string) {
+			// The unit has not been queued yet, or it has just been finished
+			if err := j.engine.Cancel(id); err != nil && !errors.Is(err, ErrUnitNotFound) {
+				j.engine.logger.Warn("failed to cancel the job member", slog.String(LogKeyUnit, id), slog.Any(LogKeyError, err))
+			}
+		}(id)
+	}
+}
+
+// conclude returns true if the job has been sealed and all the members have been finished, along with
+// the members whose outputs must be reverted. It must be called while holding the lock.
+func (j *Job) conclude() ([]*jobMember, bool) {
+	if !j.sealed || j.stats.Pending > 0 || j.concluded {
+		return nil, false
+	}
+	j.concluded = true
+
+	if !j.aborted {
+		return nil, true
+	}
+	rollbacks := make([]*jobMember, 0, len(j.members))
+	for _, m := range j.members {
+		if m.rollback != nil {
+			rollbacks = append(rollbacks, m)
+		}
+	}
+	return rollbacks, true
+}
+
+// close reverts the outputs of the aborted job and releases the waiters.
+// The rollbacks are called without holding the lock, so that they can safely query the job.
+func (j *Job) close(rollbacks []*jobMember) {
+	errs := make(map[string]error)
+	for _, m := range rollbacks {
+		if err := m.rollback(m.unit); err != nil {
+			errs[m.unit.ID] = err
+		}
+	}
+
+	j.mux.Lock()
+	for id, err := range errs {
+		j.report.RollbackErrors[id] = err
+	}
+	j.report.RolledBack = j.aborted
+	j.mux.Unlock()
+
+	close(j.done)
+}
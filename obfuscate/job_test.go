@@ -0,0 +1,214 @@
+package obfuscate
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestJob(t *testing.T) {
+	valid, _ := KeyFromPassword("password")
+
+	testCases := []struct {
+		title             string
+		allOrNothing      bool
+		masters           []*MasterKey
+		expectedCompleted int
+		expectedFailed    int
+		expectedRollbacks int32
+		expectedBytes     int64
+		expectError       bool
+	}{
+		{
+			title:             "successful_job",
+			masters:           []*MasterKey{valid, valid, valid},
+			expectedCompleted: 3,
+			expectedBytes:     300,
+		},
+		{
+			title:             "partially_failed_job",
+			masters:           []*MasterKey{valid, nil, valid},
+			expectedCompleted: 2,
+			expectedFailed:    1,
+			expectedBytes:     200,
+			expectError:       true,
+		},
+		{
+			title:             "successful_all_or_nothing_job",
+			allOrNothing:      true,
+			masters:           []*MasterKey{valid, valid},
+			expectedCompleted: 2,
+			expectedBytes:     200,
+		},
+		{
+			title:             "failed_all_or_nothing_job",
+			allOrNothing:      true,
+			masters:           []*MasterKey{nil},
+			expectedFailed:    1,
+			expectedRollbacks: 1,
+			expectError:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			tap := newMockedTap()
+			engine := newTestEngine(t, tap, WithQueueSize(1))
+			engine.Start()
+			defer engine.Stop()
+
+			job := engine.NewJob(tc.allOrNothing)
+			var rollbacks int32
+			rollback := func(*WorkUnit) error {
+				// The rollbacks must be able to query the job
+				job.Stats()
+				atomic.AddInt32(&rollbacks, 1)
+				return nil
+			}
+
+			var units []*WorkUnit
+			for _, master := range tc.masters {
+				task := NewTask(Encode, filebuffer.New(make([]byte, 100)), filebuffer.New(nil))
+				w := NewWorkUnit(task, master, nil)
+				if err := job.Add(w, rollback); err != nil {
+					t.Fatalf("failed to add the work unit: %v", err)
+				}
+				units = append(units, w)
+			}
+			job.Seal()
+
+			for _, w := range units {
+				tap.Push(w)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := job.Wait(ctx)
+
+			if tc.expectError {
+				var report *JobError
+				if !errors.As(err, &report) {
+					t.Fatalf("expected a job error, but received '%v'", err)
+				}
+				if report.RolledBack != tc.allOrNothing {
+					t.Errorf("expected rolled back %v, actual %v", tc.allOrNothing, report.RolledBack)
+				}
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("expected '%v' to be reported, but received '%v'", ErrInvalidKey, err)
+				}
+			} else if err != nil {
+				t.Errorf("expected no error, but received '%v'", err)
+			}
+
+			stats := job.Stats()
+			if stats.Total != len(tc.masters) {
+				t.Errorf("expected %d work units, actual %d", len(tc.masters), stats.Total)
+			}
+			if stats.Pending != 0 {
+				t.Errorf("expected no pending work units, actual %d", stats.Pending)
+			}
+			if stats.Completed != tc.expectedCompleted {
+				t.Errorf("expected %d completed work units, actual %d", tc.expectedCompleted, stats.Completed)
+			}
+			if stats.Failed != tc.expectedFailed {
+				t.Errorf("expected %d failed work units, actual %d", tc.expectedFailed, stats.Failed)
+			}
+			if stats.Bytes != tc.expectedBytes {
+				t.Errorf("expected %d processed bytes, actual %d", tc.expectedBytes, stats.Bytes)
+			}
+			if actual := atomic.LoadInt32(&rollbacks); actual != tc.expectedRollbacks {
+				t.Errorf("expected %d rollbacks, actual %d", tc.expectedRollbacks, actual)
+			}
+		})
+	}
+}
+
+func TestJobAddAfterSeal(t *testing.T) {
+	engine := newTestEngine(t, newMockedTap(), WithQueueSize(1))
+	job := engine.NewJob(false)
+	job.Seal()
+
+	task := NewTask(Encode, filebuffer.New(nil), filebuffer.New(nil))
+	err := job.Add(NewWorkUnit(task, nil, nil), nil)
+	if err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+}
+
+func TestJobAddAfterFailure(t *testing.T) {
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.Start()
+	defer engine.Stop()
+
+	job := engine.NewJob(true)
+	task := NewTask(Encode, filebuffer.New(nil), filebuffer.New(nil))
+	w := NewWorkUnit(task, nil, nil)
+	if err := job.Add(w, nil); err != nil {
+		t.Fatalf("failed to add the work unit: %v", err)
+	}
+	tap.Push(w)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Stats().Failed == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	task = NewTask(Encode, filebuffer.New(nil), filebuffer.New(nil))
+	if err := job.Add(NewWorkUnit(task, nil, nil), nil); err != ErrCancelled {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrCancelled, err)
+	}
+}
+
+func TestJobAbortBeforeDispatch(t *testing.T) {
+	valid, _ := KeyFromPassword("password")
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.Start()
+	defer engine.Stop()
+
+	job := engine.NewJob(true)
+	failing := NewWorkUnit(NewTask(Encode, filebuffer.New(nil), filebuffer.New(nil)), nil, nil)
+	late := NewWorkUnit(NewTask(Encode, filebuffer.New([]byte("content")), filebuffer.New(nil)), valid, nil)
+	for _, w := range []*WorkUnit{failing, late} {
+		if err := job.Add(w, nil); err != nil {
+			t.Fatalf("failed to add the work unit: %v", err)
+		}
+	}
+	job.Seal()
+
+	// The job gets aborted before the second member reaches the engine
+	tap.Push(failing)
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Stats().Failed == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	tap.Push(late)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := job.Wait(ctx); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the job to fail, but received '%v'", err)
+	}
+	if status := late.Task.Status(); status != Cancelled {
+		t.Errorf("expected the member dispatched after the abort to be '%s', actual '%s'", Cancelled, status)
+	}
+	if stats := job.Stats(); stats.Failed != 1 || stats.Cancelled != 1 || stats.Completed != 0 {
+		t.Errorf("expected 1 failed and 1 cancelled member, actual %+v", stats)
+	}
+}
+
+func TestJobWaitTimeout(t *testing.T) {
+	engine := newTestEngine(t, newMockedTap(), WithQueueSize(1))
+	job := engine.NewJob(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := job.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected '%v' as error, but received '%v'", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,183 @@
+package obfuscate
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JournalEvent represents a life cycle event of a work unit which gets recorded in a Journal
+type JournalEvent int8
+
+const (
+	// JournalEnqueued indicates that the work unit has been received by the engine
+	JournalEnqueued JournalEvent = iota
+	// JournalStarted indicates that the engine has started processing the work unit
+	JournalStarted
+	// JournalFinished indicates that the processing of the work unit has been finished
+	JournalFinished
+)
+
+// String returns the string representation of the journal event
+func (e JournalEvent) String() string {
+	switch e {
+	case JournalEnqueued:
+		return "enqueued"
+	case JournalStarted:
+		return "started"
+	case JournalFinished:
+		return "finished"
+	}
+	return "unknown"
+}
+
+// JournalEntry is a single record of a Journal.
+//
+// The entry holds enough information about the work unit for a RecoverableTap
+// to rebuild it after the engine has been restarted.
+type JournalEntry struct {
+	// ID the identifier of the work unit
+	ID string `json:"id"`
+	// Tap the name of the tap which has dispatched the work unit
+	Tap string `json:"tap,omitempty"`
+	// Event the life cycle event of the work unit
+	Event JournalEvent `json:"event"`
+	// Mode the operation of the work unit's task
+	Mode Operation `json:"mode"`
+	// Status the final status of the task. It's only meaningful for JournalFinished entries
+	Status Status `json:"status"`
+	// Metadata the custom data of the work unit.
+	// Only the values which can be marshalled into JSON will survive a restart.
+	Metadata MetadataMap `json:"metadata,omitempty"`
+	// Time the time at which the event has happened
+	Time time.Time `json:"time"`
+}
+
+// Journal is the interface for the types responsible to durably record the life cycle of work units.
+//
+// Attaching a journal to an Engine gives the engine at-least-once processing semantics.
+// The units which have been enqueued but never finished will get re-dispatched once the engine starts again.
+type Journal interface {
+	// Record durably appends a new entry to the journal.
+	Record(entry JournalEntry) error
+	// Pending returns the latest entries of the work units which have not been finished yet,
+	// in the order they have been enqueued.
+	Pending() ([]JournalEntry, error)
+	// Close releases the resources held by the journal
+	Close() error
+}
+
+// FileJournal is an append-only, file based implementation of the Journal interface.
+//
+// Every entry is written to the file as a single line of JSON and gets flushed to the
+// disk before Record returns (See RecordLog).
+type FileJournal struct {
+	log     *RecordLog
+	pending map[string]JournalEntry
+	// the enqueue sequence of the pending work units
+	order map[string]uint64
+	seq   uint64
+
+	mux sync.Mutex
+}
+
+// OpenFileJournal opens the journal file at the specified path or creates a new one if it does not exist.
+//
+// Opening an existing journal compacts the file, so that only the pending entries will be kept.
+// A partially written entry at the end of the file (as a result of a crash) will be ignored.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &FileJournal{
+		pending: make(map[string]JournalEntry),
+		order:   make(map[string]uint64),
+	}
+
+	j.log, err = OpenRecordLog(abs, j.replay, j.snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Record durably appends a new entry to the journal file.
+func (j *FileJournal) Record(entry JournalEntry) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	if err := j.log.Append(entry); err != nil {
+		return err
+	}
+
+	j.apply(entry)
+	return nil
+}
+
+// Pending returns the latest entries of the work units which have not been finished yet,
+// in the order they have been enqueued.
+func (j *FileJournal) Pending() ([]JournalEntry, error) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.pendingEntries(), nil
+}
+
+func (j *FileJournal) pendingEntries() []JournalEntry {
+	entries := make([]JournalEntry, 0, len(j.pending))
+	for _, entry := range j.pending {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return j.order[entries[a].ID] < j.order[entries[b].ID]
+	})
+	return entries
+}
+
+// Close closes the underlying journal file
+func (j *FileJournal) Close() error {
+	return j.log.Close()
+}
+
+func (j *FileJournal) apply(entry JournalEntry) {
+	if entry.Event == JournalFinished {
+		delete(j.pending, entry.ID)
+		delete(j.order, entry.ID)
+		return
+	}
+
+	if _, ok := j.order[entry.ID]; !ok {
+		j.seq++
+		j.order[entry.ID] = j.seq
+	}
+	j.pending[entry.ID] = entry
+}
+
+func (j *FileJournal) replay(record []byte) error {
+	var entry JournalEntry
+	if err := json.Unmarshal(record, &entry); err != nil {
+		return err
+	}
+	j.apply(entry)
+	return nil
+}
+
+// snapshot returns the pending entries which will be kept once the journal has been compacted.
+// It is called while the journal is locked (See Record).
+func (j *FileJournal) snapshot() []interface{} {
+	entries := j.pendingEntries()
+	records := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		records[i] = entry
+	}
+	return records
+}
@@ -0,0 +1,192 @@
+package obfuscate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestFileJournalPending(t *testing.T) {
+	testCases := []struct {
+		title           string
+		entries         []JournalEntry
+		expectedPending []string
+	}{
+		{
+			title:           "empty_journal_has_no_pending_entries",
+			expectedPending: []string{},
+		},
+		{
+			title: "enqueued_entries_are_pending",
+			entries: []JournalEntry{
+				{ID: "a", Event: JournalEnqueued},
+				{ID: "b", Event: JournalEnqueued},
+			},
+			expectedPending: []string{"a", "b"},
+		},
+		{
+			title: "started_entries_are_pending_in_enqueue_order",
+			entries: []JournalEntry{
+				{ID: "a", Event: JournalEnqueued},
+				{ID: "b", Event: JournalEnqueued},
+				{ID: "b", Event: JournalStarted},
+				{ID: "a", Event: JournalStarted},
+			},
+			expectedPending: []string{"a", "b"},
+		},
+		{
+			title: "finished_entries_are_not_pending",
+			entries: []JournalEntry{
+				{ID: "a", Event: JournalEnqueued},
+				{ID: "b", Event: JournalEnqueued},
+				{ID: "a", Event: JournalStarted},
+				{ID: "a", Event: JournalFinished, Status: Completed},
+			},
+			expectedPending: []string{"b"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal")
+			journal, err := OpenFileJournal(path)
+			if err != nil {
+				t.Fatalf("failed to open the journal: %v", err)
+			}
+			for _, entry := range tc.entries {
+				if err := journal.Record(entry); err != nil {
+					t.Fatalf("failed to record the entry: %v", err)
+				}
+			}
+			journal.Close()
+
+			// The pending entries must survive re-opening the journal
+			journal, err = OpenFileJournal(path)
+			if err != nil {
+				t.Fatalf("failed to re-open the journal: %v", err)
+			}
+			defer journal.Close()
+
+			pending, _ := journal.Pending()
+			if len(pending) != len(tc.expectedPending) {
+				t.Fatalf("expected %d pending entries, actual %d", len(tc.expectedPending), len(pending))
+			}
+			for i, id := range tc.expectedPending {
+				if pending[i].ID != id {
+					t.Errorf("expected '%s' at index %d, actual '%s'", id, i, pending[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestFileJournalIgnoresPartiallyWrittenEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	journal, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("failed to open the journal: %v", err)
+	}
+	journal.Record(JournalEntry{ID: "a", Event: JournalEnqueued, Metadata: MetadataMap{"input": "file"}})
+	journal.Close()
+
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString(`{"id":"b","eve`)
+	file.Close()
+
+	journal, err = OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("failed to re-open the journal: %v", err)
+	}
+	defer journal.Close()
+
+	pending, _ := journal.Pending()
+	if len(pending) != 1 || pending[0].ID != "a" {
+		t.Fatalf("expected 'a' to be the only pending entry, actual %+v", pending)
+	}
+
+	if pending[0].Metadata["input"] != "file" {
+		t.Errorf("expected the metadata to survive the restart, actual %+v", pending[0].Metadata)
+	}
+}
+
+func TestEngineRecovery(t *testing.T) {
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatalf("failed to open the journal: %v", err)
+	}
+	defer journal.Close()
+
+	journal.Record(JournalEntry{ID: "recoverable", Event: JournalStarted, Mode: Encode})
+	journal.Record(JournalEntry{ID: "unrecoverable", Event: JournalEnqueued, Mode: Encode})
+
+	master, _ := KeyFromPassword("password")
+	var processed []string
+	cb := func(w *WorkUnit) {
+		processed = append(processed, w.ID)
+	}
+
+	tap := newMockedRecoverableTap(func(entry JournalEntry) (*WorkUnit, error) {
+		if entry.ID == "unrecoverable" {
+			return nil, errors.New("gone")
+		}
+		task := NewTask(entry.Mode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+		return NewWorkUnit(task, master, cb), nil
+	})
+
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	if err := engine.SetJournal(journal); err != nil {
+		t.Fatalf("failed to attach the journal: %v", err)
+	}
+	engine.Start()
+
+	if err := engine.SetJournal(journal); err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	engine.Stop()
+
+	if len(tap.recovered) != 2 {
+		t.Errorf("expected 2 entries to be recovered, actual %d", len(tap.recovered))
+	}
+
+	if len(processed) != 1 || processed[0] != "recoverable" {
+		t.Errorf("expected the recovered unit to be processed with its original ID, actual %v", processed)
+	}
+
+	pending, _ := journal.Pending()
+	if len(pending) != 0 {
+		t.Errorf("expected no pending entries, actual %+v", pending)
+	}
+}
+
+func TestEngineJournalsNewWorkUnits(t *testing.T) {
+	journal, err := OpenFileJournal(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatalf("failed to open the journal: %v", err)
+	}
+	defer journal.Close()
+
+	master, _ := KeyFromPassword("password")
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.SetJournal(journal)
+	engine.Start()
+
+	done := make(chan None)
+	task := NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+	tap.Push(NewWorkUnit(task, master, func(*WorkUnit) {
+		close(done)
+	}))
+	<-done
+	engine.Stop()
+
+	pending, _ := journal.Pending()
+	if len(pending) != 0 {
+		t.Errorf("expected no pending entries, actual %+v", pending)
+	}
+}
@@ -0,0 +1,113 @@
+package obfuscate
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+// The keys of the structured log attributes emitted by the engine and the taps
+const (
+	// LogKeyUnit the ID of the work unit
+	LogKeyUnit = "unit_id"
+	// LogKeyTap the name of the tap which has dispatched the work unit
+	LogKeyTap = "tap"
+	// LogKeyMode the operation of the work unit's task
+	LogKeyMode = "mode"
+	// LogKeyInput the path to the input file
+	LogKeyInput = "input"
+	// LogKeyOutput the path to the output file
+	LogKeyOutput = "output"
+	// LogKeyBytes the number of the processed input bytes
+	LogKeyBytes = "bytes"
+	// LogKeyDuration the processing time
+	LogKeyDuration = "duration"
+	// LogKeyStatus the status of the task
+	LogKeyStatus = "status"
+	// LogKeyError the error message
+	LogKeyError = "error"
+	// LogKeyErrorClass the class of the error (See ErrorClass)
+	LogKeyErrorClass = "error_class"
+)
+
+// The metadata keys under which the taps store the paths of the work units' files.
+// The engine adds them to the log records of the work units.
+const (
+	// InputPathMetadataKey the full path to the input file
+	InputPathMetadataKey = "input_full_path"
+	// OutputPathMetadataKey the full path to the output file
+	OutputPathMetadataKey = "output_full_path"
+)
+
+// discardLogger is the default logger which does not log anything
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// ErrorClass returns a short, stable name for the category of the error which can be used to query the logs.
+func ErrorClass(err error) string {
+	var (
+		ioErr   *IOError
+		pathErr *fs.PathError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrWrongKey), errors.Is(err, ErrInvalidKey):
+		return "key"
+	case errors.Is(err, ErrTruncated):
+		return "truncated"
+	case errors.Is(err, ErrCorrupted):
+		return "corrupted"
+	case errors.Is(err, ErrUnsupportedVersion):
+		return "version"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, ErrCancelled), errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.As(err, &ioErr), errors.As(err, &pathErr):
+		return "io"
+	}
+	return "other"
+}
+
+// unitAttrs returns the log attributes which identify the work unit
+func unitAttrs(w *WorkUnit) []any {
+	attrs := []any{
+		slog.String(LogKeyUnit, w.ID),
+		slog.String(LogKeyTap, w.Tap),
+	}
+	if w.Task != nil {
+		attrs = append(attrs, slog.String(LogKeyMode, w.Task.mode.String()))
+	}
+	if input, ok := w.Metadata[InputPathMetadataKey].(string); ok {
+		attrs = append(attrs, slog.String(LogKeyInput, input))
+	}
+	if output, ok := w.Metadata[OutputPathMetadataKey].(string); ok {
+		attrs = append(attrs, slog.String(LogKeyOutput, output))
+	}
+	return attrs
+}
+
+// logResult logs the outcome of processing the work unit
+func logResult(logger *slog.Logger, w *WorkUnit, duration time.Duration) {
+	status := w.Task.Status()
+	attrs := append(unitAttrs(w),
+		slog.String(LogKeyStatus, status.String()),
+		slog.Int64(LogKeyBytes, w.Bytes),
+		slog.Duration(LogKeyDuration, duration),
+	)
+
+	switch status {
+	case Completed:
+		logger.Info("work unit completed", attrs...)
+	case Cancelled:
+		logger.Warn("work unit cancelled", attrs...)
+	default:
+		attrs = append(attrs,
+			slog.Any(LogKeyError, w.Error),
+			slog.String(LogKeyErrorClass, ErrorClass(w.Error)),
+		)
+		logger.Error("work unit failed", attrs...)
+	}
+}
@@ -0,0 +1,125 @@
+package obfuscate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestErrorClass(t *testing.T) {
+	testCases := []struct {
+		title    string
+		err      error
+		expected string
+	}{
+		{
+			title:    "no_error",
+			expected: "",
+		},
+		{
+			title:    "invalid_signature",
+			err:      ErrWrongKey,
+			expected: "key",
+		},
+		{
+			title:    "invalid_key",
+			err:      ErrInvalidKey,
+			expected: "key",
+		},
+		{
+			title:    "truncated_stream",
+			err:      ErrTruncated,
+			expected: "truncated",
+		},
+		{
+			title:    "wrapped_deadline",
+			err:      fmt.Errorf("processing: %w", context.DeadlineExceeded),
+			expected: "timeout",
+		},
+		{
+			title:    "cancellation",
+			err:      ErrCancelled,
+			expected: "cancelled",
+		},
+		{
+			title:    "path_error",
+			err:      &os.PathError{Op: "open", Path: "file", Err: os.ErrNotExist},
+			expected: "io",
+		},
+		{
+			title:    "unknown_error",
+			err:      fmt.Errorf("unknown"),
+			expected: "other",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			if actual := ErrorClass(tc.err); actual != tc.expected {
+				t.Errorf("expected '%s', actual '%s'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestEngineLogger(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buffer, nil))
+
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	if err := engine.SetLogger(logger); err != nil {
+		t.Fatalf("failed to set the logger: %v", err)
+	}
+	engine.Start()
+
+	done := make(chan None)
+	task := NewTask(Encode, filebuffer.New([]byte("input")), filebuffer.New(nil))
+	w := NewWorkUnit(task, nil, func(*WorkUnit) {
+		close(done)
+	})
+	w.Metadata[InputPathMetadataKey] = "/input"
+	tap.Push(w)
+	<-done
+
+	if err := engine.SetLogger(logger); err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+	engine.Stop()
+
+	var failure map[string]interface{}
+	decoder := json.NewDecoder(buffer)
+	for decoder.More() {
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("failed to decode the log record: %v", err)
+		}
+		if record["msg"] == "work unit failed" {
+			failure = record
+		}
+	}
+	if failure == nil {
+		t.Fatal("expected the failure to be logged")
+	}
+
+	expected := map[string]interface{}{
+		LogKeyUnit:       w.ID,
+		LogKeyTap:        DefaultTapName,
+		LogKeyMode:       "encode",
+		LogKeyInput:      "/input",
+		LogKeyStatus:     "failed",
+		LogKeyError:      ErrInvalidKey.Error(),
+		LogKeyErrorClass: "key",
+	}
+	for key, value := range expected {
+		if failure[key] != value {
+			t.Errorf("expected '%v' as %s, actual '%v'", value, key, failure[key])
+		}
+	}
+}
@@ -50,11 +50,11 @@ func (k *MasterKey) Validate(pass string) bool {
 // KeyFromPassword creates a cryptography master key based on the provided password
 func KeyFromPassword(pass string) (*MasterKey, error) {
 	if len(strings.TrimSpace(pass)) == 0 {
-		return nil, errEmptyPassword
+		return nil, ErrEmptyPassword
 	}
 
 	if utf8.RuneCount([]byte(pass)) < 8 {
-		return nil, errInvalidPassword
+		return nil, ErrInvalidPassword
 	}
 
 	b := promotePassword(pass)
@@ -93,6 +93,17 @@ func KeyFromPassword(pass string) (*MasterKey, error) {
 	}, nil
 }
 
+// DeriveKey derives a 32 bytes sub-key from the master key for the specified purpose.
+//
+// The derived keys of different purposes are independent of each other, and
+// the master key cannot be calculated from them.
+func (k *MasterKey) DeriveKey(purpose string) ([]byte, error) {
+	if !k.isValid() {
+		return nil, ErrInvalidKey
+	}
+	return hash.HMAC256(k.key, []byte(purpose))
+}
+
 func (k *MasterKey) isValid() bool {
 	return k != nil &&
 		len(k.key) == keyLength &&
@@ -13,17 +13,17 @@ func TestMasterFromPassword(t *testing.T) {
 		{
 			title:         "empty_password_is_not_valid",
 			password:      "",
-			expectedError: errEmptyPassword,
+			expectedError: ErrEmptyPassword,
 		},
 		{
 			title:         "whitespace_password_is_not_valid",
 			password:      "    ",
-			expectedError: errEmptyPassword,
+			expectedError: ErrEmptyPassword,
 		},
 		{
 			title:         "passwords_shorter_than_eight_characters_are_not_valid",
 			password:      "1234567",
-			expectedError: errInvalidPassword,
+			expectedError: ErrInvalidPassword,
 		},
 		{
 			title:    "passwords_with_at_least_eight_characters_are_valid",
@@ -51,3 +51,62 @@ func TestMasterFromPassword(t *testing.T) {
 	}
 
 }
+
+func TestDeriveKey(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	another, _ := KeyFromPassword("another password")
+
+	dedup, err := master.DeriveKey("dedup")
+	if err != nil {
+		t.Fatalf("failed to derive the key: %v", err)
+	}
+	if len(dedup) != keyLength {
+		t.Errorf("expected %d bytes key, actual %d", keyLength, len(dedup))
+	}
+
+	testCases := []struct {
+		title         string
+		master        *MasterKey
+		purpose       string
+		expectedEqual bool
+		expectedError error
+	}{
+		{
+			title:         "same_key_and_purpose",
+			master:        master,
+			purpose:       "dedup",
+			expectedEqual: true,
+		},
+		{
+			title:   "same_key_with_another_purpose",
+			master:  master,
+			purpose: "names",
+		},
+		{
+			title:   "another_key_with_the_same_purpose",
+			master:  another,
+			purpose: "dedup",
+		},
+		{
+			title:         "invalid_key",
+			master:        &MasterKey{},
+			purpose:       "dedup",
+			expectedError: ErrInvalidKey,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			key, err := tc.master.DeriveKey(tc.purpose)
+			if err != tc.expectedError {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if equal := string(key) == string(dedup); equal != tc.expectedEqual {
+				t.Errorf("expected equal keys %v, actual %v", tc.expectedEqual, equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package obfuscate
+
+import "time"
+
+// Metrics is the interface for the types which collect the measurements of the engine (i.e. a Prometheus adapter).
+//
+// The methods are called synchronously by the workers, so the implementations must be safe for concurrent use
+// and return quickly.
+type Metrics interface {
+	// ObserveUnit is called once the processing of a work unit has been finished with the number of the processed
+	// input bytes and the processing time. The work unit carries the tap (WorkUnit.Tap), the operation
+	// (Task.Mode) and the final status (Task.Status) of the task.
+	ObserveUnit(w *WorkUnit, bytes int64, duration time.Duration)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveUnit(*WorkUnit, int64, time.Duration) {}
@@ -0,0 +1,47 @@
+package obfuscate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+type mockedMetrics struct {
+	units chan observedUnit
+}
+
+type observedUnit struct {
+	status Status
+	mode   Operation
+	bytes  int64
+}
+
+func (m *mockedMetrics) ObserveUnit(w *WorkUnit, bytes int64, duration time.Duration) {
+	m.units <- observedUnit{status: w.Task.Status(), mode: w.Task.Mode(), bytes: bytes}
+}
+
+func TestMetrics(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	metrics := &mockedMetrics{units: make(chan observedUnit, 1)}
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1), WithMetrics(metrics))
+	engine.Start()
+	defer engine.Stop()
+
+	if err := engine.SetMetrics(nil); err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+
+	task := NewTask(Encode, filebuffer.New(make([]byte, 100)), filebuffer.New(nil))
+	tap.Push(NewWorkUnit(task, master, nil))
+
+	select {
+	case unit := <-metrics.units:
+		if unit.status != Completed || unit.mode != Encode || unit.bytes != 100 {
+			t.Errorf("expected a completed encoding of 100 bytes, actual %+v", unit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the work unit has not been observed")
+	}
+}
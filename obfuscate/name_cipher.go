@@ -0,0 +1,232 @@
+package obfuscate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/xitonix/xvault/b64"
+)
+
+const (
+	// nameMacKeyPurpose is the purpose of the key derived from the master key to calculate the synthetic IVs
+	nameMacKeyPurpose = "xvault/names/s2v"
+	// nameCtrKeyPurpose is the purpose of the key derived from the master key to encrypt the names
+	nameCtrKeyPurpose = "xvault/names/ctr"
+	// maxNameLength is the maximum length of a file name on the most filesystems
+	maxNameLength = 255
+)
+
+// NameCipher deterministically encrypts the names of files and directories, so that the same name
+// always gets encrypted into the same value using the same master key.
+//
+// The names are encrypted using AES-SIV (RFC 5297) and encoded using the un-padded URL safe base64 encoding.
+// Every encrypted name is authenticated, so a name which has been tampered with, or encrypted using
+// another key cannot be decrypted.
+//
+// NOTE: The encrypted names are case sensitive. Two names which only differ in case might collide on
+// the case insensitive filesystems (i.e. the default filesystems of Windows and macOS).
+type NameCipher struct {
+	// the cipher of the S2V (CMAC) key
+	mac cipher.Block
+	// the cipher of the CTR key
+	ctr cipher.Block
+	// the CMAC sub-keys
+	k1, k2   []byte
+	encoding b64.Base64Encoding
+}
+
+// NewNameCipher creates a new name cipher using the keys derived from the master key
+func NewNameCipher(master *MasterKey) (*NameCipher, error) {
+	macKey, err := master.DeriveKey(nameMacKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	ctrKey, err := master.DeriveKey(nameCtrKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return newNameCipher(macKey, ctrKey)
+}
+
+func newNameCipher(macKey, ctrKey []byte) (*NameCipher, error) {
+	mac, err := aes.NewCipher(macKey)
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(ctrKey)
+	if err != nil {
+		return nil, err
+	}
+	l := make([]byte, aes.BlockSize)
+	mac.Encrypt(l, l)
+	k1 := dbl(l)
+	return &NameCipher{
+		mac:      mac,
+		ctr:      ctr,
+		k1:       k1,
+		k2:       dbl(k1),
+		encoding: b64.NewRawURLEncoding(),
+	}, nil
+}
+
+// EncryptName encrypts a single file or directory name.
+// It returns ErrNameTooLong if the encrypted name would be longer than 255 bytes.
+func (c *NameCipher) EncryptName(name string) (string, error) {
+	encrypted := string(c.encoding.Encode(c.seal([]byte(name))))
+	if len(encrypted) > maxNameLength {
+		return "", fmt.Errorf("%w: '%s'", ErrNameTooLong, name)
+	}
+	return encrypted, nil
+}
+
+// DecryptName decrypts a single file or directory name which has been encrypted by EncryptName.
+//
+// It returns ErrTruncated if the name is too short, and ErrCorrupted if the name has been damaged
+// or encrypted using another key.
+func (c *NameCipher) DecryptName(name string) (string, error) {
+	sealed, err := c.encoding.Decode([]byte(name))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrCorrupted, err)
+	}
+	plain, err := c.open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// EncryptPath encrypts every component of a relative path (i.e. "dir/sub/file.txt").
+func (c *NameCipher) EncryptPath(path string) (string, error) {
+	return c.mapPath(path, c.EncryptName)
+}
+
+// DecryptPath decrypts every component of a relative path which has been encrypted by EncryptPath.
+func (c *NameCipher) DecryptPath(path string) (string, error) {
+	return c.mapPath(path, c.DecryptName)
+}
+
+func (c *NameCipher) mapPath(path string, mapName func(string) (string, error)) (string, error) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		mapped, err := mapName(part)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = mapped
+	}
+	return filepath.FromSlash(strings.Join(parts, "/")), nil
+}
+
+// seal encrypts the plain text and prepends the synthetic IV (RFC 5297 section 2.6)
+func (c *NameCipher) seal(plain []byte, ad ...[]byte) []byte {
+	v := c.s2v(append(ad, plain))
+	sealed := make([]byte, aes.BlockSize+len(plain))
+	copy(sealed, v)
+	c.xorKeyStream(sealed[aes.BlockSize:], plain, v)
+	return sealed
+}
+
+// open decrypts and authenticates the sealed text (RFC 5297 section 2.7)
+func (c *NameCipher) open(sealed []byte, ad ...[]byte) ([]byte, error) {
+	if len(sealed) < aes.BlockSize {
+		return nil, ErrTruncated
+	}
+	v := sealed[:aes.BlockSize]
+	plain := make([]byte, len(sealed)-aes.BlockSize)
+	c.xorKeyStream(plain, sealed[aes.BlockSize:], v)
+	if subtle.ConstantTimeCompare(c.s2v(append(ad, plain)), v) != 1 {
+		return nil, ErrCorrupted
+	}
+	return plain, nil
+}
+
+func (c *NameCipher) xorKeyStream(dst, src, v []byte) {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, v)
+	// The 31st and 63rd bits are cleared to support the 32 and 64 bits counter implementations
+	iv[8] &= 0x7f
+	iv[12] &= 0x7f
+	cipher.NewCTR(c.ctr, iv).XORKeyStream(dst, src)
+}
+
+// s2v is the String to Vector function of RFC 5297 (section 2.4). The last input is the plain text.
+func (c *NameCipher) s2v(inputs [][]byte) []byte {
+	d := c.cmac(make([]byte, aes.BlockSize))
+	last := len(inputs) - 1
+	for _, input := range inputs[:last] {
+		d = dbl(d)
+		xorBytes(d, c.cmac(input))
+	}
+
+	var t []byte
+	if plain := inputs[last]; len(plain) >= aes.BlockSize {
+		t = append([]byte{}, plain...)
+		xorBytes(t[len(t)-aes.BlockSize:], d)
+	} else {
+		t = pad(plain)
+		xorBytes(t, dbl(d))
+	}
+	return c.cmac(t)
+}
+
+// cmac calculates the AES-CMAC (RFC 4493) of the message
+func (c *NameCipher) cmac(msg []byte) []byte {
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(msg)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	var last []byte
+	if complete {
+		last = append([]byte{}, msg[(n-1)*aes.BlockSize:]...)
+		xorBytes(last, c.k1)
+	} else {
+		last = pad(msg[(n-1)*aes.BlockSize:])
+		xorBytes(last, c.k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xorBytes(x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		c.mac.Encrypt(x, x)
+	}
+	xorBytes(x, last)
+	c.mac.Encrypt(x, x)
+	return x
+}
+
+// dbl multiplies the block by x in GF(2^128)
+func dbl(block []byte) []byte {
+	out := make([]byte, aes.BlockSize)
+	var carry byte
+	for i := aes.BlockSize - 1; i >= 0; i-- {
+		out[i] = block[i]<<1 | carry
+		carry = block[i] >> 7
+	}
+	if carry != 0 {
+		out[aes.BlockSize-1] ^= 0x87
+	}
+	return out
+}
+
+// pad pads the partial block with a single one bit followed by zeros
+func pad(partial []byte) []byte {
+	block := make([]byte, aes.BlockSize)
+	copy(block, partial)
+	block[len(partial)] = 0x80
+	return block
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
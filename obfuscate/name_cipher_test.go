@@ -0,0 +1,218 @@
+package obfuscate
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("invalid hex string: %v", err)
+	}
+	return b
+}
+
+func TestNameCipherVectors(t *testing.T) {
+	// RFC 5297 Appendix A
+	testCases := []struct {
+		title     string
+		key       string
+		ad        []string
+		plain     string
+		encrypted string
+	}{
+		{
+			title: "deterministic_authenticated_encryption",
+			key:   "fffefdfc fbfaf9f8 f7f6f5f4 f3f2f1f0 f0f1f2f3 f4f5f6f7 f8f9fafb fcfdfeff",
+			ad: []string{
+				"10111213 14151617 18191a1b 1c1d1e1f 20212223 24252627",
+			},
+			plain:     "11223344 55667788 99aabbcc ddee",
+			encrypted: "85632d07 c6e8f37f 950acd32 0a2ecc93 40c02b96 90c4dc04 daef7f6a fe5c",
+		},
+		{
+			title: "nonce_based_authenticated_encryption",
+			key:   "7f7e7d7c 7b7a7978 77767574 73727170 40414243 44454647 48494a4b 4c4d4e4f",
+			ad: []string{
+				"00112233 44556677 8899aabb ccddeeff deaddada deaddada ffeeddcc bbaa9988 77665544 33221100",
+				"10203040 50607080 90a0",
+				"09f91102 9d74e35b d84156c5 635688c0",
+			},
+			plain: "74686973 20697320 736f6d65 20706c61 696e7465 78742074 6f20656e 63727970 74207573 696e6720 5349562d 414553",
+			encrypted: "7bdb6e3b 432667eb 06f4d14b ff2fbd0f cb900f2f ddbe4043 26601965 c889bf17 dba77ceb 094fa663 b7a3f748 " +
+				"ba8af829 ea64ad54 4a272e9c 485b62a3 fd5c0d",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			key := decodeHex(t, tc.key)
+			c, err := newNameCipher(key[:len(key)/2], key[len(key)/2:])
+			if err != nil {
+				t.Fatalf("failed to create the cipher: %v", err)
+			}
+			var ad [][]byte
+			for _, a := range tc.ad {
+				ad = append(ad, decodeHex(t, a))
+			}
+			plain, expected := decodeHex(t, tc.plain), decodeHex(t, tc.encrypted)
+
+			actual := c.seal(plain, ad...)
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("expected '%x', but received '%x'", expected, actual)
+			}
+
+			decrypted, err := c.open(actual, ad...)
+			if err != nil {
+				t.Fatalf("expected no error, but received '%v'", err)
+			}
+			if !bytes.Equal(decrypted, plain) {
+				t.Errorf("expected '%x', but received '%x'", plain, decrypted)
+			}
+		})
+	}
+}
+
+func TestNameCipher(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	another, _ := KeyFromPassword("another password")
+	c, err := NewNameCipher(master)
+	if err != nil {
+		t.Fatalf("failed to create the cipher: %v", err)
+	}
+	other, _ := NewNameCipher(another)
+
+	testCases := []struct {
+		title         string
+		name          string
+		decryptor     *NameCipher
+		tamper        func(string) string
+		expectedError error
+	}{
+		{
+			title:     "short_name",
+			name:      "a",
+			decryptor: c,
+		},
+		{
+			title:     "empty_name",
+			name:      "",
+			decryptor: c,
+		},
+		{
+			title:     "block_sized_name",
+			name:      "0123456789abcdef",
+			decryptor: c,
+		},
+		{
+			title:     "unicode_name",
+			name:      "گزارش حقوق ۲۰۲۴.xlsx",
+			decryptor: c,
+		},
+		{
+			title:         "too_long_name",
+			name:          strings.Repeat("a", 200),
+			decryptor:     c,
+			expectedError: ErrNameTooLong,
+		},
+		{
+			title:         "wrong_key",
+			name:          "report.pdf",
+			decryptor:     other,
+			expectedError: ErrCorrupted,
+		},
+		{
+			title:     "tampered_name",
+			name:      "report.pdf",
+			decryptor: c,
+			tamper: func(s string) string {
+				if s[0] == 'A' {
+					return "B" + s[1:]
+				}
+				return "A" + s[1:]
+			},
+			expectedError: ErrCorrupted,
+		},
+		{
+			title:     "truncated_name",
+			name:      "report.pdf",
+			decryptor: c,
+			tamper: func(s string) string {
+				return s[:8]
+			},
+			expectedError: ErrTruncated,
+		},
+		{
+			title:     "invalid_encoding",
+			name:      "report.pdf",
+			decryptor: c,
+			tamper: func(s string) string {
+				return "*" + s[1:]
+			},
+			expectedError: ErrCorrupted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			encrypted, err := c.EncryptName(tc.name)
+			if err != nil {
+				if !errors.Is(err, tc.expectedError) {
+					t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+				}
+				return
+			}
+			if strings.ContainsAny(encrypted, `/\.`) {
+				t.Errorf("the encrypted name '%s' is not a valid file name", encrypted)
+			}
+			again, _ := c.EncryptName(tc.name)
+			if again != encrypted {
+				t.Errorf("expected the same encrypted name '%s', but received '%s'", encrypted, again)
+			}
+			if tc.tamper != nil {
+				encrypted = tc.tamper(encrypted)
+			}
+
+			decrypted, err := tc.decryptor.DecryptName(encrypted)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if err == nil && decrypted != tc.name {
+				t.Errorf("expected '%s', but received '%s'", tc.name, decrypted)
+			}
+		})
+	}
+}
+
+func TestNameCipherPath(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	c, _ := NewNameCipher(master)
+
+	path := filepath.Join("finance", "2024", "report.xlsx")
+	encrypted, err := c.EncryptPath(path)
+	if err != nil {
+		t.Fatalf("expected no error, but received '%v'", err)
+	}
+	parts := strings.Split(encrypted, string(filepath.Separator))
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 path components, but received %d", len(parts))
+	}
+	dir, _ := c.EncryptName("finance")
+	if parts[0] != dir {
+		t.Errorf("expected the directory to be encrypted into '%s', but received '%s'", dir, parts[0])
+	}
+
+	decrypted, err := c.DecryptPath(encrypted)
+	if err != nil {
+		t.Fatalf("expected no error, but received '%v'", err)
+	}
+	if decrypted != path {
+		t.Errorf("expected '%s', but received '%s'", path, decrypted)
+	}
+}
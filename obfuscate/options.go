@@ -0,0 +1,311 @@
+package obfuscate
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// DefaultQueueSize is the default capacity of the engine's work queue
+const DefaultQueueSize = 10
+
+// CodecOption configures an Encoder or a Decoder
+type CodecOption func(*codecOptions) error
+
+type codecOptions struct {
+	bufferSize int
+	outputs    []io.Writer
+}
+
+// WithBufferSize sets the size of the buffer used to read the input in chunks.
+// Zero means the default buffer size (1024 bytes).
+func WithBufferSize(size int) CodecOption {
+	return func(o *codecOptions) error {
+		if size < 0 {
+			return invalidConfig("the buffer size cannot be negative")
+		}
+		if size > 0 {
+			o.bufferSize = size
+		}
+		return nil
+	}
+}
+
+// WithCipher is reserved for the future versions of the format and has no effect. The current version
+// only supports CipherAES256CFB (the default), so any other cipher returns an error of type ErrInvalidConfig.
+func WithCipher(cipher Cipher) CodecOption {
+	return func(o *codecOptions) error {
+		return cipher.validate()
+	}
+}
+
+// WithCompression is reserved for the future versions of the format and has no effect. The current version
+// does not support compression, so anything other than CompressionNone returns an error of type ErrInvalidConfig.
+func WithCompression(compression Compression) CodecOption {
+	return func(o *codecOptions) error {
+		return compression.validate()
+	}
+}
+
+// WithOutputs adds more outputs to the Encoder or the Decoder.
+// The result will be written to all the outputs.
+func WithOutputs(outputs ...io.Writer) CodecOption {
+	return func(o *codecOptions) error {
+		for _, output := range outputs {
+			if output == nil {
+				return invalidConfig("the outputs cannot be nil")
+			}
+		}
+		o.outputs = append(o.outputs, outputs...)
+		return nil
+	}
+}
+
+func newCodecOptions(input io.Reader, output io.Writer, opts []CodecOption) (*codecOptions, error) {
+	if input == nil {
+		return nil, invalidConfig("the input cannot be nil")
+	}
+	o := &codecOptions{
+		bufferSize: defaultBufferSize,
+	}
+	if output != nil {
+		o.outputs = append(o.outputs, output)
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// EngineOption configures an Engine
+type EngineOption func(*engineOptions) error
+
+type engineOptions struct {
+	queueSize    int
+	bufferSize   int
+	workers      int
+	minWorkers   int
+	maxWorkers   int
+	interval     time.Duration
+	journal      Journal
+	aging        time.Duration
+	lanes        []Lane
+	limit        *Limit
+	tapLimits    map[string]Limit
+	offPeak      []TimeWindow
+	timeout      time.Duration
+	interceptors []Interceptor
+	logger       *slog.Logger
+	tracer       Tracer
+	metrics      Metrics
+	taps         []namedTap
+}
+
+type namedTap struct {
+	name string
+	tap  Tap
+}
+
+// WithQueueSize sets the capacity of the engine's work queue (Default: DefaultQueueSize).
+// Unless specified otherwise (See WithWorkers), the engine runs the same number of workers.
+func WithQueueSize(size int) EngineOption {
+	return func(o *engineOptions) error {
+		if size < 1 || size > math.MaxUint16 {
+			return invalidConfig("the queue size must be between 1 and %d", math.MaxUint16)
+		}
+		o.queueSize = size
+		return nil
+	}
+}
+
+// WithTaskBufferSize sets the size of the buffer used to read the input of the tasks in chunks.
+// Zero means the default buffer size (1024 bytes).
+func WithTaskBufferSize(size int) EngineOption {
+	return func(o *engineOptions) error {
+		if size < 0 {
+			return invalidConfig("the task buffer size cannot be negative")
+		}
+		o.bufferSize = size
+		return nil
+	}
+}
+
+// WithTaskCipher is reserved for the future versions of the format and has no effect (See WithCipher).
+func WithTaskCipher(cipher Cipher) EngineOption {
+	return func(o *engineOptions) error {
+		return cipher.validate()
+	}
+}
+
+// WithTaskCompression is reserved for the future versions of the format and has no effect (See WithCompression).
+func WithTaskCompression(compression Compression) EngineOption {
+	return func(o *engineOptions) error {
+		return compression.validate()
+	}
+}
+
+// WithWorkers sets the initial number of the workers (See Engine.SetWorkers).
+func WithWorkers(n int) EngineOption {
+	return func(o *engineOptions) error {
+		if n < 1 {
+			return invalidConfig("the number of workers must be at least 1")
+		}
+		o.workers = n
+		return nil
+	}
+}
+
+// WithAutoscaling enables autoscaling the workers between min and max (See Engine.SetAutoscaling).
+func WithAutoscaling(min, max int, interval time.Duration) EngineOption {
+	return func(o *engineOptions) error {
+		if min < 1 || max < min {
+			return invalidConfig("the autoscaling boundaries must satisfy 1 <= min <= max")
+		}
+		if interval <= 0 {
+			return invalidConfig("the autoscaling interval must be positive")
+		}
+		o.minWorkers, o.maxWorkers, o.interval = min, max, interval
+		return nil
+	}
+}
+
+// WithJournal attaches a durable journal to the engine (See Engine.SetJournal).
+func WithJournal(journal Journal) EngineOption {
+	return func(o *engineOptions) error {
+		if journal == nil {
+			return invalidConfig("the journal cannot be nil")
+		}
+		o.journal = journal
+		return nil
+	}
+}
+
+// WithScheduling configures the order in which the work units will be served (See Engine.SetScheduling).
+func WithScheduling(aging time.Duration, lanes ...Lane) EngineOption {
+	return func(o *engineOptions) error {
+		for _, lane := range lanes {
+			if lane.MaxSize < 0 || lane.Share < 0 {
+				return invalidConfig("the size and the share of the lanes cannot be negative")
+			}
+		}
+		o.aging, o.lanes = aging, lanes
+		return nil
+	}
+}
+
+// WithLimit throttles the processing rate of the engine across all the taps (See Engine.SetLimit).
+func WithLimit(limit Limit) EngineOption {
+	return func(o *engineOptions) error {
+		if err := limit.validate(); err != nil {
+			return err
+		}
+		o.limit = &limit
+		return nil
+	}
+}
+
+// WithTapLimit throttles the processing rate of the work units dispatched by the tap (See Engine.SetTapLimit).
+func WithTapLimit(name string, limit Limit) EngineOption {
+	return func(o *engineOptions) error {
+		if err := limit.validate(); err != nil {
+			return err
+		}
+		if o.tapLimits == nil {
+			o.tapLimits = make(map[string]Limit)
+		}
+		o.tapLimits[name] = limit
+		return nil
+	}
+}
+
+// WithOffPeak sets the daily time windows during which the limits do not apply (See Engine.SetOffPeak).
+func WithOffPeak(windows ...TimeWindow) EngineOption {
+	return func(o *engineOptions) error {
+		for _, w := range windows {
+			if w.From < 0 || w.From >= 24*time.Hour || w.To < 0 || w.To > 24*time.Hour {
+				return invalidConfig("the time windows must be within a day")
+			}
+		}
+		o.offPeak = windows
+		return nil
+	}
+}
+
+// WithTimeout sets the maximum processing time of the work units (See Engine.SetTimeout).
+func WithTimeout(timeout time.Duration) EngineOption {
+	return func(o *engineOptions) error {
+		if timeout < 0 {
+			return invalidConfig("the timeout cannot be negative")
+		}
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// WithInterceptors registers the interceptors of the engine (See Engine.Use).
+func WithInterceptors(interceptors ...Interceptor) EngineOption {
+	return func(o *engineOptions) error {
+		for _, interceptor := range interceptors {
+			if interceptor == nil {
+				return invalidConfig("the interceptors cannot be nil")
+			}
+		}
+		o.interceptors = append(o.interceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithLogger sets the structured logger of the engine (See Engine.SetLogger).
+func WithLogger(logger *slog.Logger) EngineOption {
+	return func(o *engineOptions) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithTracer sets the tracer of the engine (See Engine.SetTracer).
+func WithTracer(tracer Tracer) EngineOption {
+	return func(o *engineOptions) error {
+		o.tracer = tracer
+		return nil
+	}
+}
+
+// WithMetrics sets the collector of the engine's measurements (See Engine.SetMetrics).
+func WithMetrics(metrics Metrics) EngineOption {
+	return func(o *engineOptions) error {
+		o.metrics = metrics
+		return nil
+	}
+}
+
+// WithTap attaches a named tap to the engine (See Engine.Attach).
+func WithTap(name string, tap Tap) EngineOption {
+	return func(o *engineOptions) error {
+		if tap == nil {
+			return invalidConfig("the tap cannot be nil")
+		}
+		for _, t := range o.taps {
+			if t.name == name {
+				return ErrTapAlreadyAttached
+			}
+		}
+		o.taps = append(o.taps, namedTap{name: name, tap: tap})
+		return nil
+	}
+}
+
+func (l Limit) validate() error {
+	if l.BytesPerSecond < 0 || l.BytesBurst < 0 || l.TasksPerSecond < 0 || l.TasksBurst < 0 {
+		return invalidConfig("the limits cannot be negative")
+	}
+	return nil
+}
+
+func invalidConfig(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,292 @@
+package obfuscate
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestCodecOptions(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	testCases := []struct {
+		title              string
+		input              *filebuffer.Buffer
+		output             *filebuffer.Buffer
+		opts               []CodecOption
+		expectedBufferSize int
+		expectedError      error
+	}{
+		{
+			title:              "default_buffer_size",
+			input:              filebuffer.New(nil),
+			output:             filebuffer.New(nil),
+			expectedBufferSize: defaultBufferSize,
+		},
+		{
+			title:              "custom_buffer_size",
+			input:              filebuffer.New(nil),
+			output:             filebuffer.New(nil),
+			opts:               []CodecOption{WithBufferSize(10)},
+			expectedBufferSize: 10,
+		},
+		{
+			title:         "negative_buffer_size",
+			input:         filebuffer.New(nil),
+			output:        filebuffer.New(nil),
+			opts:          []CodecOption{WithBufferSize(-1)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:              "supported_cipher_and_compression",
+			input:              filebuffer.New(nil),
+			output:             filebuffer.New(nil),
+			opts:               []CodecOption{WithCipher(CipherAES256CFB), WithCompression(CompressionNone)},
+			expectedBufferSize: defaultBufferSize,
+		},
+		{
+			title:         "unsupported_cipher",
+			input:         filebuffer.New(nil),
+			output:        filebuffer.New(nil),
+			opts:          []CodecOption{WithCipher("chacha20")},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "unsupported_compression",
+			input:         filebuffer.New(nil),
+			output:        filebuffer.New(nil),
+			opts:          []CodecOption{WithCompression("gzip")},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "nil_input",
+			output:        filebuffer.New(nil),
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "nil_extra_output",
+			input:         filebuffer.New(nil),
+			output:        filebuffer.New(nil),
+			opts:          []CodecOption{WithOutputs(nil)},
+			expectedError: ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			input := readerOrNil(tc.input)
+			encoder, err := NewEncoderWithOptions(master, input, tc.output, tc.opts...)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			decoder, err := NewDecoderWithOptions(master, input, tc.output, tc.opts...)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if tc.expectedError != nil {
+				return
+			}
+			if encoder.bufferSize != tc.expectedBufferSize {
+				t.Errorf("expected encoder buffer size %d, but got %d", tc.expectedBufferSize, encoder.bufferSize)
+			}
+			if decoder.bufferSize != tc.expectedBufferSize {
+				t.Errorf("expected decoder buffer size %d, but got %d", tc.expectedBufferSize, decoder.bufferSize)
+			}
+		})
+	}
+}
+
+func TestCodecNilOutput(t *testing.T) {
+	master, _ := KeyFromPassword("password")
+	if _, err := NewEncoderWithOptions(master, filebuffer.New(nil), nil); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrInvalidConfig, err)
+	}
+
+	encoded := filebuffer.New(nil)
+	if _, err := newTestEncoder(t, master, filebuffer.New([]byte("input")), encoded).Encode(); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	// The decoder does not need an output to verify the input
+	status, err := newTestDecoder(t, master, filebuffer.New(encoded.Buff.Bytes()), nil).Verify()
+	if err != nil || status != Completed {
+		t.Errorf("expected the verification to complete, but received '%v' (%v)", status, err)
+	}
+}
+
+func TestEngineOptions(t *testing.T) {
+	testCases := []struct {
+		title           string
+		opts            []EngineOption
+		expectedWorkers int
+		expectedError   error
+	}{
+		{
+			title:           "defaults",
+			expectedWorkers: DefaultQueueSize,
+		},
+		{
+			title:           "queue_size",
+			opts:            []EngineOption{WithQueueSize(5)},
+			expectedWorkers: 5,
+		},
+		{
+			title:           "workers",
+			opts:            []EngineOption{WithQueueSize(5), WithWorkers(2)},
+			expectedWorkers: 2,
+		},
+		{
+			title:           "autoscaling_clamps_the_workers",
+			opts:            []EngineOption{WithWorkers(20), WithAutoscaling(1, 4, time.Second)},
+			expectedWorkers: 4,
+		},
+		{
+			title:         "zero_queue_size",
+			opts:          []EngineOption{WithQueueSize(0)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "queue_size_overflow",
+			opts:          []EngineOption{WithQueueSize(1 << 16)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "zero_workers",
+			opts:          []EngineOption{WithWorkers(0)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "invalid_autoscaling_boundaries",
+			opts:          []EngineOption{WithAutoscaling(4, 2, time.Second)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "negative_task_buffer_size",
+			opts:          []EngineOption{WithTaskBufferSize(-1)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "negative_limit",
+			opts:          []EngineOption{WithLimit(Limit{BytesPerSecond: -1})},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "invalid_off_peak_window",
+			opts:          []EngineOption{WithOffPeak(TimeWindow{From: 25 * time.Hour})},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "unsupported_task_cipher",
+			opts:          []EngineOption{WithTaskCipher("chacha20")},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "unsupported_task_compression",
+			opts:          []EngineOption{WithTaskCompression("zstd")},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "nil_journal",
+			opts:          []EngineOption{WithJournal(nil)},
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "duplicate_tap",
+			opts:          []EngineOption{WithTap("tap", newMockedTap()), WithTap("tap", newMockedTap())},
+			expectedError: ErrTapAlreadyAttached,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			engine, err := NewEngineWithOptions(nil, tc.opts...)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if workers := engine.Workers(); workers != tc.expectedWorkers {
+				t.Errorf("expected %d workers, but got %d", tc.expectedWorkers, workers)
+			}
+		})
+	}
+}
+
+func TestEngineWithTap(t *testing.T) {
+	engine := newTestEngine(t, newMockedTap(), WithTap("another", newMockedTap()))
+	taps := engine.Taps()
+	if len(taps) != 2 || taps[0] != "another" || taps[1] != DefaultTapName {
+		t.Errorf("expected the taps to be attached, but got %v", taps)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	testCases := []struct {
+		title         string
+		json          string
+		expected      Config
+		expectedError error
+	}{
+		{
+			title: "durations_and_limits",
+			json: `{"queue_size": 4, "max_workers": 8, "scaling_interval": "500ms", "timeout": "1m30s",
+				"limit": {"bytes_per_second": 1024}, "off_peak": [{"from": "22h", "to": "6h"}]}`,
+			expected: Config{
+				QueueSize:       4,
+				MaxWorkers:      8,
+				ScalingInterval: Duration(500 * time.Millisecond),
+				Timeout:         Duration(90 * time.Second),
+				Limit:           Limit{BytesPerSecond: 1024},
+				OffPeak:         []OffPeakWindow{{From: Duration(22 * time.Hour), To: Duration(6 * time.Hour)}},
+			},
+		},
+		{
+			title:         "invalid_duration",
+			json:          `{"timeout": "forever"}`,
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "invalid_queue_size",
+			json:          `{"queue_size": -1}`,
+			expectedError: ErrInvalidConfig,
+		},
+		{
+			title:         "unsupported_compression",
+			json:          `{"compression": "gzip"}`,
+			expectedError: ErrInvalidConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			var config Config
+			err := json.Unmarshal([]byte(tc.json), &config)
+			if err == nil {
+				err = config.Validate()
+			}
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if config.Timeout != tc.expected.Timeout || config.ScalingInterval != tc.expected.ScalingInterval ||
+				config.Limit != tc.expected.Limit || len(config.OffPeak) != 1 || config.OffPeak[0] != tc.expected.OffPeak[0] {
+				t.Errorf("expected %+v, but got %+v", tc.expected, config)
+			}
+			if _, err := NewEngineWithOptions(nil, config.Options()...); err != nil {
+				t.Errorf("failed to create the engine: %v", err)
+			}
+		})
+	}
+}
+
+func readerOrNil(b *filebuffer.Buffer) io.Reader {
+	if b == nil {
+		return nil
+	}
+	return b
+}
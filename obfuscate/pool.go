@@ -0,0 +1,204 @@
+package obfuscate
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// workerFunc is the function which gets executed by every worker of the pool.
+// The worker must return once the quit channel has been closed.
+type workerFunc func(ctx context.Context, lane int, quit <-chan None)
+
+// workerPool is a resizable pool of workers, split between the lanes of the scheduler
+type workerPool struct {
+	ctx    context.Context
+	wg     *sync.WaitGroup
+	run    workerFunc
+	queue  *scheduler
+	size   int
+	active int32
+	// the quit channel of every running worker per lane
+	workers [][]chan None
+
+	// autoscaling settings
+	min, max  int
+	processed int64
+
+	mux sync.Mutex
+}
+
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{
+		size: size,
+	}
+}
+
+// start launches the workers. The pool must only be started once.
+func (p *workerPool) start(ctx context.Context, wg *sync.WaitGroup, queue *scheduler, run workerFunc) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.ctx = ctx
+	p.wg = wg
+	p.queue = queue
+	p.run = run
+	p.workers = make([][]chan None, len(queue.lanes))
+	p.apply()
+}
+
+// limit sets the autoscaling boundaries of the pool
+func (p *workerPool) limit(min, max int) {
+	p.mux.Lock()
+	p.min, p.max = min, max
+	size := p.size
+	p.mux.Unlock()
+	p.resize(size)
+}
+
+// resize changes the number of the workers.
+// If autoscaling is enabled, the size will be kept between its boundaries.
+func (p *workerPool) resize(size int) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.max > 0 {
+		if size < p.min {
+			size = p.min
+		}
+		if size > p.max {
+			size = p.max
+		}
+	}
+
+	if size < 0 {
+		size = 0
+	}
+
+	p.size = size
+	if p.run != nil {
+		p.apply()
+	}
+}
+
+// apply starts or retires the workers of each lane to match the requested size
+func (p *workerPool) apply() {
+	for lane, target := range p.queue.distribute(p.size) {
+		running := p.workers[lane]
+		for len(running) < target {
+			quit := make(chan None)
+			running = append(running, quit)
+			p.wg.Add(1)
+			go func(lane int, quit chan None) {
+				defer p.wg.Done()
+				p.run(p.ctx, lane, quit)
+			}(lane, quit)
+		}
+		for len(running) > target {
+			// The busy workers will quit once they finish their current task
+			close(running[len(running)-1])
+			running = running[:len(running)-1]
+		}
+		p.workers[lane] = running
+	}
+}
+
+// count returns the number of running workers
+func (p *workerPool) count() int {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.run == nil {
+		return p.size
+	}
+	var count int
+	for _, running := range p.workers {
+		count += len(running)
+	}
+	return count
+}
+
+func (p *workerPool) busy() {
+	atomic.AddInt32(&p.active, 1)
+}
+
+func (p *workerPool) idle() {
+	atomic.AddInt32(&p.active, -1)
+}
+
+// autoscale grows or shrinks the pool between min and max every interval, until the context is cancelled.
+//
+// The pool grows while there are work units waiting in the queue and all the workers are busy.
+// Adding more workers stops as soon as it no longer increases the throughput, which means
+// that the engine has saturated the CPU or the I/O. The idle workers will be retired one at a time.
+func (p *workerPool) autoscale(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		lastThroughput int64
+		grew           bool
+	)
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		throughput := atomic.SwapInt64(&p.processed, 0)
+		workers := p.count()
+		active := int(atomic.LoadInt32(&p.active))
+		depth := p.queue.len()
+
+		p.mux.Lock()
+		min, max := p.min, p.max
+		p.mux.Unlock()
+		if max == 0 {
+			// autoscaling has been disabled
+			return
+		}
+
+		switch {
+		case depth > 0 && active >= workers && workers < max:
+			if grew && throughput <= lastThroughput {
+				// The last worker we added did not help. We are saturated.
+				grew = false
+				break
+			}
+			step := workers / 4
+			if step < 1 {
+				step = 1
+			}
+			p.resize(workers + step)
+			grew = true
+		case depth == 0 && active < workers && workers > min:
+			p.resize(workers - 1)
+			grew = false
+		default:
+			grew = false
+		}
+		lastThroughput = throughput
+	}
+}
+
+// meter returns a reader which counts the bytes read from the input towards the pool's throughput
+func (p *workerPool) meter(input io.Reader) io.Reader {
+	return &countingReader{
+		input:   input,
+		counter: &p.processed,
+	}
+}
+
+type countingReader struct {
+	input   io.Reader
+	counter *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.input.Read(p)
+	atomic.AddInt64(c.counter, int64(n))
+	return n, err
+}
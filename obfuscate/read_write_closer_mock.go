@@ -1,5 +1,7 @@
 package obfuscate
 
+import "io"
+
 type OnlyWriter struct{}
 
 func (o *OnlyWriter) Write(p []byte) (n int, err error) {
@@ -37,3 +39,34 @@ func (o *ReadCloser) Close() error {
 	o.IsClosed = true
 	return nil
 }
+
+// faultyStream fails the reads and the writes once the limit has been reached.
+// The reads return io.EOF if no error has been specified.
+type faultyStream struct {
+	data  []byte
+	limit int
+	err   error
+	n     int
+}
+
+func (f *faultyStream) Read(p []byte) (int, error) {
+	if f.n >= f.limit {
+		if f.err == nil {
+			return 0, io.EOF
+		}
+		return 0, f.err
+	}
+	n := copy(p, f.data[f.n:f.limit])
+	f.n += n
+	return n, nil
+}
+
+func (f *faultyStream) Write(p []byte) (int, error) {
+	if f.n+len(p) > f.limit {
+		n := f.limit - f.n
+		f.n = f.limit
+		return n, f.err
+	}
+	f.n += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,187 @@
+package obfuscate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// maxRecordSize the maximum size of a single record of a RecordLog
+	maxRecordSize = 1 << 24
+	// defaultCompactionThreshold the number of records which can be appended to a RecordLog before it gets compacted
+	defaultCompactionThreshold = 10000
+)
+
+// RecordLog is an append-only file of JSON records which durably persists the state of
+// a long running component (i.e. FileJournal).
+//
+// Every record is written to the file as a single line of JSON and gets flushed to the
+// disk before Append returns. The file is compacted every time it gets opened, and once the number of
+// the appended records exceeds both the compaction threshold and the number of the live records.
+type RecordLog struct {
+	path     string
+	file     *os.File
+	encoder  *json.Encoder
+	snapshot func() []interface{}
+	// the number of the records which have been appended since the last compaction
+	appended int
+	// the number of the records which have been written by the last compaction
+	live      int
+	threshold int
+
+	mux sync.Mutex
+}
+
+// OpenRecordLog opens the record file at the specified path or creates a new one if it does not exist.
+//
+// The replay function is called with every record of the existing file in order. If the last record cannot be
+// replayed, it is treated as a partially written record (as a result of a crash) and gets dropped. Any other
+// record which cannot be replayed fails the call with ErrCorrupted, leaving the existing file untouched.
+//
+// Once the file has been replayed, the records returned by the snapshot function will be written into a new file
+// which atomically replaces the existing one. The snapshot function is also called by Append to compact the file
+// while it is being used, so it must not acquire the locks which are held by the callers of Append.
+func OpenRecordLog(path string, replay func(record []byte) error, snapshot func() []interface{}) (*RecordLog, error) {
+	l := &RecordLog{
+		path:      path,
+		snapshot:  snapshot,
+		threshold: defaultCompactionThreshold,
+	}
+
+	if err := l.load(replay); err != nil {
+		return nil, err
+	}
+
+	if err := l.compact(snapshot()); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Append durably appends a new record to the file.
+func (l *RecordLog) Append(record interface{}) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.file == nil {
+		return os.ErrClosed
+	}
+
+	if l.appended >= l.threshold && l.appended >= l.live {
+		// The record gets appended to the existing file if the compaction fails
+		if err := l.compact(l.snapshot()); err != nil && l.file == nil {
+			return err
+		}
+	}
+
+	if err := l.encoder.Encode(record); err != nil {
+		return err
+	}
+	l.appended++
+
+	return l.file.Sync()
+}
+
+// Close closes the underlying file
+func (l *RecordLog) Close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *RecordLog) load(replay func(record []byte) error) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, defaultBufferSize), maxRecordSize)
+	var (
+		failed error
+		line   int
+	)
+	for scanner.Scan() {
+		if failed != nil {
+			// Only the last record can be partially written
+			return fmt.Errorf("%w: record %d of '%s': %v", ErrCorrupted, line, l.path, failed)
+		}
+		line++
+		failed = replay(scanner.Bytes())
+	}
+
+	return scanner.Err()
+}
+
+// compact writes the records into a new file and atomically replaces the existing file with it.
+// The temporary file is hidden, so that the taps watching the same directory ignore it.
+//
+// The existing file will be kept open for appending if the compaction fails before the file gets replaced.
+func (l *RecordLog) compact(records []interface{}) error {
+	temp := filepath.Join(filepath.Dir(l.path), "."+filepath.Base(l.path)+".tmp")
+	file, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp, l.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(l.path))
+
+	if l.file != nil {
+		// The existing file has been replaced, so the records cannot be appended to it anymore
+		l.file.Close()
+	}
+	l.file, err = os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	l.encoder = json.NewEncoder(l.file)
+	l.appended = 0
+	l.live = len(records)
+	return nil
+}
+
+// syncDir flushes the directory entries to the disk, so that a renamed file survives a crash.
+// Directories cannot be synced on some platforms, so the errors are ignored.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	dir.Sync()
+	dir.Close()
+}
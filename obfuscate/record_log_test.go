@@ -0,0 +1,127 @@
+package obfuscate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testRecord struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+// testRecords is an in-memory state which gets persisted using a RecordLog
+type testRecords map[string]int
+
+func (r testRecords) replay(record []byte) error {
+	var rec testRecord
+	if err := json.Unmarshal(record, &rec); err != nil {
+		return err
+	}
+	r[rec.Key] = rec.Value
+	return nil
+}
+
+func (r testRecords) snapshot() []interface{} {
+	records := make([]interface{}, 0, len(r))
+	for key, value := range r {
+		records = append(records, testRecord{Key: key, Value: value})
+	}
+	return records
+}
+
+func TestRecordLogReplay(t *testing.T) {
+	testCases := []struct {
+		title         string
+		content       string
+		expectedError error
+		expected      testRecords
+	}{
+		{
+			title:    "valid_records",
+			content:  "{\"key\":\"a\",\"value\":1}\n{\"key\":\"b\",\"value\":2}\n",
+			expected: testRecords{"a": 1, "b": 2},
+		},
+		{
+			title:    "partially_written_last_record",
+			content:  "{\"key\":\"a\",\"value\":1}\n{\"key\":\"b\",\"va",
+			expected: testRecords{"a": 1},
+		},
+		{
+			title:         "corrupted_record_in_the_middle",
+			content:       "{\"key\":\"a\",\"value\":1}\n{\"key\":\"b\",\"va\n{\"key\":\"c\",\"value\":3}\n",
+			expectedError: ErrCorrupted,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "records")
+			if err := os.WriteFile(path, []byte(tc.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			records := make(testRecords)
+			l, err := OpenRecordLog(path, records.replay, records.snapshot)
+			if !errors.Is(err, tc.expectedError) {
+				t.Fatalf("expected '%v' as error, but received '%v'", tc.expectedError, err)
+			}
+			if err != nil {
+				// The valid records after the corrupted one must not get lost by a compaction
+				if content, _ := os.ReadFile(path); string(content) != tc.content {
+					t.Errorf("expected the file to be left untouched, actual '%s'", content)
+				}
+				return
+			}
+			defer l.Close()
+			if len(records) != len(tc.expected) {
+				t.Errorf("expected %d records to be replayed, actual %d", len(tc.expected), len(records))
+			}
+			for key, value := range tc.expected {
+				if records[key] != value {
+					t.Errorf("expected %d as the value of '%s', actual %d", value, key, records[key])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordLogCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records")
+	records := make(testRecords)
+	l, err := OpenRecordLog(path, records.replay, records.snapshot)
+	if err != nil {
+		t.Fatalf("failed to open the record log: %v", err)
+	}
+	l.threshold = 10
+
+	const appended = 100
+	for i := 0; i < appended; i++ {
+		record := testRecord{Key: string(rune('a' + i%3)), Value: i}
+		if err := l.Append(record); err != nil {
+			t.Fatalf("failed to append the record: %v", err)
+		}
+		records[record.Key] = record.Value
+	}
+	l.Close()
+
+	content, _ := os.ReadFile(path)
+	if lines := bytes.Count(content, []byte("\n")); lines > l.threshold+len(records) {
+		t.Errorf("expected the file to be compacted while running, actual %d records", lines)
+	}
+
+	replayed := make(testRecords)
+	l, err = OpenRecordLog(path, replayed.replay, replayed.snapshot)
+	if err != nil {
+		t.Fatalf("failed to re-open the record log: %v", err)
+	}
+	defer l.Close()
+	for key, value := range records {
+		if replayed[key] != value {
+			t.Errorf("expected %d as the value of '%s', actual %d", value, key, replayed[key])
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package obfuscate
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lane is a size based partition of the engine's work queue with its own share of the workers.
+//
+// Lanes prevent the big inputs from blocking the small ones which have been queued behind them.
+type Lane struct {
+	// MaxSize the maximum size (in bytes) of the work units served by the lane.
+	// Zero means no limit.
+	MaxSize int64 `json:"max_size"`
+	// Share the relative share of the engine's workers dedicated to the lane.
+	// Every lane will get at least one worker.
+	Share int `json:"share"`
+}
+
+// scheduler is a priority queue of work units which serves the higher priority units first.
+//
+// Every lane has its own queue. The waiting work units get promoted by one
+// priority level every 'aging' interval, so that the low priority units don't starve.
+//
+// The units of the same priority which have been dispatched by different taps are served
+// in a round robin fashion, so that a busy tap cannot block the others.
+type scheduler struct {
+	lanes []*lane
+	aging time.Duration
+	epoch time.Time
+	seq   uint64
+	// the latest round of each tap
+	rounds map[string]uint64
+	// the round of the last served unit
+	current uint64
+	// the queued units by ID
+	units map[string]*WorkUnit
+	mux   sync.Mutex
+}
+
+type lane struct {
+	Lane
+	queue unitQueue
+	// the free slots of the queue
+	slots chan None
+	// one token per queued unit
+	ready chan None
+}
+
+type queuedUnit struct {
+	unit  *WorkUnit
+	score int64
+	round uint64
+	seq   uint64
+}
+
+func newScheduler(capacity int, aging time.Duration, lanes ...Lane) *scheduler {
+	if capacity <= 0 {
+		capacity = 1
+	}
+
+	if len(lanes) == 0 {
+		lanes = []Lane{{}}
+	}
+
+	sorted := make([]Lane, len(lanes))
+	copy(sorted, lanes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].MaxSize == 0 {
+			return false
+		}
+		if sorted[j].MaxSize == 0 {
+			return true
+		}
+		return sorted[i].MaxSize < sorted[j].MaxSize
+	})
+
+	s := &scheduler{
+		aging:  aging,
+		epoch:  time.Now(),
+		lanes:  make([]*lane, len(sorted)),
+		rounds: make(map[string]uint64),
+		units:  make(map[string]*WorkUnit),
+	}
+	for i, l := range sorted {
+		if l.Share <= 0 {
+			l.Share = 1
+		}
+		s.lanes[i] = &lane{
+			Lane:  l,
+			slots: make(chan None, capacity),
+			ready: make(chan None, capacity),
+		}
+	}
+	return s
+}
+
+// push queues the work unit. It blocks until there is a free slot in the lane or done gets closed.
+func (s *scheduler) push(w *WorkUnit, done <-chan None) bool {
+	l := s.laneOf(w)
+	select {
+	case l.slots <- None{}:
+	case <-done:
+		return false
+	}
+
+	s.mux.Lock()
+	s.seq++
+	// An idle tap must not be able to jump the queue by its earlier rounds
+	round := s.rounds[w.Tap]
+	if round < s.current {
+		round = s.current
+	}
+	round++
+	s.rounds[w.Tap] = round
+	s.units[w.ID] = w
+	heap.Push(&l.queue, &queuedUnit{
+		unit:  w,
+		score: s.score(w),
+		round: round,
+		seq:   s.seq,
+	})
+	s.mux.Unlock()
+
+	l.ready <- None{}
+	return true
+}
+
+// pop blocks until a work unit is available in the specified lane.
+// It returns false once the scheduler has been closed and drained, the context is cancelled or quit gets closed.
+func (s *scheduler) pop(ctx context.Context, index int, quit <-chan None) (*WorkUnit, bool) {
+	l := s.lanes[index]
+	select {
+	case _, more := <-l.ready:
+		if !more {
+			return nil, false
+		}
+	case <-ctx.Done():
+		return nil, false
+	case <-quit:
+		return nil, false
+	}
+
+	s.mux.Lock()
+	q := heap.Pop(&l.queue).(*queuedUnit)
+	if q.round > s.current {
+		s.current = q.round
+	}
+	s.mux.Unlock()
+
+	<-l.slots
+	return q.unit, true
+}
+
+// close signals the workers that no more work units will be queued.
+// The units which are already in the queue will still be served.
+func (s *scheduler) close() {
+	for _, l := range s.lanes {
+		close(l.ready)
+	}
+}
+
+// release stops tracking the work unit which has been popped from the queue.
+// The units remain discoverable by find() until they are released.
+func (s *scheduler) release(w *WorkUnit) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.units[w.ID] == w {
+		delete(s.units, w.ID)
+	}
+}
+
+// find returns the queued work unit with the specified ID
+func (s *scheduler) find(id string) (*WorkUnit, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	w, ok := s.units[id]
+	return w, ok
+}
+
+// len returns the number of queued work units
+func (s *scheduler) len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var count int
+	for _, l := range s.lanes {
+		count += l.queue.Len()
+	}
+	return count
+}
+
+// distribute splits the workers between the lanes based on their share.
+// Every lane gets at least one worker.
+func (s *scheduler) distribute(workers int) []int {
+	result := make([]int, len(s.lanes))
+	var total int
+	for _, l := range s.lanes {
+		total += l.Share
+	}
+
+	remaining := workers
+	for i, l := range s.lanes {
+		result[i] = workers * l.Share / total
+		if result[i] == 0 {
+			result[i] = 1
+		}
+		remaining -= result[i]
+	}
+
+	// Give the rounding leftovers to the lanes in order
+	for i := 0; remaining > 0; i = (i + 1) % len(result) {
+		result[i]++
+		remaining--
+	}
+	return result
+}
+
+func (s *scheduler) laneOf(w *WorkUnit) *lane {
+	for _, l := range s.lanes {
+		if l.MaxSize == 0 || w.Size <= l.MaxSize {
+			return l
+		}
+	}
+	// The unit is bigger than all the lanes can take
+	return s.lanes[len(s.lanes)-1]
+}
+
+// score calculates the time invariant ordering key of the work unit.
+//
+// A unit which has been waiting for 'aging' longer than another unit is
+// considered to be one priority level higher.
+func (s *scheduler) score(w *WorkUnit) int64 {
+	if s.aging <= 0 {
+		return int64(w.Priority)
+	}
+	return int64(w.Priority)*int64(s.aging) - int64(time.Since(s.epoch))
+}
+
+// unitQueue implements heap.Interface
+type unitQueue []*queuedUnit
+
+func (q unitQueue) Len() int {
+	return len(q)
+}
+
+func (q unitQueue) Less(i, j int) bool {
+	if q[i].score != q[j].score {
+		return q[i].score > q[j].score
+	}
+	if q[i].round != q[j].round {
+		return q[i].round < q[j].round
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q unitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *unitQueue) Push(x interface{}) {
+	*q = append(*q, x.(*queuedUnit))
+}
+
+func (q *unitQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
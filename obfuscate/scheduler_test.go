@@ -0,0 +1,140 @@
+package obfuscate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerPriority(t *testing.T) {
+	testCases := []struct {
+		title    string
+		aging    time.Duration
+		units    []*WorkUnit
+		expected []string
+	}{
+		{
+			title: "same_priority_units_must_be_served_in_order",
+			units: []*WorkUnit{
+				{ID: "a"},
+				{ID: "b"},
+				{ID: "c"},
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			title: "higher_priority_units_must_be_served_first",
+			units: []*WorkUnit{
+				{ID: "low", Priority: -1},
+				{ID: "normal"},
+				{ID: "high", Priority: 10},
+			},
+			expected: []string{"high", "normal", "low"},
+		},
+		{
+			title: "waiting_units_must_be_promoted",
+			aging: time.Nanosecond,
+			units: []*WorkUnit{
+				{ID: "old"},
+				{ID: "new", Priority: 1},
+			},
+			expected: []string{"old", "new"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			s := newScheduler(len(tc.units), tc.aging)
+			for _, w := range tc.units {
+				s.push(w, nil)
+				// make sure the units are not queued at the exact same time
+				time.Sleep(time.Millisecond)
+			}
+			s.close()
+
+			for _, id := range tc.expected {
+				w, ok := s.pop(context.Background(), 0, nil)
+				if !ok {
+					t.Fatalf("expected '%s', but the queue was empty", id)
+				}
+				if w.ID != id {
+					t.Errorf("expected '%s', actual '%s'", id, w.ID)
+				}
+			}
+
+			if _, ok := s.pop(context.Background(), 0, nil); ok {
+				t.Error("the queue was supposed to be drained")
+			}
+		})
+	}
+}
+
+func TestSchedulerLanes(t *testing.T) {
+	s := newScheduler(10, 0, Lane{Share: 1}, Lane{MaxSize: 100, Share: 3})
+
+	if s.lanes[0].MaxSize != 100 {
+		t.Fatalf("the lanes must be sorted by size, with the unlimited lane last")
+	}
+
+	small := &WorkUnit{ID: "small", Size: 10}
+	large := &WorkUnit{ID: "large", Size: 1000}
+	s.push(large, nil)
+	s.push(small, nil)
+	s.close()
+
+	w, _ := s.pop(context.Background(), 0, nil)
+	if w != small {
+		t.Errorf("expected the small unit to be served by the first lane, actual '%s'", w.ID)
+	}
+
+	w, _ = s.pop(context.Background(), 1, nil)
+	if w != large {
+		t.Errorf("expected the large unit to be served by the second lane, actual '%s'", w.ID)
+	}
+
+	workers := s.distribute(8)
+	if workers[0] != 6 || workers[1] != 2 {
+		t.Errorf("expected the workers to be distributed as [6 2], actual %v", workers)
+	}
+
+	workers = s.distribute(1)
+	if workers[0] != 1 || workers[1] != 1 {
+		t.Errorf("expected every lane to get at least one worker, actual %v", workers)
+	}
+}
+
+func TestSchedulerPushBlocksWhenFull(t *testing.T) {
+	s := newScheduler(1, 0)
+	s.push(&WorkUnit{}, nil)
+
+	done := make(chan None)
+	close(done)
+	if s.push(&WorkUnit{}, done) {
+		t.Error("pushing to a full queue must block until done is closed")
+	}
+
+	if s.len() != 1 {
+		t.Errorf("expected one queued unit, actual %d", s.len())
+	}
+}
+
+func TestSchedulerFairness(t *testing.T) {
+	s := newScheduler(10, 0)
+	for _, w := range []*WorkUnit{
+		{ID: "a1", Tap: "a"},
+		{ID: "a2", Tap: "a"},
+		{ID: "a3", Tap: "a"},
+		{ID: "b1", Tap: "b"},
+		{ID: "b2", Tap: "b"},
+	} {
+		s.push(w, nil)
+	}
+	s.close()
+
+	for _, id := range []string{"a1", "b1", "a2", "b2", "a3"} {
+		w, _ := s.pop(context.Background(), 0, nil)
+		if w.ID != id {
+			t.Errorf("expected '%s', actual '%s'", id, w.ID)
+		}
+	}
+}
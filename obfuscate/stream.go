@@ -1,86 +1,279 @@
 package obfuscate
 
 import (
+	"log/slog"
+	"sort"
 	"sync"
+	"time"
 )
 
 // WorkList is the pipe to flow the work units from the tap to the engine
 type WorkList chan *WorkUnit
 
+// DefaultTapName is the name of the tap which has been passed to obfuscate.NewEngineWithOptions(...) method
+const DefaultTapName = "default"
+
 type stream struct {
-	workList WorkList
-	inputTap Tap
+	queue    *scheduler
+	capacity int
+	journal  Journal
+	events   *eventBus
+	logger   *slog.Logger
+	tracer   Tracer
+	sources  map[string]*source
 
 	wg sync.WaitGroup
 	// to stop processing the work units
-	// event if the tap is still sending requests
+	// event if the taps are still sending requests
 	done chan None
 
-	openOnce     sync.Once
+	isClosed bool
+
 	shutdownOnce sync.Once
 
-	// to prevent multiple go routines to run
-	// shutdown and open at the same time
+	// to protect the sources and the state of the stream
 	mux sync.Mutex
 }
 
+// source is a tap attached to the stream
+type source struct {
+	name string
+	tap  Tap
+	// the work units of the tap are not recorded in the journal (See TransientTap)
+	transient bool
+	// to stop consuming the tap's pipe
+	done    chan None
+	stopped chan None
+	started bool
+}
+
 func newStream(bufferSize uint16, tap Tap) *stream {
 	s := &stream{
-		workList: make(WorkList, bufferSize),
+		queue:    newScheduler(int(bufferSize), 0),
+		capacity: int(bufferSize),
 		done:     make(chan None),
-		inputTap: tap,
+		events:   newEventBus(),
+		logger:   discardLogger,
+		tracer:   noopTracer{},
+		sources:  make(map[string]*source),
+	}
+	if tap != nil {
+		s.attach(DefaultTapName, tap)
 	}
-
-	s.wg.Add(1)
-	go s.consumeTap()
 	return s
 }
 
+// schedule replaces the work queue with a new scheduler.
+// It must be called before the stream gets opened.
+func (s *stream) schedule(aging time.Duration, lanes ...Lane) {
+	s.queue = newScheduler(s.capacity, aging, lanes...)
+}
+
+// attach registers a new tap with the stream.
+// The tap will not be opened until the next call to open()
+func (s *stream) attach(name string, tap Tap) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.isClosed {
+		return ErrEngineStopped
+	}
+
+	if _, ok := s.sources[name]; ok {
+		return ErrTapAlreadyAttached
+	}
+
+	transient, _ := tap.(TransientTap)
+	s.sources[name] = &source{
+		name:      name,
+		tap:       tap,
+		transient: transient != nil && transient.Transient(),
+		done:      make(chan None),
+		stopped:   make(chan None),
+	}
+	return nil
+}
+
+// detach closes the tap and stops consuming its pipe
+func (s *stream) detach(name string) error {
+	s.mux.Lock()
+	src, ok := s.sources[name]
+	if ok {
+		delete(s.sources, name)
+	}
+	s.mux.Unlock()
+
+	if !ok {
+		return ErrTapNotFound
+	}
+
+	s.stop(src)
+	return nil
+}
+
+// names returns the sorted list of the attached taps
+func (s *stream) names() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	names := make([]string, 0, len(s.sources))
+	for name := range s.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// taps returns the attached taps which have not been started yet
+func (s *stream) taps() map[string]Tap {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	taps := make(map[string]Tap)
+	for name, src := range s.sources {
+		if !src.started {
+			taps[name] = src.tap
+		}
+	}
+	return taps
+}
+
+// open opens the taps which have not been started yet
 func (s *stream) open() {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	s.openOnce.Do(func() {
-		if s.inputTap == nil {
-			return
+	if s.isClosed {
+		return
+	}
+
+	for _, src := range s.sources {
+		if src.started {
+			continue
 		}
-		if !s.inputTap.IsOpen() {
-			s.inputTap.Open()
+		src.started = true
+		s.wg.Add(1)
+		go s.consumeTap(src)
+		if !src.tap.IsOpen() {
+			src.tap.Open()
 		}
-	})
+	}
 }
 
-func (s *stream) consumeTap() {
+func (s *stream) consumeTap(src *source) {
 	defer s.wg.Done()
+	defer close(src.stopped)
 	for {
 		select {
 		case <-s.done:
 			return
-		case w, more := <-s.inputTap.Pipe():
+		case <-src.done:
+			return
+		case w, more := <-src.tap.Pipe():
 			if !more {
+				// The tap has been closed. The rest of the taps must carry on.
+				s.remove(src)
+				s.logger.Info("tap closed", slog.String(LogKeyTap, src.name))
 				return
 			}
-			s.workList <- w
+			w.Tap = src.name
+			w.transient = src.transient
+			if !s.enqueue(w) {
+				continue
+			}
+			s.logger.Debug("work unit queued", unitAttrs(w)...)
+			s.events.publish(EventQueued, w, 0)
+			s.push(w)
 		}
 	}
 }
 
-func (s *stream) shutdown() {
+// remove removes the source from the stream if it's still attached
+func (s *stream) remove(src *source) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	if s.sources[src.name] == src {
+		delete(s.sources, src.name)
+	}
+}
 
-	s.shutdownOnce.Do(func() {
-		if s.inputTap == nil {
-			return
+// stop closes the tap and waits for the stream to stop consuming its pipe
+func (s *stream) stop(src *source) {
+	if src.tap.IsOpen() {
+		src.tap.Close()
+	}
+	close(src.done)
+	if src.started {
+		<-src.stopped
+	}
+}
+
+// enqueue records the work unit in the journal (if any).
+// The unit will be failed immediately if it cannot be durably recorded.
+func (s *stream) enqueue(w *WorkUnit) bool {
+	if s.journal == nil || w.transient {
+		return true
+	}
+	err := s.journal.Record(w.journalEntry(JournalEnqueued))
+	if err != nil {
+		w.Error = err
+		w.Task.markAsComplete(Failed)
+		logResult(s.logger, w, 0)
+		s.events.publish(EventFailed, w, 0)
+		w.callBack()
+		return false
+	}
+	return true
+}
+
+// push pushes the work unit into the work queue and starts tracing the time it waits in the queue.
+// The queue span will be ended by the engine, once the unit has been picked by a worker.
+func (s *stream) push(w *WorkUnit) bool {
+	_, w.queueSpan = startSpan(w.Context(), s.tracer, SpanQueue, w)
+	if !s.queue.push(w, s.done) {
+		w.queueSpan.End(ErrEngineStopped)
+		return false
+	}
+	return true
+}
+
+// replay pushes the recovered work units into the work queue
+func (s *stream) replay(units []*WorkUnit) {
+	if len(units) == 0 {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for _, w := range units {
+			s.events.publish(EventRetried, w, 0)
+			if !s.push(w) {
+				return
+			}
 		}
-		if s.inputTap.IsOpen() {
-			s.inputTap.Close()
+	}()
+}
+
+func (s *stream) shutdown() {
+	s.shutdownOnce.Do(func() {
+		// The lock must not be held while the taps are being closed.
+		// The consumers may need it to detach the closed taps.
+		s.mux.Lock()
+		s.isClosed = true
+		sources := s.sources
+		s.sources = make(map[string]*source)
+		s.mux.Unlock()
+
+		for _, src := range sources {
+			if src.tap.IsOpen() {
+				src.tap.Close()
+			}
 		}
-		// stop processing the work units event if
-		// the tap is still sending requests after it's closed
+		// stop processing the work units even if
+		// the taps are still sending requests after they're closed
 		close(s.done)
 		s.wg.Wait()
 		// Signal the engine that we are done
-		close(s.workList)
+		s.queue.close()
 	})
 }
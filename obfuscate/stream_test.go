@@ -1,6 +1,7 @@
 package obfuscate
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -8,21 +9,22 @@ import (
 func TestClosure(t *testing.T) {
 	tap := newMockedTap()
 	stream := newStream(1, tap)
-	closed := false
+	closed := make(chan None)
 	stream.open()
-	go func(closed *bool) {
-		<-stream.workList
-		*closed = true
-	}(&closed)
+	go func() {
+		stream.queue.pop(context.Background(), 0, nil)
+		close(closed)
+	}()
 
 	if !tap.IsOpen() {
 		t.Error("The tap was supposed to be open")
 	}
 
 	stream.shutdown()
-	time.Sleep(2 * time.Millisecond)
 
-	if !closed {
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
 		t.Error("The stream was supposed to be closed")
 	}
 
@@ -3,7 +3,7 @@ package obfuscate
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"errors"
+	"fmt"
 )
 
 // EncryptBytes encrypts a byte slice using a random crypto IV
@@ -28,9 +28,12 @@ func EncryptBytesFixed(key, text []byte) ([]byte, error) {
 }
 
 // DecryptBytes decrypts a string
+//
+// It returns ErrTruncated if the input is shorter than the IV, and ErrCorrupted if the decrypted
+// content is not valid, which happens when the input is damaged or has been encrypted using another key.
 func DecryptBytes(key, textBytes []byte) ([]byte, error) {
 	if len(textBytes) < aes.BlockSize {
-		return nil, errors.New("invalid encrypted bytes")
+		return nil, ErrTruncated
 	}
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -43,7 +46,7 @@ func DecryptBytes(key, textBytes []byte) ([]byte, error) {
 	data, err := b64Encoding.Decode(textBytes)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %s", ErrCorrupted, err)
 	}
 	return data, nil
 }
@@ -15,3 +15,20 @@ type Tap interface {
 	// Pipe returns the work list pipe attached to the tap
 	Pipe() WorkList
 }
+
+// RecoverableTap is the interface for the taps which are able to rebuild the work units
+// recorded in a Journal after the engine has been restarted.
+type RecoverableTap interface {
+	Tap
+	// Recover rebuilds the work unit from its journal entry.
+	// The engine calls this method for every pending entry of the journal before it opens the tap.
+	Recover(entry JournalEntry) (*WorkUnit, error)
+}
+
+// TransientTap is the interface for the taps whose work units must not be recorded in the Journal
+// (i.e. a one-off verification). The work units of a transient tap will not be recovered after a restart.
+type TransientTap interface {
+	Tap
+	// Transient returns true if the work units of the tap must not be recorded in the journal
+	Transient() bool
+}
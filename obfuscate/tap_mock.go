@@ -1,10 +1,10 @@
 package obfuscate
 
 type mockedTap struct {
-	pipe              WorkList
-	isOpen            bool
-	callbackCalled    bool
-	withCallback      bool
+	pipe           WorkList
+	isOpen         bool
+	callbackCalled bool
+	withCallback   bool
 }
 
 func newMockedTap() *mockedTap {
@@ -26,7 +26,7 @@ func (m *mockedTap) Open() {
 }
 
 func (m *mockedTap) Push(wUnits ...*WorkUnit) {
-	for _, wu := range wUnits{
+	for _, wu := range wUnits {
 		m.pipe <- wu
 	}
 }
@@ -34,3 +34,21 @@ func (m *mockedTap) Push(wUnits ...*WorkUnit) {
 func (m *mockedTap) Close() {
 	m.isOpen = false
 }
+
+type mockedRecoverableTap struct {
+	*mockedTap
+	recovered []JournalEntry
+	rebuild   func(entry JournalEntry) (*WorkUnit, error)
+}
+
+func newMockedRecoverableTap(rebuild func(entry JournalEntry) (*WorkUnit, error)) *mockedRecoverableTap {
+	return &mockedRecoverableTap{
+		mockedTap: newMockedTap(),
+		rebuild:   rebuild,
+	}
+}
+
+func (m *mockedRecoverableTap) Recover(entry JournalEntry) (*WorkUnit, error) {
+	m.recovered = append(m.recovered, entry)
+	return m.rebuild(entry)
+}
@@ -2,6 +2,7 @@ package obfuscate
 
 import (
 	"io"
+	"reflect"
 	"sync"
 )
 
@@ -13,8 +14,25 @@ const (
 	Encode Operation = iota
 	// Decode decryption mode
 	Decode
+	// Verify verification mode.
+	// The input will be decrypted to check its integrity, but the plaintext will be discarded.
+	// Nothing will be written to the outputs of a verification task.
+	Verify
 )
 
+// String returns the string representation of the operation
+func (o Operation) String() string {
+	switch o {
+	case Encode:
+		return "encode"
+	case Decode:
+		return "decode"
+	case Verify:
+		return "verify"
+	}
+	return "unknown"
+}
+
 // Task represents an encryption/decryption request
 type Task struct {
 	mode    Operation
@@ -22,6 +40,10 @@ type Task struct {
 	status  Status
 	outputs []io.Writer
 
+	// the original streams which have been wrapped
+	inputLayers  []io.Reader
+	outputLayers [][]io.Writer
+
 	mux        sync.Mutex
 	inProgress bool
 }
@@ -29,9 +51,10 @@ type Task struct {
 // NewTask creates a new Task object
 func NewTask(mode Operation, input io.Reader, output io.Writer) *Task {
 	return &Task{
-		mode:    mode,
-		input:   input,
-		outputs: []io.Writer{output},
+		mode:         mode,
+		input:        input,
+		outputs:      []io.Writer{output},
+		outputLayers: make([][]io.Writer, 1),
 
 		status: Queued,
 	}
@@ -46,6 +69,52 @@ func (t *Task) AddOutput(output io.Writer) error {
 		return ErrOperationInProgress
 	}
 	t.outputs = append(t.outputs, output)
+	t.outputLayers = append(t.outputLayers, nil)
+	return nil
+}
+
+// Mode returns the operation which needs to be done by the Task
+func (t *Task) Mode() Operation {
+	return t.mode
+}
+
+// WrapInput replaces the input Reader with the Reader returned by the wrap function.
+//
+// The wrapper receives the current input. Closing the input will close the wrapper (if it's an io.Closer)
+// as well as the original Reader.
+// Calling WrapInput() on an in-progress Task will return an error of type obfuscate.ErrOperationInProgress
+func (t *Task) WrapInput(wrap func(io.Reader) io.Reader) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.inProgress {
+		return ErrOperationInProgress
+	}
+	wrapped := wrap(t.input)
+	if !isSameStream(wrapped, t.input) {
+		t.inputLayers = append(t.inputLayers, t.input)
+		t.input = wrapped
+	}
+	return nil
+}
+
+// WrapOutputs replaces every output Writer with the Writer returned by the wrap function.
+//
+// The wrapper receives the current output. Closing the outputs will close the wrappers (if they are io.Closers)
+// before the original Writers, so that the wrappers can flush their content.
+// Calling WrapOutputs() on an in-progress Task will return an error of type obfuscate.ErrOperationInProgress
+func (t *Task) WrapOutputs(wrap func(io.Writer) io.Writer) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.inProgress {
+		return ErrOperationInProgress
+	}
+	for i, out := range t.outputs {
+		wrapped := wrap(out)
+		if !isSameStream(wrapped, out) {
+			t.outputLayers[i] = append(t.outputLayers[i], out)
+			t.outputs[i] = wrapped
+		}
+	}
 	return nil
 }
 
@@ -58,9 +127,15 @@ func (t *Task) CloseInput() error {
 	if t.inProgress {
 		return ErrOperationInProgress
 	}
-	input, ok := t.input.(io.Closer)
-	if ok && input != nil {
-		return input.Close()
+	err := closeStream(t.input)
+	if err != nil {
+		return err
+	}
+	for i := len(t.inputLayers) - 1; i >= 0; i-- {
+		err := closeStream(t.inputLayers[i])
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -75,10 +150,17 @@ func (t *Task) CloseOutputs() error {
 	if t.inProgress {
 		return ErrOperationInProgress
 	}
-	for _, out := range t.outputs {
-		output, ok := out.(io.Closer)
-		if ok && output != nil {
-			err := output.Close()
+	for i, out := range t.outputs {
+		err := closeStream(out)
+		if err != nil {
+			return err
+		}
+		if i >= len(t.outputLayers) {
+			continue
+		}
+		layers := t.outputLayers[i]
+		for j := len(layers) - 1; j >= 0; j-- {
+			err := closeStream(layers[j])
 			if err != nil {
 				return err
 			}
@@ -94,6 +176,17 @@ func (t *Task) Status() Status {
 	return t.status
 }
 
+// readers returns the input and the layers it wraps, from the outermost to the original Reader
+func (t *Task) readers() []io.Reader {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	readers := []io.Reader{t.input}
+	for i := len(t.inputLayers) - 1; i >= 0; i-- {
+		readers = append(readers, t.inputLayers[i])
+	}
+	return readers
+}
+
 func (t *Task) markAsInProgress() {
 	t.mux.Lock()
 	defer t.mux.Unlock()
@@ -106,3 +199,18 @@ func (t *Task) markAsComplete(status Status) {
 	t.status = status
 	t.inProgress = false
 }
+
+func closeStream(stream interface{}) error {
+	closer, ok := stream.(io.Closer)
+	if ok && closer != nil {
+		return closer.Close()
+	}
+	return nil
+}
+
+func isSameStream(a, b interface{}) bool {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	return a == nil || reflect.TypeOf(a).Comparable() && a == b
+}
@@ -1,6 +1,7 @@
 package obfuscate
 
 import (
+	"io"
 	"testing"
 
 	"github.com/mattetti/filebuffer"
@@ -85,3 +86,39 @@ func TestTaskCloseInputInProgress(t *testing.T) {
 		t.Errorf("Expected 'ErrOperationInProgress' as error, but received '%v'", err)
 	}
 }
+
+func TestTaskWrapStreams(t *testing.T) {
+	in := &ReadCloser{}
+	out := &WriteCloser{}
+	wrappedIn := &ReadCloser{}
+	wrappedOut := &WriteCloser{}
+
+	task := NewTask(Encode, in, out)
+	task.WrapInput(func(io.Reader) io.Reader {
+		return wrappedIn
+	})
+	task.WrapOutputs(func(io.Writer) io.Writer {
+		return wrappedOut
+	})
+
+	if task.input != wrappedIn || task.outputs[0] != wrappedOut {
+		t.Fatal("the streams were supposed to be wrapped")
+	}
+
+	task.CloseInput()
+	task.CloseOutputs()
+
+	if !in.IsClosed || !wrappedIn.IsClosed {
+		t.Error("both the input and its wrapper were supposed to get closed")
+	}
+
+	if !out.IsClosed || !wrappedOut.IsClosed {
+		t.Error("both the output and its wrapper were supposed to get closed")
+	}
+
+	task.markAsInProgress()
+	err := task.WrapInput(func(r io.Reader) io.Reader { return r })
+	if ErrOperationInProgress != err {
+		t.Errorf("Expected 'ErrOperationInProgress' as error, but received '%v'", err)
+	}
+}
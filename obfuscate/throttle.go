@@ -0,0 +1,243 @@
+package obfuscate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limit represents the maximum processing rate of an engine or a tap.
+// Zero values mean no limit.
+type Limit struct {
+	// BytesPerSecond the maximum number of input bytes processed per second
+	BytesPerSecond int64 `json:"bytes_per_second"`
+	// BytesBurst the maximum number of bytes which can be processed at once,
+	// without waiting for the rate. The default burst is one second worth of bytes.
+	BytesBurst int64 `json:"bytes_burst"`
+	// TasksPerSecond the maximum number of tasks started per second
+	TasksPerSecond float64 `json:"tasks_per_second"`
+	// TasksBurst the maximum number of tasks which can be started at once,
+	// without waiting for the rate. The default burst is one task.
+	TasksBurst int `json:"tasks_burst"`
+}
+
+// TimeWindow is a daily window of time, represented by the offsets since midnight (in local time).
+//
+// The windows which end before they start wrap around midnight. For example,
+// TimeWindow{From: 22 * time.Hour, To: 6 * time.Hour} represents 10pm to 6am.
+type TimeWindow struct {
+	From, To time.Duration
+}
+
+func (w TimeWindow) contains(t time.Time) bool {
+	year, month, day := t.Date()
+	offset := t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+	if w.From <= w.To {
+		return offset >= w.From && offset < w.To
+	}
+	return offset >= w.From || offset < w.To
+}
+
+// limiter throttles the number of bytes processed by a task
+type limiter interface {
+	waitBytes(ctx context.Context, n int) error
+}
+
+// throttle holds the global and per tap rate limits of an engine
+type throttle struct {
+	global  *rateLimit
+	taps    map[string]*rateLimit
+	offPeak []TimeWindow
+	now     func() time.Time
+
+	mux sync.RWMutex
+}
+
+// rateLimit is the combination of the bytes and tasks limits
+type rateLimit struct {
+	bytes *bucket
+	tasks *bucket
+}
+
+func newThrottle() *throttle {
+	return &throttle{
+		global: newRateLimit(),
+		taps:   make(map[string]*rateLimit),
+		now:    time.Now,
+	}
+}
+
+func newRateLimit() *rateLimit {
+	return &rateLimit{
+		bytes: &bucket{},
+		tasks: &bucket{},
+	}
+}
+
+func (r *rateLimit) set(limit Limit) {
+	// The default bytes burst is one second worth of bytes (See bucket.set)
+	r.bytes.set(float64(limit.BytesPerSecond), float64(limit.BytesBurst))
+	tasksBurst := limit.TasksBurst
+	if tasksBurst <= 0 {
+		tasksBurst = 1
+	}
+	r.tasks.set(limit.TasksPerSecond, float64(tasksBurst))
+}
+
+// setGlobal changes the global limit of the engine
+func (t *throttle) setGlobal(limit Limit) {
+	t.global.set(limit)
+}
+
+// setTap changes the limit of the specified tap
+func (t *throttle) setTap(name string, limit Limit) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	r, ok := t.taps[name]
+	if !ok {
+		r = newRateLimit()
+		t.taps[name] = r
+	}
+	r.set(limit)
+}
+
+// setOffPeak replaces the off-peak windows during which no limit applies
+func (t *throttle) setOffPeak(windows []TimeWindow) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.offPeak = windows
+}
+
+// waitTask blocks until the task of the specified tap is allowed to start
+func (t *throttle) waitTask(ctx context.Context, tap string) error {
+	if t.isOffPeak() {
+		return nil
+	}
+	err := t.global.tasks.take(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if r := t.tap(tap); r != nil {
+		return r.tasks.take(ctx, 1)
+	}
+	return nil
+}
+
+// forTap returns the bytes limiter of the specified tap
+func (t *throttle) forTap(tap string) limiter {
+	return &tapLimiter{
+		throttle: t,
+		tap:      tap,
+	}
+}
+
+func (t *throttle) tap(name string) *rateLimit {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	return t.taps[name]
+}
+
+func (t *throttle) isOffPeak() bool {
+	t.mux.RLock()
+	defer t.mux.RUnlock()
+	if len(t.offPeak) == 0 {
+		return false
+	}
+	now := t.now()
+	for _, w := range t.offPeak {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+type tapLimiter struct {
+	throttle *throttle
+	tap      string
+}
+
+func (l *tapLimiter) waitBytes(ctx context.Context, n int) error {
+	if l.throttle.isOffPeak() {
+		return nil
+	}
+	err := l.throttle.global.bytes.take(ctx, float64(n))
+	if err != nil {
+		return err
+	}
+	if r := l.throttle.tap(l.tap); r != nil {
+		return r.bytes.take(ctx, float64(n))
+	}
+	return nil
+}
+
+// bucket is a token bucket rate limiter
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	mux sync.Mutex
+}
+
+// set changes the rate and the burst of the bucket. Zero or negative rate disables the limit.
+// Zero or negative burst defaults to the rate (one second worth of tokens), but never less than one token.
+func (b *bucket) set(rate, burst float64) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if burst <= 0 {
+		burst = rate
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	b.rate = rate
+	b.burst = burst
+	b.tokens = burst
+	b.last = time.Now()
+}
+
+// take blocks until n tokens have been taken from the bucket, or the context is cancelled.
+// The requests bigger than the burst size are served in burst sized chunks.
+func (b *bucket) take(ctx context.Context, n float64) error {
+	for n > 0 {
+		b.mux.Lock()
+		if b.rate <= 0 {
+			b.mux.Unlock()
+			return nil
+		}
+
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		chunk := n
+		if chunk > b.burst {
+			chunk = b.burst
+		}
+
+		if b.tokens >= chunk {
+			b.tokens -= chunk
+			n -= chunk
+			b.mux.Unlock()
+			continue
+		}
+
+		wait := time.Duration((chunk - b.tokens) / b.rate * float64(time.Second))
+		b.mux.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
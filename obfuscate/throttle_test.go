@@ -0,0 +1,204 @@
+package obfuscate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mattetti/filebuffer"
+)
+
+func TestBucket(t *testing.T) {
+	testCases := []struct {
+		title       string
+		rate, burst float64
+		take        float64
+		minDuration time.Duration
+	}{
+		{
+			title: "unlimited_bucket_must_not_block",
+			take:  1000000,
+		},
+		{
+			title: "requests_within_the_burst_must_not_block",
+			rate:  10,
+			burst: 100,
+			take:  100,
+		},
+		{
+			title:       "requests_beyond_the_burst_must_wait_for_the_rate",
+			rate:        1000,
+			burst:       100,
+			take:        300,
+			minDuration: 200 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			b := &bucket{}
+			b.set(tc.rate, tc.burst)
+			start := time.Now()
+			err := b.take(context.Background(), tc.take)
+			if err != nil {
+				t.Fatalf("failed to take the tokens: %v", err)
+			}
+			elapsed := time.Since(start)
+			if elapsed < tc.minDuration {
+				t.Errorf("expected to wait for at least %v, actual %v", tc.minDuration, elapsed)
+			}
+			if tc.minDuration == 0 && elapsed > 50*time.Millisecond {
+				t.Errorf("expected not to wait, actual %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestBucketCancellation(t *testing.T) {
+	b := &bucket{}
+	b.set(1, 1)
+	b.take(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.take(ctx, 1); err == nil {
+		t.Error("expected the cancellation error")
+	}
+}
+
+func TestRateLimitDefaultBurst(t *testing.T) {
+	testCases := []struct {
+		title       string
+		limit       Limit
+		bytes       float64
+		tasks       float64
+		minDuration time.Duration
+	}{
+		{
+			title: "default_bytes_burst_must_be_one_second_worth_of_bytes",
+			limit: Limit{BytesPerSecond: 1000},
+			bytes: 1000,
+		},
+		{
+			title: "default_tasks_burst_must_be_one_task",
+			limit: Limit{TasksPerSecond: 10},
+			tasks: 2,
+			// The second task must wait for the rate
+			minDuration: 90 * time.Millisecond,
+		},
+		{
+			title: "explicit_tasks_burst_must_not_block",
+			limit: Limit{TasksPerSecond: 10, TasksBurst: 3},
+			tasks: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			r := newRateLimit()
+			r.set(tc.limit)
+			start := time.Now()
+			if err := r.bytes.take(context.Background(), tc.bytes); err != nil {
+				t.Fatalf("failed to take the bytes: %v", err)
+			}
+			if err := r.tasks.take(context.Background(), tc.tasks); err != nil {
+				t.Fatalf("failed to take the tasks: %v", err)
+			}
+			elapsed := time.Since(start)
+			if elapsed < tc.minDuration {
+				t.Errorf("expected to wait for at least %v, actual %v", tc.minDuration, elapsed)
+			}
+			if tc.minDuration == 0 && elapsed > 50*time.Millisecond {
+				t.Errorf("expected not to wait, actual %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2020, 1, 1, hour, 30, 0, 0, time.Local)
+	}
+
+	testCases := []struct {
+		title    string
+		window   TimeWindow
+		time     time.Time
+		expected bool
+	}{
+		{
+			title:    "inside_a_window",
+			window:   TimeWindow{From: 1 * time.Hour, To: 5 * time.Hour},
+			time:     at(2),
+			expected: true,
+		},
+		{
+			title:  "outside_a_window",
+			window: TimeWindow{From: 1 * time.Hour, To: 5 * time.Hour},
+			time:   at(6),
+		},
+		{
+			title:    "inside_a_window_before_midnight",
+			window:   TimeWindow{From: 22 * time.Hour, To: 6 * time.Hour},
+			time:     at(23),
+			expected: true,
+		},
+		{
+			title:    "inside_a_window_after_midnight",
+			window:   TimeWindow{From: 22 * time.Hour, To: 6 * time.Hour},
+			time:     at(3),
+			expected: true,
+		},
+		{
+			title:  "outside_a_window_wrapping_around_midnight",
+			window: TimeWindow{From: 22 * time.Hour, To: 6 * time.Hour},
+			time:   at(12),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			if actual := tc.window.contains(tc.time); actual != tc.expected {
+				t.Errorf("expected %v, actual %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestThrottleOffPeak(t *testing.T) {
+	th := newThrottle()
+	th.setGlobal(Limit{BytesPerSecond: 1, BytesBurst: 1})
+	th.setOffPeak([]TimeWindow{{From: 0, To: 24 * time.Hour}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := th.forTap(DefaultTapName).waitBytes(ctx, 100); err != nil {
+		t.Errorf("the limits must not be applied off-peak: %v", err)
+	}
+
+	th.setOffPeak(nil)
+	if err := th.forTap(DefaultTapName).waitBytes(ctx, 100); err == nil {
+		t.Error("the limits must be applied outside the off-peak windows")
+	}
+}
+
+func TestEngineTapLimit(t *testing.T) {
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	engine.SetTapLimit(DefaultTapName, Limit{BytesPerSecond: 1000, BytesBurst: 100})
+	engine.Start()
+	defer engine.Stop()
+
+	master, _ := KeyFromPassword("password")
+	done := make(chan None)
+	task := NewTask(Encode, filebuffer.New(make([]byte, 300)), filebuffer.New(nil))
+	start := time.Now()
+	tap.Push(NewWorkUnit(task, master, func(*WorkUnit) {
+		close(done)
+	}))
+	<-done
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected the task to be throttled, but it took %v", elapsed)
+	}
+}
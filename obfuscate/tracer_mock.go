@@ -0,0 +1,51 @@
+package obfuscate
+
+import (
+	"context"
+	"sync"
+)
+
+type mockedSpan struct {
+	name       string
+	parent     context.Context
+	attributes map[string]interface{}
+	ended      bool
+	err        error
+}
+
+func (m *mockedSpan) SetAttribute(key string, value interface{}) {
+	m.attributes[key] = value
+}
+
+func (m *mockedSpan) End(err error) {
+	m.ended = true
+	m.err = err
+}
+
+type mockedTracer struct {
+	spans []*mockedSpan
+	mux   sync.Mutex
+}
+
+func (m *mockedTracer) Start(ctx context.Context, name string, w *WorkUnit) (context.Context, Span) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	span := &mockedSpan{
+		name:       name,
+		parent:     w.Context(),
+		attributes: make(map[string]interface{}),
+	}
+	m.spans = append(m.spans, span)
+	return ctx, span
+}
+
+func (m *mockedTracer) find(name string) *mockedSpan {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for _, span := range m.spans {
+		if span.name == name {
+			return span
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package obfuscate
+
+import "context"
+
+// The names of the spans created by the engine and the taps
+const (
+	// SpanDispatch the dispatch of a work unit by a tap
+	SpanDispatch = "xvault.dispatch"
+	// SpanQueue the time a work unit waits in the engine's queue
+	SpanQueue = "xvault.queue"
+	// SpanProcess the prefix of the spans of the task processing (i.e. xvault.encode)
+	SpanProcess = "xvault."
+)
+
+// Tracer is the hook to trace the life cycle of the work units.
+// See the tracing package for an OpenTelemetry implementation.
+type Tracer interface {
+	// Start starts a new span for the work unit.
+	//
+	// The span must be a child of the trace carried by the work unit (See WorkUnit.Context)
+	// and the returned context, which is derived from ctx, must carry the new span.
+	Start(ctx context.Context, name string, w *WorkUnit) (context.Context, Span)
+}
+
+// Span is a traced operation
+type Span interface {
+	// SetAttribute sets an attribute of the span
+	SetAttribute(key string, value interface{})
+	// End ends the span. A non-nil error marks the span as failed.
+	End(err error)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ *WorkUnit) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+
+func (noopSpan) End(error) {}
+
+// NoopTracer returns a tracer which does not record anything
+func NoopTracer() Tracer {
+	return noopTracer{}
+}
+
+// startSpan starts a span for the work unit with the common attributes
+func startSpan(ctx context.Context, tracer Tracer, name string, w *WorkUnit) (context.Context, Span) {
+	ctx, span := tracer.Start(ctx, name, w)
+	span.SetAttribute(LogKeyUnit, w.ID)
+	if w.Tap != "" {
+		span.SetAttribute(LogKeyTap, w.Tap)
+	}
+	if w.Task != nil {
+		span.SetAttribute(LogKeyMode, w.Task.mode.String())
+	}
+	return ctx, span
+}
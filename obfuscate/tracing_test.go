@@ -0,0 +1,78 @@
+package obfuscate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattetti/filebuffer"
+)
+
+type traceKey struct{}
+
+func TestEngineTracer(t *testing.T) {
+	tracer := &mockedTracer{}
+	tap := newMockedTap()
+	engine := newTestEngine(t, tap, WithQueueSize(1))
+	if err := engine.SetTracer(tracer); err != nil {
+		t.Fatalf("failed to set the tracer: %v", err)
+	}
+	engine.Start()
+
+	master, _ := KeyFromPassword("password")
+	done := make(chan None)
+	task := NewTask(Encode, filebuffer.New(make([]byte, 100)), filebuffer.New(nil))
+	w := NewWorkUnit(task, master, func(*WorkUnit) {
+		close(done)
+	})
+	w.SetContext(context.WithValue(context.Background(), traceKey{}, "upstream"))
+	tap.Push(w)
+	<-done
+
+	if err := engine.SetTracer(tracer); err != ErrOperationInProgress {
+		t.Errorf("expected '%v' as error, but received '%v'", ErrOperationInProgress, err)
+	}
+	engine.Stop()
+
+	testCases := []struct {
+		title         string
+		span          string
+		expectedBytes interface{}
+	}{
+		{
+			title: "queue_span",
+			span:  SpanQueue,
+		},
+		{
+			title:         "process_span",
+			span:          SpanProcess + "encode",
+			expectedBytes: int64(100),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			span := tracer.find(tc.span)
+			if span == nil {
+				t.Fatalf("expected the '%s' span to be recorded", tc.span)
+			}
+			if !span.ended {
+				t.Error("expected the span to be ended")
+			}
+			if span.err != nil {
+				t.Errorf("expected no error, but received '%v'", span.err)
+			}
+			if span.parent.Value(traceKey{}) != "upstream" {
+				t.Error("expected the span to continue the trace of the work unit")
+			}
+			if span.attributes[LogKeyUnit] != w.ID {
+				t.Errorf("expected '%s' as the unit ID, actual '%v'", w.ID, span.attributes[LogKeyUnit])
+			}
+			if span.attributes[LogKeyTap] != DefaultTapName {
+				t.Errorf("expected '%s' as the tap, actual '%v'", DefaultTapName, span.attributes[LogKeyTap])
+			}
+			if span.attributes[LogKeyBytes] != tc.expectedBytes {
+				t.Errorf("expected '%v' bytes, actual '%v'", tc.expectedBytes, span.attributes[LogKeyBytes])
+			}
+		})
+	}
+}
@@ -1,7 +1,19 @@
 package obfuscate
 
+import (
+	"context"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/NebulousLabs/fastrand"
+)
+
 // CallbackFunc is a callback function which will get called by the engine once
 // the processing of a work unit has been finished.
+//
+// The callback runs on the engine's worker, so a slow callback stalls the processing.
+// Subscribe to the engine events if you need to observe the work units asynchronously (See Engine.Subscribe).
 type CallbackFunc func(*WorkUnit)
 
 // MetadataMap the map of custom data
@@ -9,10 +21,35 @@ type MetadataMap map[string]interface{}
 
 // WorkUnit is a unit of encryption/decryption work
 type WorkUnit struct {
-	master   *MasterKey
-	callback CallbackFunc
+	master    *MasterKey
+	callback  CallbackFunc
+	cancelled int32
+	// the trace context of the work unit
+	ctx context.Context
+	// the span of the time the unit spends in the queue
+	queueSpan Span
+	// the unit is not recorded in the journal (See TransientTap)
+	transient bool
+	// ID the unique identifier of the work unit
+	ID string
 	// Task the task which needs to be processed
 	Task *Task
+	// Priority the scheduling priority of the work unit.
+	// The units with higher priorities will be served first.
+	Priority int
+	// Size the size of the input in bytes (if known).
+	// The engine uses the size to pick the scheduling lane of the unit.
+	Size int64
+	// Tap the name of the tap which has dispatched the work unit.
+	// It will be set by the engine once the unit has been received.
+	Tap string
+	// Deadline the time by which the processing of the work unit must be finished.
+	// The unit will fail with context.DeadlineExceeded error if it's still in progress after the deadline.
+	// Zero means the engine's default timeout (if any) will be applied. See Engine.SetTimeout.
+	Deadline time.Time
+	// Bytes the number of input bytes which have been processed.
+	// It will be set by the engine before the callback gets called.
+	Bytes int64
 	// Metadata custom data
 	Metadata MetadataMap
 	// Error the error happened during the processing of the task.
@@ -23,6 +60,7 @@ type WorkUnit struct {
 // NewWorkUnit creates a new work unit
 func NewWorkUnit(t *Task, master *MasterKey, callback CallbackFunc) *WorkUnit {
 	return &WorkUnit{
+		ID:       newID(),
 		Task:     t,
 		master:   master,
 		callback: callback,
@@ -30,8 +68,49 @@ func NewWorkUnit(t *Task, master *MasterKey, callback CallbackFunc) *WorkUnit {
 	}
 }
 
+// Context returns the context which carries the trace of the work unit (if any).
+// It never returns nil.
+func (w *WorkUnit) Context() context.Context {
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
+}
+
+// SetContext sets the context which carries the trace of the work unit.
+//
+// The taps which receive the work from upstream services (i.e. HTTP requests or messages) can set the
+// upstream context, so that the spans of the work unit continue the upstream trace (See Engine.SetTracer).
+// The context is only used for tracing. Its cancellation has no effect on the processing of the work unit.
+func (w *WorkUnit) SetContext(ctx context.Context) {
+	w.ctx = ctx
+}
+
 func (w *WorkUnit) callBack() {
 	if w.callback != nil {
 		w.callback(w)
 	}
 }
+
+func (w *WorkUnit) cancel() {
+	atomic.StoreInt32(&w.cancelled, 1)
+}
+
+func (w *WorkUnit) isCancelled() bool {
+	return atomic.LoadInt32(&w.cancelled) == 1
+}
+
+func (w *WorkUnit) journalEntry(event JournalEvent) JournalEntry {
+	return JournalEntry{
+		ID:       w.ID,
+		Tap:      w.Tap,
+		Event:    event,
+		Mode:     w.Task.mode,
+		Status:   w.Task.Status(),
+		Metadata: w.Metadata,
+	}
+}
+
+func newID() string {
+	return hex.EncodeToString(fastrand.Bytes(16))
+}
@@ -0,0 +1,61 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// tempFileSuffix is the suffix of the temporary output files.
+// The temporary files are hidden, so that the other taps watching the target directory ignore them.
+const tempFileSuffix = ".tmp"
+
+// tempFile is an output file which is being written under a temporary name (See createTempFile).
+// Its content will be flushed to the disk when it gets closed.
+type tempFile struct {
+	*os.File
+}
+
+// createTempFile creates a uniquely named temporary file next to the final output path
+// (i.e. ".name.xv.123456.tmp"), so that the outputs of the same name never share a temporary file.
+// The file is only accessible by the owner (See outputFileMode). Its path is returned by Name.
+func createTempFile(path string) (*tempFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+tempFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(outputFileMode); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &tempFile{File: file}, nil
+}
+
+// Close flushes the content of the file to the disk and closes it
+func (t *tempFile) Close() error {
+	if err := t.File.Sync(); err != nil {
+		t.File.Close()
+		return err
+	}
+	return t.File.Close()
+}
+
+// commitFile atomically moves the temporary file to its final path
+func commitFile(temp, path string) error {
+	if err := os.Rename(temp, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir flushes the directory entries to the disk, so that a committed file survives a crash.
+// Directories cannot be synced on some platforms, so the errors are ignored.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	dir.Sync()
+	dir.Close()
+}
@@ -0,0 +1,56 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateTempFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt.xv")
+
+	first, err := createTempFile(path)
+	if err != nil {
+		t.Fatalf("failed to create the temporary file: %v", err)
+	}
+	defer first.Close()
+	second, err := createTempFile(path)
+	if err != nil {
+		t.Fatalf("failed to create the temporary file: %v", err)
+	}
+	defer second.Close()
+
+	if first.Name() == second.Name() {
+		t.Errorf("expected the temporary files of the same output to be unique, actual '%s'", first.Name())
+	}
+	for _, temp := range []*tempFile{first, second} {
+		name := filepath.Base(temp.Name())
+		if !strings.HasPrefix(name, ".file.txt.xv.") || !strings.HasSuffix(name, tempFileSuffix) {
+			t.Errorf("expected a hidden temporary file of the output, actual '%s'", name)
+		}
+		info, err := temp.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != outputFileMode {
+			t.Errorf("expected '%v' as the mode, actual '%v'", outputFileMode, info.Mode().Perm())
+		}
+	}
+
+	if _, err := first.WriteString("content"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := commitFile(first.Name(), path); err != nil {
+		t.Fatalf("failed to commit the temporary file: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "content" {
+		t.Errorf("expected the committed content, actual '%s' (%v)", content, err)
+	}
+	if _, err := os.Stat(second.Name()); err != nil {
+		t.Errorf("expected the other temporary file to be intact, actual '%v'", err)
+	}
+}
@@ -0,0 +1,180 @@
+package taps
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+const (
+	// attributesKeyPurpose is the purpose of the key derived from the master key to encrypt the attributes
+	attributesKeyPurpose = "xvault/attributes"
+	// attributesSuffix is the suffix of the hidden files which hold the attributes of the outputs
+	attributesSuffix = ".meta"
+	// outputFileMode is the permissions of the output files and the decrypted files without attributes
+	outputFileMode os.FileMode = 0600
+	// targetDirMode is the permissions of the directories created by the tap
+	targetDirMode os.FileMode = 0700
+)
+
+// fileAttributes is the metadata of an input file or directory which will be restored by the decrypting taps
+type fileAttributes struct {
+	Mode os.FileMode `json:"mode"`
+	// Owner is false if the ownership is not supported by the platform
+	Owner  bool              `json:"owner"`
+	UID    int               `json:"uid"`
+	GID    int               `json:"gid"`
+	ATime  time.Time         `json:"atime"`
+	MTime  time.Time         `json:"mtime"`
+	XAttrs map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// captureAttributes reads the attributes of the file or directory.
+// The access time will be the time the attributes have been captured, if the file has been read since.
+func captureAttributes(path string) (*fileAttributes, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &fileAttributes{
+		Mode:  info.Mode().Perm(),
+		ATime: info.ModTime(),
+		MTime: info.ModTime(),
+	}
+	if err := a.captureSystem(path); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// apply restores the attributes on the file or directory.
+// The ownership and the extended attributes which need more privileges than the process has will be skipped.
+func (a *fileAttributes) apply(path string) error {
+	if err := a.applySystem(path); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, a.Mode); err != nil {
+		return err
+	}
+	return os.Chtimes(path, a.ATime, a.MTime)
+}
+
+// attributesPath returns the path to the hidden file which holds the attributes of the output
+func attributesPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+attributesSuffix)
+}
+
+// saveAttributes encrypts the attributes into the attributes file of the output
+func saveAttributes(key []byte, output string, a *fileAttributes) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	encrypted, err := obfuscate.EncryptBytes(key, data)
+	if err != nil {
+		return err
+	}
+	file, err := createTempFile(attributesPath(output))
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(encrypted)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = commitFile(file.Name(), attributesPath(output))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// loadAttributes decrypts the attributes of the encoded file. It returns nil if the file has no attributes.
+func loadAttributes(key []byte, path string) (*fileAttributes, error) {
+	encrypted, err := os.ReadFile(attributesPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data, err := obfuscate.DecryptBytes(key, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	var a fileAttributes
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// dirRestorer restores the attributes of the decrypted directories. The attributes of a directory are applied
+// once its last in-progress output has been committed (deepest first), so that a read-only directory does not
+// reject the outputs, and the outputs being added to it do not reset its timestamps.
+type dirRestorer struct {
+	root string
+	// the attributes by directory
+	attrs map[string]*fileAttributes
+	// the number of the in-progress outputs by directory
+	units map[string]int
+	mux   sync.Mutex
+}
+
+func newDirRestorer(root string) *dirRestorer {
+	return &dirRestorer{
+		root:  root,
+		attrs: make(map[string]*fileAttributes),
+		units: make(map[string]int),
+	}
+}
+
+// record records the attributes of the directory which will be applied once it gets released
+func (r *dirRestorer) record(dir string, a *fileAttributes) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.attrs[dir] = a
+}
+
+// acquire keeps the directory writable by the owner until all its outputs have been released
+func (r *dirRestorer) acquire(dir string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.attrs[dir]; ok && r.units[dir] == 0 {
+		if err := os.Chmod(dir, targetDirMode); err != nil {
+			return err
+		}
+	}
+	r.units[dir]++
+	return nil
+}
+
+// release releases the directories of the output, and restores the attributes of the directories
+// which have no more outputs in progress, deepest first. It returns the first error.
+func (r *dirRestorer) release(output string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var first error
+	for dir := filepath.Dir(output); dir != r.root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, ok := r.units[dir]; !ok {
+			continue
+		}
+		if r.units[dir]--; r.units[dir] > 0 {
+			continue
+		}
+		delete(r.units, dir)
+		if a, ok := r.attrs[dir]; ok {
+			if err := a.apply(dir); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
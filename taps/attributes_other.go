@@ -0,0 +1,27 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package taps
+
+import (
+	"os"
+	"time"
+)
+
+// captureSystem does nothing on the platforms without the Unix ownership and extended attributes
+func (a *fileAttributes) captureSystem(path string) error {
+	return nil
+}
+
+// accessTime returns the modification time of the file on the platforms without the access time (See captureAttributes)
+func accessTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// applySystem does nothing on the platforms without the Unix ownership and extended attributes
+func (a *fileAttributes) applySystem(path string) error {
+	return nil
+}
@@ -0,0 +1,105 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package taps
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// captureSystem reads the ownership, the access time and the extended attributes of the file
+func (a *fileAttributes) captureSystem(path string) error {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return err
+	}
+	a.Owner, a.UID, a.GID = true, int(st.Uid), int(st.Gid)
+	a.ATime = time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+
+	names, err := listXattrs(path)
+	if err != nil {
+		if isUnsupported(err) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err != nil {
+			// The attribute has been removed since it was listed, or it cannot be read by the process
+			continue
+		}
+		if a.XAttrs == nil {
+			a.XAttrs = make(map[string][]byte)
+		}
+		a.XAttrs[name] = value
+	}
+	return nil
+}
+
+// accessTime returns the last access time of the file
+func accessTime(path string) (time.Time, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec)), nil
+}
+
+// applySystem restores the ownership and the extended attributes of the file
+func (a *fileAttributes) applySystem(path string) error {
+	if a.Owner {
+		if err := os.Lchown(path, a.UID, a.GID); err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	for name, value := range a.XAttrs {
+		if err := unix.Setxattr(path, name, value, 0); err != nil {
+			if isUnsupported(err) || errors.Is(err, os.ErrPermission) {
+				continue
+			}
+			return &os.PathError{Op: "setxattr", Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+func isUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
@@ -0,0 +1,98 @@
+package taps
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// closeWriteNotifier reports the files which have been closed by their writers (IN_CLOSE_WRITE)
+type closeWriteNotifier struct {
+	fd      int
+	file    *os.File
+	events  chan string
+	done    chan struct{}
+	watches map[int32]string
+	paths   map[string]int32
+	mux     sync.Mutex
+}
+
+func newCloseWriteNotifier() (*closeWriteNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	n := &closeWriteNotifier{
+		fd: fd,
+		// The non-blocking descriptor gets registered with the runtime poller,
+		// so that closing the file interrupts the pending reads.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan string),
+		done:    make(chan struct{}),
+		watches: make(map[int32]string),
+		paths:   make(map[string]int32),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *closeWriteNotifier) watch(path string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, path, syscall.IN_CLOSE_WRITE)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	n.watches[int32(wd)] = path
+	n.paths[path] = int32(wd)
+	return nil
+}
+
+func (n *closeWriteNotifier) unwatch(path string) {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	wd, ok := n.paths[path]
+	if !ok {
+		return
+	}
+	delete(n.paths, path)
+	delete(n.watches, wd)
+	syscall.InotifyRmWatch(n.fd, uint32(wd))
+}
+
+func (n *closeWriteNotifier) close() {
+	close(n.done)
+	n.file.Close()
+}
+
+func (n *closeWriteNotifier) read() {
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		size, err := n.file.Read(buffer)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			wd := int32(binary.NativeEndian.Uint32(buffer[offset:]))
+			mask := binary.NativeEndian.Uint32(buffer[offset+4:])
+			length := binary.NativeEndian.Uint32(buffer[offset+12:])
+			offset += syscall.SizeofInotifyEvent + int(length)
+
+			if mask&syscall.IN_CLOSE_WRITE == 0 {
+				continue
+			}
+			n.mux.Lock()
+			path, ok := n.watches[wd]
+			n.mux.Unlock()
+			if !ok {
+				continue
+			}
+			select {
+			case n.events <- path:
+			case <-n.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package taps
+
+import "errors"
+
+// closeWriteNotifier reports the files which have been closed by their writers.
+// It's only supported on Linux.
+type closeWriteNotifier struct {
+	events chan string
+}
+
+func newCloseWriteNotifier() (*closeWriteNotifier, error) {
+	return nil, errors.New("close-write notifications are not supported")
+}
+
+func (n *closeWriteNotifier) watch(path string) error {
+	return nil
+}
+
+func (n *closeWriteNotifier) unwatch(path string) {}
+
+func (n *closeWriteNotifier) close() {}
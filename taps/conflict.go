@@ -0,0 +1,241 @@
+package taps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// conflictTimestampLayout is the layout of the timestamp suffix (See ConflictTimestamp)
+	conflictTimestampLayout = "20060102T150405Z"
+	// conflictSeparator separates the conflict suffix from the name of the output (i.e. name-1.xv)
+	conflictSeparator = "-"
+	// sealedConflictSeparator separates the conflict suffix from an encrypted name (i.e. TOKEN.1.xv).
+	// The encrypted names never contain a dot, so the suffix can be stripped before decryption.
+	sealedConflictSeparator = "."
+	// maxConflictSuffixLength is the maximum number of bytes a conflict suffix adds to the name of an output
+	maxConflictSuffixLength = len(".") + len(conflictTimestampLayout) + len(".4294967295")
+)
+
+// ConflictPolicy specifies what happens to a new output whose target file already exists
+type ConflictPolicy int8
+
+const (
+	// ConflictOverwrite replaces the existing target file with the new output
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictSkip discards the new output and keeps the existing target file.
+	// The input file will not be deleted (See WithDeleteCompleted).
+	ConflictSkip
+	// ConflictRename stores the new output next to the existing file with a counter suffix (i.e. name-1.xv)
+	ConflictRename
+	// ConflictTimestamp stores the new output next to the existing file with a UTC timestamp suffix (i.e. name-20060102T150405Z.xv)
+	//
+	// If the names are encrypted (See WithNameEncryption), the rename and the timestamp suffixes are separated
+	// from the encrypted name by a dot (i.e. TOKEN.1.xv), and get restored on the decrypted names (i.e. name-1).
+	ConflictTimestamp
+	// ConflictVersion moves the existing target file into the versioned history (i.e. name.xv.1 being the latest)
+	// and stores the new output under the original name. See WithVersionRetention.
+	ConflictVersion
+)
+
+// String returns the string representation of the policy
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictOverwrite:
+		return "overwrite"
+	case ConflictSkip:
+		return "skip"
+	case ConflictRename:
+		return "rename"
+	case ConflictTimestamp:
+		return "timestamp"
+	case ConflictVersion:
+		return "version"
+	}
+	return "unknown"
+}
+
+// MarshalText returns the text representation of the policy
+func (p ConflictPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText parses the text representation of the policy (i.e. "version")
+func (p *ConflictPolicy) UnmarshalText(text []byte) error {
+	for policy := ConflictOverwrite; policy <= ConflictVersion; policy++ {
+		if policy.String() == string(text) {
+			*p = policy
+			return nil
+		}
+	}
+	return invalidConfig("unknown conflict policy '%s'", text)
+}
+
+// Conflict represents the decision which has been made about an output whose target file already existed
+type Conflict struct {
+	// Existed is true if the target file already existed
+	Existed bool
+	// Policy the policy which has been applied
+	Policy ConflictPolicy
+	// Skipped is true if the new output has been discarded (See ConflictSkip)
+	Skipped bool
+	// Previous the path to which the existing target file has been moved (See ConflictVersion)
+	Previous string
+}
+
+// conflictResolver moves the temporary outputs to their final place based on the conflict policy.
+// The commits are serialised, so that the outputs of the tap never overwrite each other's target files.
+type conflictResolver struct {
+	policy ConflictPolicy
+	// the maximum number of the previous versions to keep. Zero means no limit.
+	retention int
+	// the separator of the rename and the timestamp suffixes
+	separator string
+	mux       sync.Mutex
+}
+
+func newConflictResolver(policy ConflictPolicy, retention int) *conflictResolver {
+	return &conflictResolver{
+		policy:    policy,
+		retention: retention,
+		separator: conflictSeparator,
+	}
+}
+
+// commit moves the temporary file to the output path. It returns the final path of the output
+// which might be different from the requested path, and the conflict details.
+func (c *conflictResolver) commit(temp, output string) (string, Conflict, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if _, err := os.Lstat(output); os.IsNotExist(err) {
+		return output, Conflict{}, commitFile(temp, output)
+	} else if err != nil {
+		return output, Conflict{}, err
+	}
+
+	conflict := Conflict{
+		Existed: true,
+		Policy:  c.policy,
+	}
+
+	switch c.policy {
+	case ConflictSkip:
+		conflict.Skipped = true
+		return output, conflict, os.Remove(temp)
+	case ConflictRename:
+		output = freePath(output, "", c.separator)
+	case ConflictTimestamp:
+		output = freePath(output, time.Now().UTC().Format(conflictTimestampLayout), c.separator)
+	case ConflictVersion:
+		previous, err := c.rotate(output)
+		if err != nil {
+			return output, conflict, err
+		}
+		conflict.Previous = previous
+	}
+	return output, conflict, commitFile(temp, output)
+}
+
+// rotate moves the existing file into the versioned history and drops the versions beyond the retention limit.
+// The attributes file of every version gets moved (or removed) along with it (See WithPreserveAttributes).
+// It returns the path to which the existing file has been moved.
+func (c *conflictResolver) rotate(path string) (string, error) {
+	// The first free slot of the history
+	n := 1
+	for fileExists(versionPath(path, n)) {
+		n++
+	}
+	if c.retention > 0 && n > c.retention {
+		for v := c.retention; v < n; v++ {
+			if err := removeVersion(versionPath(path, v)); err != nil {
+				return "", err
+			}
+		}
+		n = c.retention
+	}
+	for v := n - 1; v >= 1; v-- {
+		if err := moveVersion(versionPath(path, v), versionPath(path, v+1)); err != nil {
+			return "", err
+		}
+	}
+	previous := versionPath(path, 1)
+	if err := moveVersion(path, previous); err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+// moveVersion renames the file along with its attributes file (if any)
+func moveVersion(from, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	if err := os.Rename(attributesPath(from), attributesPath(to)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeVersion removes the file along with its attributes file (if any)
+func removeVersion(path string) error {
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := os.Remove(attributesPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// versionPath returns the path to the nth previous version of the file (i.e. name.xv.1)
+func versionPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// freePath returns the first path with the suffix (and a counter if needed) which does not exist.
+// i.e. name-1.xv, name-2.xv or name-20060102T150405Z.xv, name-20060102T150405Z-2.xv
+func freePath(path, suffix, separator string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	if suffix != "" {
+		base += separator + suffix
+		if candidate := base + ext; !fileExists(candidate) {
+			return candidate
+		}
+	}
+	counter := 1
+	if suffix != "" {
+		counter = 2
+	}
+	for ; ; counter++ {
+		candidate := fmt.Sprintf("%s%s%d%s", base, separator, counter, ext)
+		if !fileExists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// splitConflictSuffix splits an encrypted name into the encrypted token and the conflict suffix
+// which has been added to the token (i.e. "TOKEN.1" or "TOKEN.20060102T150405Z.2").
+func splitConflictSuffix(name string) (string, string) {
+	if i := strings.Index(name, sealedConflictSeparator); i >= 0 {
+		return name[:i], name[i:]
+	}
+	return name, ""
+}
+
+// withConflictSuffix adds the conflict suffix of an encrypted name to the decrypted name,
+// so that the decrypted outputs get the same names as the outputs of the plain names (i.e. name.txt-1).
+func withConflictSuffix(name, suffix string) string {
+	return name + strings.ReplaceAll(suffix, sealedConflictSeparator, conflictSeparator)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,146 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConflictResolver(t *testing.T) {
+	testCases := []struct {
+		title     string
+		policy    ConflictPolicy
+		retention int
+		// the existing files of the target directory by name
+		existing map[string]string
+		// the expected files of the target directory by name after the commit
+		expected        map[string]string
+		expectedPath    string
+		expectedSkipped bool
+		expectedPrev    string
+	}{
+		{
+			title:        "no_conflict",
+			policy:       ConflictSkip,
+			expected:     map[string]string{"file.xv": "new"},
+			expectedPath: "file.xv",
+		},
+		{
+			title:        "overwrite",
+			policy:       ConflictOverwrite,
+			existing:     map[string]string{"file.xv": "old"},
+			expected:     map[string]string{"file.xv": "new"},
+			expectedPath: "file.xv",
+		},
+		{
+			title:           "skip",
+			policy:          ConflictSkip,
+			existing:        map[string]string{"file.xv": "old"},
+			expected:        map[string]string{"file.xv": "old"},
+			expectedPath:    "file.xv",
+			expectedSkipped: true,
+		},
+		{
+			title:        "rename",
+			policy:       ConflictRename,
+			existing:     map[string]string{"file.xv": "old", "file-1.xv": "older"},
+			expected:     map[string]string{"file.xv": "old", "file-1.xv": "older", "file-2.xv": "new"},
+			expectedPath: "file-2.xv",
+		},
+		{
+			title:        "version",
+			policy:       ConflictVersion,
+			existing:     map[string]string{"file.xv": "v3", "file.xv.1": "v2", "file.xv.2": "v1"},
+			expected:     map[string]string{"file.xv": "new", "file.xv.1": "v3", "file.xv.2": "v2", "file.xv.3": "v1"},
+			expectedPath: "file.xv",
+			expectedPrev: "file.xv.1",
+		},
+		{
+			title:        "version_with_retention",
+			policy:       ConflictVersion,
+			retention:    2,
+			existing:     map[string]string{"file.xv": "v3", "file.xv.1": "v2", "file.xv.2": "v1"},
+			expected:     map[string]string{"file.xv": "new", "file.xv.1": "v3", "file.xv.2": "v2"},
+			expectedPath: "file.xv",
+			expectedPrev: "file.xv.1",
+		},
+		{
+			title:        "version_with_attributes",
+			policy:       ConflictVersion,
+			retention:    2,
+			existing:     map[string]string{"file.xv": "v3", ".file.xv.meta": "a3", "file.xv.1": "v2", ".file.xv.1.meta": "a2", "file.xv.2": "v1", ".file.xv.2.meta": "a1"},
+			expected:     map[string]string{"file.xv": "new", "file.xv.1": "v3", ".file.xv.1.meta": "a3", "file.xv.2": "v2", ".file.xv.2.meta": "a2"},
+			expectedPath: "file.xv",
+			expectedPrev: "file.xv.1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tc.existing {
+				if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			output := filepath.Join(root, "file.xv")
+			temp := writeTemp(t, output, "new")
+
+			path, conflict, err := newConflictResolver(tc.policy, tc.retention).commit(temp, output)
+			if err != nil {
+				t.Fatalf("expected no error, but received '%v'", err)
+			}
+			if expected := filepath.Join(root, tc.expectedPath); path != expected {
+				t.Errorf("expected '%s' as the output, actual '%s'", expected, path)
+			}
+			if conflict.Existed != (len(tc.existing) > 0) {
+				t.Errorf("expected the existed flag to be %v, actual %v", len(tc.existing) > 0, conflict.Existed)
+			}
+			if conflict.Skipped != tc.expectedSkipped {
+				t.Errorf("expected the skipped flag to be %v, actual %v", tc.expectedSkipped, conflict.Skipped)
+			}
+			if tc.expectedPrev != "" && conflict.Previous != filepath.Join(root, tc.expectedPrev) {
+				t.Errorf("expected '%s' as the previous version, actual '%s'", tc.expectedPrev, conflict.Previous)
+			}
+
+			entries, err := os.ReadDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(tc.expected) {
+				t.Errorf("expected %d files in the target directory, actual %d", len(tc.expected), len(entries))
+			}
+			for name, expected := range tc.expected {
+				if content, _ := os.ReadFile(filepath.Join(root, name)); string(content) != expected {
+					t.Errorf("expected '%s' as the content of '%s', actual '%s'", expected, name, content)
+				}
+			}
+		})
+	}
+}
+
+func TestFreePath(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "file.txt.xv")
+	stamp := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC).Format(conflictTimestampLayout)
+
+	if actual, expected := freePath(path, "", conflictSeparator), filepath.Join(root, "file.txt-1.xv"); actual != expected {
+		t.Errorf("expected '%s', actual '%s'", expected, actual)
+	}
+	if actual, expected := freePath(path, stamp, conflictSeparator), filepath.Join(root, "file.txt-20200102T030405Z.xv"); actual != expected {
+		t.Errorf("expected '%s', actual '%s'", expected, actual)
+	}
+
+	for _, name := range []string{"file.txt-1.xv", "file.txt-20200102T030405Z.xv"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if actual, expected := freePath(path, "", conflictSeparator), filepath.Join(root, "file.txt-2.xv"); actual != expected {
+		t.Errorf("expected '%s', actual '%s'", expected, actual)
+	}
+	if actual, expected := freePath(path, stamp, conflictSeparator), filepath.Join(root, "file.txt-20200102T030405Z-2.xv"); actual != expected {
+		t.Errorf("expected '%s', actual '%s'", expected, actual)
+	}
+}
@@ -0,0 +1,334 @@
+package taps
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	gohash "hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xitonix/xvault/hash"
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+const (
+	// DefaultDedupIndexFile is the name of the file in the target directory which holds the deduplication index of the tap.
+	// The file is hidden, so that the other taps watching the target directory ignore it.
+	DefaultDedupIndexFile = ".xvault.dedup"
+	// dedupKeyPurpose is the purpose of the key derived from the master key to calculate the content hashes
+	dedupKeyPurpose = "xvault/dedup"
+)
+
+// DedupPolicy specifies what happens to the output of a file whose content has already been encrypted
+type DedupPolicy int8
+
+const (
+	// DedupOff disables deduplication. Every file will be encrypted into its own output.
+	DedupOff DedupPolicy = iota
+	// DedupSkip discards the output of the duplicate file and keeps the existing one
+	DedupSkip
+	// DedupLink replaces the output of the duplicate file with a hard link to the existing output
+	DedupLink
+	// DedupVersion stores the output of the duplicate file like any other output, so that every file keeps its own copy.
+	// An existing target file is resolved by the conflict policy (i.e. kept as a previous version by ConflictVersion).
+	DedupVersion
+)
+
+// String returns the string representation of the policy
+func (p DedupPolicy) String() string {
+	switch p {
+	case DedupOff:
+		return "off"
+	case DedupSkip:
+		return "skip"
+	case DedupLink:
+		return "link"
+	case DedupVersion:
+		return "version"
+	}
+	return "unknown"
+}
+
+// MarshalText returns the text representation of the policy
+func (p DedupPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText parses the text representation of the policy (i.e. "skip")
+func (p *DedupPolicy) UnmarshalText(text []byte) error {
+	for policy := DedupOff; policy <= DedupVersion; policy++ {
+		if policy.String() == string(text) {
+			*p = policy
+			return nil
+		}
+	}
+	return invalidConfig("unknown deduplication policy '%s'", text)
+}
+
+// Dedup represents the deduplication details of a file
+type Dedup struct {
+	// Duplicate is true if the same content has already been encrypted
+	Duplicate bool
+	// Original the path to the existing output of the same content
+	Original string
+	// Saved the number of bytes which did not need to be stored
+	Saved int64
+	// the keyed hash of the content which has been stored for the first time
+	hash string
+}
+
+// dedupRecord is a record of the deduplication index file
+type dedupRecord struct {
+	// Hash the keyed hash of the content
+	Hash string `json:"hash"`
+	// Output the path to the output of the content relative to the target directory
+	Output string `json:"output"`
+	// Size the size of the output when it was stored
+	Size int64 `json:"size"`
+	// ModTime the modification time of the output when it was stored
+	ModTime time.Time `json:"mod_time"`
+}
+
+// dedupEntry is the output of an indexed content. The size and the modification time of the output
+// are recorded, so that an output which has been replaced since (i.e. by a conflict policy) is never
+// mistaken for the original of a duplicate.
+type dedupEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// newDedupEntry records the current state of the output
+func newDedupEntry(path string) (dedupEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return dedupEntry{}, err
+	}
+	return dedupEntry{path: path, size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+// stat returns the file info of the output, unless it has been removed or modified since it was stored
+func (e dedupEntry) stat() (os.FileInfo, bool) {
+	info, err := os.Stat(e.path)
+	if err != nil || info.Size() != e.size || !info.ModTime().Equal(e.modTime) {
+		return nil, false
+	}
+	return info, true
+}
+
+// deduplicator calculates the keyed content hash of the inputs while they are being encrypted,
+// and resolves the outputs of the duplicate files once the encryption has been finished.
+//
+// The outputs are written into temporary files first (See createTempFile), so that an existing output
+// does not get overwritten by its duplicate. The final paths are always decided by the conflict resolver.
+// The index is persisted in the target directory (See DefaultDedupIndexFile), so that the duplicates are
+// detected across restarts.
+type deduplicator struct {
+	policy DedupPolicy
+	key    []byte
+	root   string
+	log    *obfuscate.RecordLog
+	// the outputs by content hash
+	index map[string]dedupEntry
+	// the content hashes of the in-progress work units by ID
+	units map[string]gohash.Hash
+	saved int64
+	mux   sync.Mutex
+}
+
+// newDeduplicator creates a deduplicator for the outputs of the target directory (root)
+func newDeduplicator(policy DedupPolicy, master *obfuscate.MasterKey, root string) (*deduplicator, error) {
+	key, err := master.DeriveKey(dedupKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	d := &deduplicator{
+		policy: policy,
+		key:    key,
+		root:   root,
+		index:  make(map[string]dedupEntry),
+		units:  make(map[string]gohash.Hash),
+	}
+	d.log, err = obfuscate.OpenRecordLog(filepath.Join(root, DefaultDedupIndexFile), d.replay, d.snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the deduplication index: %w", err)
+	}
+	return d, nil
+}
+
+// track starts hashing the input of the work unit
+func (d *deduplicator) track(w *obfuscate.WorkUnit) error {
+	h := hash.NewHMAC256(d.key)
+	err := w.Task.WrapInput(func(input io.Reader) io.Reader {
+		return io.TeeReader(input, h)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.units[w.ID] = h
+	return nil
+}
+
+// discard stops tracking the work unit which has not been completed
+func (d *deduplicator) discard(w *obfuscate.WorkUnit) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	delete(d.units, w.ID)
+}
+
+// resolve moves the temporary output of the completed work unit to its final place based on the policy.
+// Every output which needs to be stored (including the hard links) is committed using the conflict resolver.
+// It returns the path to the final output, the deduplication and the conflict details.
+func (d *deduplicator) resolve(w *obfuscate.WorkUnit, temp, output string, conflicts *conflictResolver) (string, Dedup, Conflict, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	h, ok := d.units[w.ID]
+	if !ok {
+		path, conflict, err := conflicts.commit(temp, output)
+		return path, Dedup{}, conflict, err
+	}
+	delete(d.units, w.ID)
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	original, ok := d.index[sum]
+	var originalInfo os.FileInfo
+	if ok {
+		if originalInfo, ok = original.stat(); !ok {
+			// The existing output has been removed or replaced
+			delete(d.index, sum)
+		}
+	}
+
+	if !ok {
+		path, conflict, err := conflicts.commit(temp, output)
+		if err != nil || conflict.Skipped {
+			return path, Dedup{}, conflict, err
+		}
+		entry, err := newDedupEntry(path)
+		if err != nil {
+			return path, Dedup{}, conflict, err
+		}
+		d.index[sum] = entry
+		return path, Dedup{hash: sum}, conflict, nil
+	}
+
+	info, err := os.Stat(temp)
+	if err != nil {
+		return output, Dedup{}, Conflict{}, err
+	}
+	dedup := Dedup{
+		Duplicate: true,
+		Original:  original.path,
+	}
+
+	var conflict Conflict
+	switch d.policy {
+	case DedupVersion:
+		output, conflict, err = conflicts.commit(temp, output)
+		return output, dedup, conflict, err
+	case DedupLink:
+		if err := os.Remove(temp); err != nil {
+			return output, dedup, conflict, err
+		}
+		if existing, err := os.Stat(output); err == nil && os.SameFile(existing, originalInfo) {
+			// The output is already the original (or a link to it)
+			break
+		}
+		// The link takes the place of the temporary output, so that it gets committed like any other output
+		if err := os.Link(original.path, temp); err != nil {
+			return output, dedup, conflict, err
+		}
+		output, conflict, err = conflicts.commit(temp, output)
+		if err != nil || conflict.Skipped {
+			return output, dedup, conflict, err
+		}
+	default:
+		if err := os.Remove(temp); err != nil {
+			return output, dedup, conflict, err
+		}
+		output = original.path
+	}
+
+	dedup.Saved = info.Size()
+	d.saved += dedup.Saved
+	return output, dedup, conflict, nil
+}
+
+// persist durably records the output of the content which has been stored for the first time (See resolve)
+func (d *deduplicator) persist(dedup Dedup) error {
+	if dedup.hash == "" {
+		return nil
+	}
+	// The index gets compacted while appending the records (See snapshot)
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	entry, ok := d.index[dedup.hash]
+	if !ok {
+		return nil
+	}
+	record, err := d.record(dedup.hash, entry)
+	if err != nil {
+		return err
+	}
+	return d.log.Append(record)
+}
+
+// close closes the underlying index file
+func (d *deduplicator) close() error {
+	return d.log.Close()
+}
+
+// record returns the index record of the output
+func (d *deduplicator) record(sum string, entry dedupEntry) (dedupRecord, error) {
+	rel, err := filepath.Rel(d.root, entry.path)
+	if err != nil {
+		return dedupRecord{}, err
+	}
+	return dedupRecord{Hash: sum, Output: filepath.ToSlash(rel), Size: entry.size, ModTime: entry.modTime}, nil
+}
+
+func (d *deduplicator) replay(record []byte) error {
+	var r dedupRecord
+	if err := json.Unmarshal(record, &r); err != nil {
+		return err
+	}
+	d.index[r.Hash] = dedupEntry{
+		path:    filepath.Join(d.root, filepath.FromSlash(r.Output)),
+		size:    r.Size,
+		modTime: r.ModTime,
+	}
+	return nil
+}
+
+// snapshot returns the index records of the outputs which have not been removed or replaced.
+// It is called while the index is locked (See persist).
+func (d *deduplicator) snapshot() []interface{} {
+	records := make([]interface{}, 0, len(d.index))
+	for sum, entry := range d.index {
+		if _, ok := entry.stat(); !ok {
+			delete(d.index, sum)
+			continue
+		}
+		record, err := d.record(sum, entry)
+		if err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// savings returns the total number of bytes which did not need to be stored
+func (d *deduplicator) savings() int64 {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.saved
+}
@@ -0,0 +1,213 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitonix/xvault/hash"
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+func TestDedupIndexPersistence(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	root := t.TempDir()
+
+	d, err := newDeduplicator(DedupSkip, master, root)
+	if err != nil {
+		t.Fatalf("failed to create the deduplicator: %v", err)
+	}
+	kept := filepath.Join(root, "sub", "kept.xv")
+	removed := filepath.Join(root, "removed.xv")
+	replaced := filepath.Join(root, "replaced.xv")
+	for _, path := range []string{kept, removed, replaced} {
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte("output"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if d.index[path], err = newDedupEntry(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.persist(Dedup{hash: path}); err != nil {
+			t.Fatalf("failed to persist the index: %v", err)
+		}
+	}
+	// The outputs of the duplicates are not indexed
+	if err := d.persist(Dedup{Duplicate: true}); err != nil {
+		t.Fatalf("failed to persist the index: %v", err)
+	}
+	d.close()
+
+	os.Remove(removed)
+	if err := os.WriteFile(replaced, []byte("another output"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d, err = newDeduplicator(DedupSkip, master, root)
+	if err != nil {
+		t.Fatalf("failed to re-open the deduplicator: %v", err)
+	}
+	defer d.close()
+
+	if len(d.index) != 1 || d.index[kept].path != kept {
+		t.Errorf("expected only '%s' to be indexed, actual %v", kept, d.index)
+	}
+}
+
+func TestDedupResolve(t *testing.T) {
+	testCases := []struct {
+		title    string
+		policy   DedupPolicy
+		conflict ConflictPolicy
+		// the content of the existing file at the output path
+		existing string
+		// replace the original output with a different content before resolving the duplicate
+		replaceOriginal bool
+		expectedPath    string
+		expectedDup     bool
+		expectedSkipped bool
+		expectedLinked  bool
+		expectedContent string
+	}{
+		{
+			title:           "skip",
+			policy:          DedupSkip,
+			expectedPath:    "original.xv",
+			expectedDup:     true,
+			expectedContent: "content",
+		},
+		{
+			title:           "skip_replaced_original",
+			policy:          DedupSkip,
+			replaceOriginal: true,
+			expectedPath:    "duplicate.xv",
+			expectedContent: "content",
+		},
+		{
+			title:           "link",
+			policy:          DedupLink,
+			expectedPath:    "duplicate.xv",
+			expectedDup:     true,
+			expectedLinked:  true,
+			expectedContent: "content",
+		},
+		{
+			title:           "link_over_existing_output_with_conflict_skip",
+			policy:          DedupLink,
+			conflict:        ConflictSkip,
+			existing:        "existing",
+			expectedPath:    "duplicate.xv",
+			expectedDup:     true,
+			expectedSkipped: true,
+			expectedContent: "existing",
+		},
+		{
+			title:           "link_over_existing_output_with_conflict_rename",
+			policy:          DedupLink,
+			conflict:        ConflictRename,
+			existing:        "existing",
+			expectedPath:    "duplicate-1.xv",
+			expectedDup:     true,
+			expectedLinked:  true,
+			expectedContent: "content",
+		},
+		{
+			title:           "version",
+			policy:          DedupVersion,
+			expectedPath:    "duplicate.xv",
+			expectedDup:     true,
+			expectedContent: "content",
+		},
+		{
+			title:           "version_over_existing_output_with_conflict_version",
+			policy:          DedupVersion,
+			conflict:        ConflictVersion,
+			existing:        "existing",
+			expectedPath:    "duplicate.xv",
+			expectedDup:     true,
+			expectedContent: "content",
+		},
+	}
+
+	master, _ := obfuscate.KeyFromPassword("password")
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			root := t.TempDir()
+			d, err := newDeduplicator(tc.policy, master, root)
+			if err != nil {
+				t.Fatalf("failed to create the deduplicator: %v", err)
+			}
+			defer d.close()
+			conflicts := newConflictResolver(tc.conflict, 0)
+
+			original := filepath.Join(root, "original.xv")
+			path, dedup, _, err := d.resolve(trackedUnit(d, "1", "content"), writeTemp(t, original, "content"), original, conflicts)
+			if err != nil || path != original || dedup.Duplicate {
+				t.Fatalf("expected the original to be stored, actual '%s', %+v, '%v'", path, dedup, err)
+			}
+			if tc.replaceOriginal {
+				if err := os.WriteFile(original, []byte("modified"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			output := filepath.Join(root, "duplicate.xv")
+			if tc.existing != "" {
+				if err := os.WriteFile(output, []byte(tc.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			temp := writeTemp(t, output, "content")
+			path, dedup, conflict, err := d.resolve(trackedUnit(d, "2", "content"), temp, output, conflicts)
+			if err != nil {
+				t.Fatalf("expected no error, but received '%v'", err)
+			}
+
+			if expected := filepath.Join(root, tc.expectedPath); path != expected {
+				t.Errorf("expected '%s' as the output, actual '%s'", expected, path)
+			}
+			if dedup.Duplicate != tc.expectedDup {
+				t.Errorf("expected the duplicate flag to be %v, actual %v", tc.expectedDup, dedup.Duplicate)
+			}
+			if conflict.Skipped != tc.expectedSkipped {
+				t.Errorf("expected the skipped flag to be %v, actual %v", tc.expectedSkipped, conflict.Skipped)
+			}
+			if content, _ := os.ReadFile(path); string(content) != tc.expectedContent {
+				t.Errorf("expected '%s' as the content of the output, actual '%s'", tc.expectedContent, content)
+			}
+			if tc.expectedLinked {
+				originalInfo, _ := os.Stat(original)
+				outputInfo, _ := os.Stat(path)
+				if !os.SameFile(originalInfo, outputInfo) {
+					t.Errorf("expected '%s' to be a link to '%s'", path, original)
+				}
+			}
+			if _, err := os.Stat(temp); !os.IsNotExist(err) {
+				t.Errorf("expected the temporary file to be removed, actual '%v'", err)
+			}
+		})
+	}
+}
+
+// trackedUnit returns a work unit whose input content has been hashed by the deduplicator
+func trackedUnit(d *deduplicator, id, content string) *obfuscate.WorkUnit {
+	h := hash.NewHMAC256(d.key)
+	h.Write([]byte(content))
+	d.units[id] = h
+	return &obfuscate.WorkUnit{ID: id}
+}
+
+// writeTemp writes the content into a temporary file of the output
+func writeTemp(t *testing.T, output, content string) string {
+	t.Helper()
+	file, err := createTempFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
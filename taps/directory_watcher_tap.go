@@ -1,15 +1,17 @@
 package taps
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/radovskyb/watcher"
 	"github.com/xitonix/xvault/obfuscate"
 )
 
@@ -17,8 +19,23 @@ const (
 	encodedFileExtension  = ".xv"
 	outputMetadataKey     = "output"
 	inputMetadataKey      = "input"
-	outputFullMetadataKey = "output_full_path"
-	inputFullMetadataKey  = "input_full_path"
+	outputFullMetadataKey = obfuscate.OutputPathMetadataKey
+	inputFullMetadataKey  = obfuscate.InputPathMetadataKey
+	// the modification time of the input file when it got dispatched
+	inputModTimeMetadataKey = "input_mod_time"
+	// the path to the temporary file of the output (See createTempFile)
+	outputTempMetadataKey = "output_temp"
+	// the access time of the input file before it got read (See WithPreserveAttributes)
+	inputATimeMetadataKey = "input_atime"
+)
+
+const (
+	// maxNameLength is the maximum length of a file name on the most filesystems
+	maxNameLength = 255
+	// tempNameOverhead is the maximum number of bytes the conflict suffixes and the hidden temporary files add to
+	// the name of an output. The longest is the temporary file of the attributes file of a renamed output
+	// (i.e. "..name.20060102T150405Z.2.xv.meta.4294967295.tmp", See createTempFile and ConflictTimestamp).
+	tempNameOverhead = maxConflictSuffixLength + len("..") + len(attributesSuffix) + len(".4294967295") + len(tempFileSuffix)
 )
 
 type File struct {
@@ -34,52 +51,124 @@ type Result struct {
 	Error error
 
 	Input, Output File
+
+	// Dedup the deduplication details of the file (See DirectoryWatcherTap.SetDeduplication)
+	Dedup Dedup
+
+	// Conflict the decision which has been made if the target file already existed (See WithConflictPolicy)
+	Conflict Conflict
 }
 
 // DirectoryWatcherTap is a tap with the functionality of monitoring local filesystem and encrypting the content into the target directory.
+//
+// The tap can also work in the reverse direction to decrypt the encoded files (See NewDecryptingDirectoryWatcherTap).
 type DirectoryWatcherTap struct {
 	pipe           obfuscate.WorkList
+	mode           obfuscate.Operation
 	progress       chan *Result
 	master         *obfuscate.MasterKey
-	watcher        *watcher.Watcher
-	interval       time.Duration
+	watcher        fileWatcher
 	errors         chan error
+	logger         *slog.Logger
+	tracer         obfuscate.Tracer
 	notifyErr      bool
 	report         bool
 	delete         bool
+	wipe           *SecureDeletePolicy
 	source, target string
 	wg             *sync.WaitGroup
+	dedup          *deduplicator
+	conflicts      *conflictResolver
+	state          *stateStore
+	names          *obfuscate.NameCipher
+	// the key of the attributes files (See WithPreserveAttributes)
+	attrKey []byte
+	// the attributes of the decrypted directories (See WithPreserveAttributes)
+	dirs      *dirRestorer
+	readiness *readinessTracker
+	filter    *fileFilter
+	// the input files which have been recovered from the engine's journal
+	recovered map[string]obfuscate.None
 
 	openOnce  sync.Once
 	closeOnce sync.Once
 
 	// to prevent multiple go routines to run
 	// Open and Close at the same time
-	mux    sync.Mutex
-	isOpen bool
+	mux sync.Mutex
+	// the open flag is atomic, so that the tap's own go routines can check it while the tap is being closed
+	isOpen int32
 }
 
-// NewDirectoryWatcherTap creates a new instance of directory watcher tap.
+// NewDirectoryWatcherTapWithOptions creates a new instance of directory watcher tap.
+//
+// "source" and "target" are the paths to source and destination directories. They will get created
+// by the tap if they don't already exist.
 //
-// If you have enabled error notification by setting  'notifyErrors' to true, you need to make sure
-// that you subscribe to "Errors" channel to read off the notification pipe, otherwise you will get
-// get blocked on the full channel.
+// The outputs are written into hidden temporary files in the target directory, flushed to the disk and atomically
+// renamed once the processing has been completed, so the target directory only ever contains complete outputs.
+// The temporary files of the failed or cancelled tasks will be removed.
 //
-// "parallelism" specifies the number of files you would like to process at the same time.
+// If the target file of an output already exists, the conflict policy decides whether it gets overwritten,
+// kept or versioned (See WithConflictPolicy).
 //
-// "pollingInterval" is the frequency of checking the "source" directory for newly created files.
+// The names of the output files and directories can be encrypted, so that the target tree does not leak
+// any information about the content (See WithNameEncryption).
 //
-// if you set "deleteCompleted" to true, the input files will get deleted, only if the encryption
-// operation has been finished successfully.
+// The outputs and the directories created by the tap are only accessible by the owner. The permissions,
+// ownership, timestamps and extended attributes of the inputs can be preserved (See WithPreserveAttributes).
 //
-// "source" and "target" are the paths to source and destination directories. They will get created
-// by the tap if they don't already exist.
+// If the processing state is persisted (See WithPersistentState), the input files which have already been processed
+// will not be re-processed after a restart, unless they have been modified.
+//
+// The files to be processed can be selected using glob patterns, regular expressions, size and age limits and
+// the per directory ignore files (See WithFilter).
+//
+// The tap can be configured using the DirectoryWatcherOption functions (i.e. WithPollingInterval) or a DirectoryWatcherConfig.
+// An error of type obfuscate.ErrInvalidConfig will be returned if the configuration is not valid.
+func NewDirectoryWatcherTapWithOptions(source, target string, master *obfuscate.MasterKey, opts ...DirectoryWatcherOption) (*DirectoryWatcherTap, error) {
+	return newDirectoryWatcherTap(obfuscate.Encode, source, target, master, opts)
+}
+
+// NewDirectoryWatcherTap creates a new instance of directory watcher tap which encrypts the
+// files of the "source" directory into the "target" directory.
+//
+// Deprecated: Use NewDirectoryWatcherTapWithOptions instead.
 func NewDirectoryWatcherTap(source, target string,
 	pollingInterval time.Duration,
 	master *obfuscate.MasterKey,
 	notifyErrors bool,
 	reportProgress bool,
 	deleteCompleted bool) (*DirectoryWatcherTap, error) {
+	return NewDirectoryWatcherTapWithOptions(source, target, master,
+		WithPollingInterval(pollingInterval),
+		WithErrorNotification(notifyErrors),
+		WithProgressReport(reportProgress),
+		WithDeleteCompleted(deleteCompleted))
+}
+
+// NewDecryptingDirectoryWatcherTap creates a new instance of directory watcher tap which decrypts
+// the encoded files (with ".xv" extension) of the "source" directory into the "target" directory.
+//
+// The original names of the files will be restored by removing the ".xv" extension. The rest of the files
+// in the source directory will be ignored. The tap accepts the same options as NewDirectoryWatcherTapWithOptions, except
+// deduplication which only applies to the encryption.
+//
+// If the names have been encrypted by the encrypting tap, the tap must be created using WithNameEncryption
+// to restore the original names and directory structure.
+func NewDecryptingDirectoryWatcherTap(source, target string, master *obfuscate.MasterKey, opts ...DirectoryWatcherOption) (*DirectoryWatcherTap, error) {
+	return newDirectoryWatcherTap(obfuscate.Decode, source, target, master, opts)
+}
+
+func newDirectoryWatcherTap(mode obfuscate.Operation, source, target string, master *obfuscate.MasterKey, opts []DirectoryWatcherOption) (*DirectoryWatcherTap, error) {
+	o, err := newDirectoryWatcherOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if mode != obfuscate.Encode && o.dedup != DedupOff {
+		return nil, invalidConfig("deduplication is only supported by the encrypting taps")
+	}
+
 	src, err := createDirIfNotExist(source)
 	if err != nil {
 		return nil, err
@@ -90,34 +179,93 @@ func NewDirectoryWatcherTap(source, target string,
 		return nil, err
 	}
 
-	w := watcher.New()
-	w.FilterOps(watcher.Create)
-	w.IgnoreHiddenFiles(true)
+	filter, err := newFileFilter(src, o.filter)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := w.AddRecursive(src); err != nil {
+	w, err := newFileWatcher(src, o.backend, o.interval)
+	if err != nil {
 		return nil, err
 	}
 
-	return &DirectoryWatcherTap{
+	var state *stateStore
+	if o.persist {
+		state, err = openStateStore(filepath.Join(tg, DefaultStateFile), src, master)
+		if err != nil {
+			w.close()
+			return nil, fmt.Errorf("failed to open the state file: %w", err)
+		}
+	}
+
+	d := &DirectoryWatcherTap{
+		mode:      mode,
 		watcher:   w,
-		interval:  pollingInterval,
 		errors:    make(chan error),
-		notifyErr: notifyErrors,
+		notifyErr: o.notifyErr,
 		source:    src,
 		target:    tg,
-		delete:    deleteCompleted,
+		delete:    o.delete || o.wipe != nil,
+		wipe:      o.wipe,
 		wg:        &sync.WaitGroup{},
 		master:    master,
 		pipe:      make(obfuscate.WorkList),
 		progress:  make(chan *Result),
-		report:    reportProgress,
-	}, nil
+		report:    o.report,
+		recovered: make(map[string]obfuscate.None),
+		conflicts: newConflictResolver(o.conflict, o.retention),
+		state:     state,
+	}
+	if o.attributes {
+		if d.attrKey, err = master.DeriveKey(attributesKeyPurpose); err != nil {
+			w.close()
+			if state != nil {
+				state.close()
+			}
+			return nil, err
+		}
+		if mode == obfuscate.Decode {
+			d.dirs = newDirRestorer(tg)
+		}
+	}
+	if o.names {
+		if d.names, err = obfuscate.NewNameCipher(master); err != nil {
+			w.close()
+			if state != nil {
+				state.close()
+			}
+			return nil, err
+		}
+		if mode == obfuscate.Encode {
+			// The conflict suffixes must not be mistaken for a part of the encrypted names
+			d.conflicts.separator = sealedConflictSeparator
+		}
+	}
+	d.filter = filter
+	d.readiness = newReadinessTracker(o.readiness.withDefaults(), o.filter.MinAge, d.whenReady)
+	d.SetLogger(o.logger)
+	if err := d.SetTracer(o.tracer); err != nil {
+		return nil, err
+	}
+	if err := d.SetDeduplication(o.dedup); err != nil {
+		w.close()
+		if state != nil {
+			state.close()
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// Backend returns the mechanism the tap uses to detect the new files (See WithBackend)
+func (d *DirectoryWatcherTap) Backend() Backend {
+	return d.watcher.backend()
 }
 
 // Errors returns a read-only channel on which you will receive the failure notifications.
 //
-// In order to receive the errors on the channel, you need to turn error notifications On by setting
-// "notifyErrors" parameter of "NewDirectoryWatcherTap" method to true.
+// In order to receive the errors on the channel, you need to turn error notifications On
+// using the WithErrorNotification option.
 // You can also switch it On or Off by calling the SwitchErrorNotification(...) method
 func (d *DirectoryWatcherTap) Errors() <-chan error {
 	return d.errors
@@ -130,13 +278,88 @@ func (d *DirectoryWatcherTap) Pipe() obfuscate.WorkList {
 
 // Progress returns a read-only channel on which you will receive the progress report
 //
-// In order to receive progress report on the channel, you need to turn it On by setting
-// "reportProgress" parameter of "NewDirectoryWatcherTap" method to true.
+// In order to receive progress report on the channel, you need to turn it On
+// using the WithProgressReport option.
 // You can also switch it On or Off by calling the SwitchProgressReport(...) method
 func (d *DirectoryWatcherTap) Progress() <-chan *Result {
 	return d.progress
 }
 
+// SetLogger sets the structured logger of the tap. Nothing will be logged by default.
+//
+// The failures will be logged using the same attributes as the engine (See obfuscate.LogKeyInput etc).
+// Use logger.With(obfuscate.LogKeyTap, name) to tag the records with the name under which the tap has been attached.
+func (d *DirectoryWatcherTap) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	d.logger = logger
+}
+
+// SetTracer sets the tracer which creates a span (obfuscate.SpanDispatch) for dispatching every work unit.
+// The span will be the root of the work unit's trace. Nothing will be traced by default.
+//
+// The tracer must be set before the tap gets opened. Calling this method on an open tap
+// will return an error of type obfuscate.ErrOperationInProgress.
+func (d *DirectoryWatcherTap) SetTracer(tracer obfuscate.Tracer) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.IsOpen() {
+		return obfuscate.ErrOperationInProgress
+	}
+	if tracer == nil {
+		tracer = obfuscate.NoopTracer()
+	}
+	d.tracer = tracer
+	return nil
+}
+
+// SetDeduplication enables or disables the deduplication of the encrypted files.
+//
+// A keyed hash of every input will be calculated while it's being encrypted. If the same content has already
+// been encrypted by the tap, the policy decides what happens to the new output. The deduplication details
+// (including the saved storage) will be included in the progress results.
+// The index of the stored contents is persisted in the target directory (See DefaultDedupIndexFile),
+// so that the duplicates of the files which have been encrypted before a restart get detected too.
+// The deduplication must be configured before the tap gets opened. Calling this method on an open tap
+// will return an error of type obfuscate.ErrOperationInProgress.
+func (d *DirectoryWatcherTap) SetDeduplication(policy DedupPolicy) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.IsOpen() {
+		return obfuscate.ErrOperationInProgress
+	}
+	if d.mode != obfuscate.Encode && policy != DedupOff {
+		return invalidConfig("deduplication is only supported by the encrypting taps")
+	}
+	if d.dedup != nil && policy != DedupOff {
+		// The index of the target directory is kept
+		d.dedup.policy = policy
+		return nil
+	}
+	if policy == DedupOff {
+		if d.dedup != nil {
+			d.dedup.close()
+		}
+		d.dedup = nil
+		return nil
+	}
+	dedup, err := newDeduplicator(policy, d.master, d.target)
+	if err != nil {
+		return err
+	}
+	d.dedup = dedup
+	return nil
+}
+
+// DedupSavings returns the total number of bytes which did not need to be stored due to deduplication
+func (d *DirectoryWatcherTap) DedupSavings() int64 {
+	if d.dedup == nil {
+		return 0
+	}
+	return d.dedup.savings()
+}
+
 // SwitchErrorNotification switches error notification ON/OFF
 func (d *DirectoryWatcherTap) SwitchErrorNotification(on bool) {
 	d.notifyErr = on
@@ -163,15 +386,32 @@ func (d *DirectoryWatcherTap) Open() {
 		go func() {
 			defer d.wg.Done()
 			// Process the files which are currently in the source folder
-			for path, file := range d.watcher.WatchedFiles() {
-				d.dispatchWorkUnit(path, file)
+			files := d.watcher.files()
+			if d.state != nil {
+				if err := d.state.prune(files); err != nil {
+					d.logError("failed to update the processing state", err, slog.String("source", d.source))
+					d.reportError(fmt.Errorf("failed to update the processing state: %w", err))
+				}
+			}
+			for path, file := range files {
+				if _, ok := d.recovered[path]; ok {
+					// The file has already been queued by the engine's journal
+					continue
+				}
+				d.track(path, file)
 			}
 		}()
 
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.readiness.run(d.watcher.closed())
+		}()
+
 		d.wg.Add(1)
 		go d.startDirectoryWatcher()
 
-		d.isOpen = true
+		atomic.StoreInt32(&d.isOpen, 1)
 	})
 }
 
@@ -184,21 +424,60 @@ func (d *DirectoryWatcherTap) Close() {
 
 	d.closeOnce.Do(func() {
 		if d != nil && d.watcher != nil {
-			d.watcher.Close()
+			// The pending files must not be dispatched anymore
+			atomic.StoreInt32(&d.isOpen, 0)
+			d.watcher.close()
 			d.wg.Wait()
+			if d.state != nil {
+				d.state.close()
+			}
+			if d.dedup != nil {
+				d.dedup.close()
+			}
 			close(d.pipe)
 			close(d.errors)
 			close(d.progress)
-			d.isOpen = false
 		}
 	})
 }
 
+// Recover rebuilds the work unit of an unfinished encryption (or decryption) from the engine's journal.
+// The input file will be re-processed from scratch into a new temporary output file.
+//
+// You SHOULD NOT call this method explicitly. The engine will call it before opening the tap.
+func (d *DirectoryWatcherTap) Recover(entry obfuscate.JournalEntry) (*obfuscate.WorkUnit, error) {
+	inputPath, ok := entry.Metadata[inputFullMetadataKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("the journal entry '%s' has no input file", entry.ID)
+	}
+
+	// The temporary output of the interrupted work unit will never be committed
+	if temp, ok := entry.Metadata[outputTempMetadataKey].(string); ok {
+		if err := os.Remove(temp); err != nil && !os.IsNotExist(err) {
+			d.logError("failed to remove the temporary output file", err, slog.String(obfuscate.LogKeyUnit, entry.ID), slog.String(obfuscate.LogKeyOutput, temp))
+		}
+	}
+
+	file, err := os.Stat(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := d.createWorkUnit(inputPath, file)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mux.Lock()
+	d.recovered[inputPath] = obfuscate.None{}
+	d.mux.Unlock()
+
+	return w, nil
+}
+
 // IsOpen returns true if the tap is open
 func (d *DirectoryWatcherTap) IsOpen() bool {
-	d.mux.Lock()
-	defer d.mux.Unlock()
-	return d.isOpen
+	return atomic.LoadInt32(&d.isOpen) == 1
 }
 
 func (d *DirectoryWatcherTap) reportProgress(r *Result) {
@@ -207,10 +486,12 @@ func (d *DirectoryWatcherTap) reportProgress(r *Result) {
 
 func (d *DirectoryWatcherTap) startDirectoryWatcher() {
 	defer d.wg.Done()
-	err := d.watcher.Start(d.interval)
+	d.logger.Debug("filesystem watcher started", slog.String("source", d.source), slog.String("backend", d.watcher.backend().String()))
+	err := d.watcher.start()
 
 	if err != nil {
-		d.reportError(fmt.Errorf("filesystem watcher: %s", err))
+		d.logError("failed to start the filesystem watcher", err, slog.String("source", d.source))
+		d.reportError(fmt.Errorf("filesystem watcher: %w", err))
 		d.Close()
 	}
 }
@@ -219,16 +500,63 @@ func (d *DirectoryWatcherTap) monitorSourceDirectory() {
 	defer d.wg.Done()
 	for {
 		select {
-		case event := <-d.watcher.Event:
-			d.dispatchWorkUnit(event.Path, event.FileInfo)
-		case err := <-d.watcher.Error:
+		case event := <-d.watcher.events():
+			d.track(event.path, event.info)
+		case err := <-d.watcher.errors():
+			d.logError("filesystem watcher failure", err, slog.String("source", d.source))
 			d.reportError(err)
-		case <-d.watcher.Closed:
+		case <-d.watcher.closed():
 			return
 		}
 	}
 }
 
+// removeInput deletes the input file of the completed work unit. If secure deletion is enabled, the input
+// will only be wiped once the output has been verified to decode back into the same content.
+func (d *DirectoryWatcherTap) removeInput(w *obfuscate.WorkUnit, input, output string) error {
+	if err := d.checkUnchanged(w); err != nil {
+		return err
+	}
+	if d.attrKey != nil && d.mode == obfuscate.Decode {
+		// The attributes have been restored on the output
+		if err := os.Remove(attributesPath(input)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if d.wipe == nil {
+		return os.Remove(input)
+	}
+	if d.mode == obfuscate.Encode {
+		if err := verifyOutput(d.master, input, output); err != nil {
+			return fmt.Errorf("failed to verify the output: %w", err)
+		}
+	}
+	return wipeFile(input, *d.wipe)
+}
+
+// checkUnchanged makes sure that the input file has not been modified since it was dispatched,
+// so that a file which is still being written never gets deleted
+func (d *DirectoryWatcherTap) checkUnchanged(w *obfuscate.WorkUnit) error {
+	path, _ := w.Metadata[inputFullMetadataKey].(string)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	modTime, _ := w.Metadata[inputModTimeMetadataKey].(string)
+	if info.Size() != w.Size || info.ModTime().Format(time.RFC3339Nano) != modTime {
+		return errors.New("the file has been modified while being processed")
+	}
+	return nil
+}
+
+// logError logs the failure with the consistent error attributes
+func (d *DirectoryWatcherTap) logError(msg string, err error, attrs ...any) {
+	attrs = append(attrs,
+		slog.Any(obfuscate.LogKeyError, err),
+		slog.String(obfuscate.LogKeyErrorClass, obfuscate.ErrorClass(err)))
+	d.logger.Error(msg, attrs...)
+}
+
 func (d *DirectoryWatcherTap) reportError(err error) {
 	if d.IsOpen() && d.notifyErr {
 		d.errors <- err
@@ -242,18 +570,114 @@ func (d *DirectoryWatcherTap) whenDone(w *obfuscate.WorkUnit) {
 
 	err := w.Task.CloseInput()
 	if err != nil {
-		d.reportError(fmt.Errorf("failed to close '%s': %s", input.Name, err))
+		d.logError("failed to close the input file", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyInput, input.Path))
+		d.reportError(fmt.Errorf("failed to close '%s': %w", input.Name, err))
 	}
+	status, result := w.Task.Status(), w.Error
 	err = w.Task.CloseOutputs()
 	if err != nil {
-		d.reportError(fmt.Errorf("failed to close '%v': %s", output.Name, err))
+		d.logError("failed to close the output file", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyOutput, output.Path))
+		d.reportError(fmt.Errorf("failed to close '%v': %w", output.Name, err))
+		if status == obfuscate.Completed {
+			// The output might not have been flushed to the disk
+			status, result = obfuscate.Failed, err
+		}
+	}
+
+	// The target directory must only contain the complete outputs
+	temp, _ := w.Metadata[outputTempMetadataKey].(string)
+	if status != obfuscate.Completed {
+		if d.dedup != nil {
+			d.dedup.discard(w)
+		}
+		if d.state != nil {
+			d.state.discard(w)
+		}
+		if err := os.Remove(temp); err != nil && !os.IsNotExist(err) {
+			d.logError("failed to remove the temporary output file", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyOutput, temp))
+		}
+	}
+
+	var (
+		dedup    Dedup
+		conflict Conflict
+		path     string
+	)
+	if status == obfuscate.Completed && d.attrKey != nil && d.mode == obfuscate.Decode {
+		// The output gets its final name with the original attributes
+		if err := d.transferAttributes(input.Path, temp, time.Time{}); err != nil {
+			d.logError("failed to restore the file attributes", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyOutput, output.Path))
+			d.reportError(fmt.Errorf("failed to restore the attributes of '%s': %w", output.Name, err))
+		}
+	}
+
+	if status == obfuscate.Completed {
+		if d.dedup == nil {
+			path, conflict, err = d.conflicts.commit(temp, output.Path)
+		} else {
+			path, dedup, conflict, err = d.dedup.resolve(w, temp, output.Path, d.conflicts)
+		}
+		if err != nil {
+			if d.dedup != nil {
+				d.dedup.discard(w)
+			}
+			if d.state != nil {
+				d.state.discard(w)
+			}
+			if err := os.Remove(temp); err != nil && !os.IsNotExist(err) {
+				d.logError("failed to remove the temporary output file", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyOutput, temp))
+			}
+			d.logError("failed to commit the output file", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyOutput, output.Path))
+			d.reportError(fmt.Errorf("failed to commit '%s': %w", output.Name, err))
+			status, result = obfuscate.Failed, err
+		}
+		if err == nil && d.dedup != nil {
+			if err := d.dedup.persist(dedup); err != nil {
+				d.logError("failed to update the deduplication index", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyOutput, path))
+				d.reportError(fmt.Errorf("failed to update the deduplication index: %w", err))
+			}
+		}
+		if dedup.Duplicate {
+			d.logger.Info("duplicate file",
+				slog.String(obfuscate.LogKeyUnit, w.ID),
+				slog.String(obfuscate.LogKeyInput, input.Path),
+				slog.String(obfuscate.LogKeyOutput, path),
+				slog.String("original", dedup.Original),
+				slog.String("policy", d.dedup.policy.String()),
+				slog.Int64("saved", dedup.Saved))
+		}
+		if conflict.Existed {
+			d.logger.Info("output conflict",
+				slog.String(obfuscate.LogKeyUnit, w.ID),
+				slog.String(obfuscate.LogKeyInput, input.Path),
+				slog.String(obfuscate.LogKeyOutput, path),
+				slog.String("policy", conflict.Policy.String()),
+				slog.Bool("skipped", conflict.Skipped),
+				slog.String("previous", conflict.Previous))
+		}
+		output.Path, output.Name = path, filepath.Base(path)
 	}
 
-	if d.delete && w.Task.Status() == obfuscate.Completed {
+	// The duplicates which have not been stored share the attributes of the original output
+	stored := !conflict.Skipped && !(dedup.Duplicate && output.Path == dedup.Original)
+	if status == obfuscate.Completed && d.attrKey != nil && d.mode == obfuscate.Encode && stored {
+		value, _ := w.Metadata[inputATimeMetadataKey].(string)
+		atime, _ := time.Parse(time.RFC3339Nano, value)
+		if err := d.transferAttributes(input.Path, output.Path, atime); err != nil {
+			d.logError("failed to preserve the file attributes", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyInput, input.Path))
+			d.reportError(fmt.Errorf("failed to preserve the attributes of '%s': %w", input.Name, err))
+		}
+	}
+
+	// The input of a skipped output must be kept, since its content has not been stored
+	if d.delete && status == obfuscate.Completed && !conflict.Skipped {
 		file := input.Path
-		err := os.Remove(file)
+		err := d.removeInput(w, file, output.Path)
 		if err != nil {
-			d.reportError(fmt.Errorf("failed to remove '%s': %s", input.Name, err))
+			d.logError("failed to remove the input file", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyInput, file))
+			d.reportError(fmt.Errorf("failed to remove '%s': %w", input.Name, err))
+		} else {
+			d.logger.Debug("input file removed", slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyInput, file))
 		}
 		dir := filepath.Dir(file)
 		isEmpty := isDirEmpty(dir)
@@ -262,83 +686,355 @@ func (d *DirectoryWatcherTap) whenDone(w *obfuscate.WorkUnit) {
 		}
 	}
 
+	if d.state != nil && status == obfuscate.Completed {
+		d.updateState(w, input, conflict)
+	}
+
+	d.releaseDirs(w.Metadata[outputFullMetadataKey].(string))
+
 	if d.report && d.IsOpen() {
 		d.reportProgress(&Result{
-			Output: output,
-			Input:  input,
-			Status: w.Task.Status(),
-			Error:  w.Error,
+			Output:   output,
+			Input:    input,
+			Status:   status,
+			Error:    result,
+			Dedup:    dedup,
+			Conflict: conflict,
 		})
 	}
 }
 
+// updateState records the input of the completed work unit, so that it does not get re-processed after a restart
+func (d *DirectoryWatcherTap) updateState(w *obfuscate.WorkUnit, input File, conflict Conflict) {
+	var err error
+	switch {
+	case conflict.Skipped:
+		d.state.discard(w)
+	case !fileExists(input.Path):
+		// The input has been deleted
+		d.state.discard(w)
+		err = d.state.remove(input.Path)
+	default:
+		modTime, _ := time.Parse(time.RFC3339Nano, w.Metadata[inputModTimeMetadataKey].(string))
+		err = d.state.processed(w, input.Path, w.Size, modTime)
+	}
+	if err != nil {
+		d.logError("failed to update the processing state", err, slog.String(obfuscate.LogKeyUnit, w.ID), slog.String(obfuscate.LogKeyInput, input.Path))
+		d.reportError(fmt.Errorf("failed to update the processing state of '%s': %w", input.Name, err))
+	}
+}
+
 func (d *DirectoryWatcherTap) openInputFile(path string) (*os.File, string, error) {
 	abs, err := filepath.Abs(path)
 	if err != nil {
 		return nil, path, err
 	}
 
-	// We need to wait until the watcher releases the handle
-	time.Sleep(100 * time.Millisecond)
-
 	input, err := os.Open(abs)
 	return input, abs, err
 }
 
-func (d *DirectoryWatcherTap) createOutputFile(name, inputFullPath string) (*os.File, string, error) {
+// createOutputFile creates the temporary file of the output. The output only gets its final name
+// once the processing has been completed successfully (See whenDone).
+func (d *DirectoryWatcherTap) createOutputFile(name, inputFullPath string) (*tempFile, string, error) {
 	subDir := strings.Replace(filepath.Dir(inputFullPath), d.source, "", 1)
-	targetDir := filepath.Join(d.target, subDir)
-	abs, err := createDirIfNotExist(targetDir)
+	targetSubDir := subDir
+	if d.names != nil {
+		var err error
+		if targetSubDir, err = d.mapName(subDir, true); err != nil {
+			return nil, name, err
+		}
+	}
+	abs, err := d.createTargetDirs(subDir, targetSubDir)
 	if err != nil {
 		return nil, name, err
 	}
-	abs = filepath.Join(abs, name+encodedFileExtension)
-	output, err := os.Create(abs)
+	abs = filepath.Join(abs, name)
+	output, err := createTempFile(abs)
+	if err != nil {
+		d.releaseDirs(abs)
+	}
 	return output, abs, err
 }
 
+// createTargetDirs creates the target directories of the source sub-directory. The directories are only
+// accessible by the owner (See targetDirMode), unless their attributes are being restored (See WithPreserveAttributes).
+//
+// The decrypting taps hold the directories until the output gets released (See releaseDirs).
+func (d *DirectoryWatcherTap) createTargetDirs(subDir, targetSubDir string) (string, error) {
+	parts := strings.Split(filepath.ToSlash(subDir), "/")
+	targetParts := strings.Split(filepath.ToSlash(targetSubDir), "/")
+	source, target := d.source, d.target
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		source, target = filepath.Join(source, part), filepath.Join(target, targetParts[i])
+		err := os.Mkdir(target, targetDirMode)
+		if err != nil && !os.IsExist(err) {
+			d.releaseDirs(target)
+			return target, err
+		}
+		created := err == nil
+		if d.dirs != nil {
+			if created {
+				if err := d.recordDirAttributes(source, target); err != nil {
+					d.logError("failed to load the directory attributes", err, slog.String(obfuscate.LogKeyInput, source), slog.String(obfuscate.LogKeyOutput, target))
+					d.reportError(fmt.Errorf("failed to restore the attributes of '%s': %w", source, err))
+				}
+			}
+			if err := d.dirs.acquire(target); err != nil {
+				d.releaseDirs(target)
+				return target, err
+			}
+		}
+		if !created || d.attrKey == nil || d.mode == obfuscate.Decode {
+			continue
+		}
+		if err := d.transferAttributes(source, target, time.Time{}); err != nil {
+			d.logError("failed to preserve the directory attributes", err, slog.String(obfuscate.LogKeyInput, source), slog.String(obfuscate.LogKeyOutput, target))
+			d.reportError(fmt.Errorf("failed to preserve the attributes of '%s': %w", source, err))
+		}
+	}
+	return target, nil
+}
+
+// recordDirAttributes loads the saved attributes of the encrypted directory, which will be restored
+// on the decrypted directory once it gets released (See dirRestorer).
+func (d *DirectoryWatcherTap) recordDirAttributes(input, output string) error {
+	attrs, err := loadAttributes(d.attrKey, input)
+	if err != nil || attrs == nil {
+		return err
+	}
+	d.dirs.record(output, attrs)
+	return nil
+}
+
+// releaseDirs releases the target directories of the output, so that their attributes get restored
+// once they have no more outputs in progress (See dirRestorer)
+func (d *DirectoryWatcherTap) releaseDirs(output string) {
+	if d.dirs == nil {
+		return
+	}
+	if err := d.dirs.release(output); err != nil {
+		d.logError("failed to restore the directory attributes", err, slog.String(obfuscate.LogKeyOutput, output))
+		d.reportError(fmt.Errorf("failed to restore the directory attributes of '%s': %w", output, err))
+	}
+}
+
+// transferAttributes saves the attributes of the input into the attributes file of the output (encryption),
+// or restores the saved attributes of the input on the output (decryption). See WithPreserveAttributes.
+// The access time of the input is replaced with atime, unless it's zero.
+func (d *DirectoryWatcherTap) transferAttributes(input, output string, atime time.Time) error {
+	if d.mode == obfuscate.Encode {
+		attrs, err := captureAttributes(input)
+		if err != nil {
+			return err
+		}
+		if !atime.IsZero() {
+			attrs.ATime = atime
+		}
+		return saveAttributes(d.attrKey, output, attrs)
+	}
+	attrs, err := loadAttributes(d.attrKey, input)
+	if err != nil || attrs == nil {
+		return err
+	}
+	return attrs.apply(output)
+}
+
+// track holds the new file back until it's been completely written (See ReadinessPolicy)
+func (d *DirectoryWatcherTap) track(path string, file os.FileInfo) {
+	if d.source == path || file.IsDir() || d.readiness.policy.isTemporary(file.Name()) {
+		return
+	}
+	if d.mode == obfuscate.Decode && !strings.HasSuffix(file.Name(), encodedFileExtension) {
+		return
+	}
+	if !d.filter.matches(path, file) {
+		d.logger.Debug("file filtered out", slog.String(obfuscate.LogKeyInput, path))
+		return
+	}
+	if d.state != nil && d.state.unchanged(path) {
+		d.logger.Debug("file already processed", slog.String(obfuscate.LogKeyInput, path))
+		return
+	}
+	d.readiness.add(path, file, d.watcher.closed())
+}
+
+// whenReady dispatches the file which has been completely written, if its size is within the limits (See Filter)
+func (d *DirectoryWatcherTap) whenReady(path string, file os.FileInfo) {
+	if !d.filter.matchesSize(file) {
+		d.logger.Debug("file filtered out", slog.String(obfuscate.LogKeyInput, path), slog.Int64(obfuscate.LogKeyBytes, file.Size()))
+		return
+	}
+	if d.state != nil {
+		if _, ok := d.state.lookup(path); ok {
+			same, err := d.state.sameContent(path, file)
+			if err != nil {
+				d.logError("failed to check the processing state", err, slog.String(obfuscate.LogKeyInput, path))
+			}
+			if same {
+				d.logger.Debug("file already processed", slog.String(obfuscate.LogKeyInput, path))
+				return
+			}
+			d.logger.Info("processed file has been modified", slog.String(obfuscate.LogKeyInput, path))
+		}
+	}
+	d.dispatchWorkUnit(path, file)
+}
+
 func (d *DirectoryWatcherTap) dispatchWorkUnit(path string, file os.FileInfo) {
 
 	if !d.IsOpen() || d.source == path || file.IsDir() {
 		return
 	}
 
-	input, inputFullPath, err := d.openInputFile(path)
+	w, err := d.createWorkUnit(path, file)
 	if err != nil {
-		d.reportError(fmt.Errorf("failed to open '%s': %s", path, err))
+		d.logError("failed to create the work unit", err, slog.String(obfuscate.LogKeyInput, path))
+		d.reportError(err)
 		return
 	}
+	inputPath, outputPath := w.Metadata[inputFullMetadataKey].(string), w.Metadata[outputFullMetadataKey].(string)
+	d.logger.Debug("work unit dispatched",
+		slog.String(obfuscate.LogKeyUnit, w.ID),
+		slog.String(obfuscate.LogKeyInput, inputPath),
+		slog.String(obfuscate.LogKeyOutput, outputPath))
+
+	// The spans of the engine will be the children of the dispatch span
+	ctx, span := d.tracer.Start(w.Context(), obfuscate.SpanDispatch, w)
+	w.SetContext(ctx)
+	span.SetAttribute(obfuscate.LogKeyUnit, w.ID)
+	span.SetAttribute(obfuscate.LogKeyInput, inputPath)
+	span.SetAttribute(obfuscate.LogKeyOutput, outputPath)
+	span.SetAttribute(obfuscate.LogKeyBytes, w.Size)
+	defer span.End(nil)
+
+	if d.report {
+		input, output := d.parseMetadata(w.Metadata)
+		d.reportProgress(&Result{
+			Status: w.Task.Status(),
+			Input:  input,
+			Output: output,
+		})
+	}
+
+	select {
+	case d.pipe <- w:
+	case <-d.watcher.closed():
+		// The tap has been closed while the unit was being dispatched
+		d.whenDone(w)
+	}
+}
+
+func (d *DirectoryWatcherTap) createWorkUnit(path string, file os.FileInfo) (*obfuscate.WorkUnit, error) {
+	input, inputFullPath, err := d.openInputFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
 
 	name := file.Name()
+	outputName, err := d.outputName(name)
+	if err != nil {
+		input.Close()
+		return nil, fmt.Errorf("failed to map the name of '%s': %w", path, err)
+	}
 
-	output, outputFullPath, err := d.createOutputFile(name, inputFullPath)
+	output, outputFullPath, err := d.createOutputFile(outputName, inputFullPath)
 	if err != nil {
-		d.reportError(fmt.Errorf("failed to create '%s': %s", outputFullPath, err))
-		return
+		input.Close()
+		return nil, fmt.Errorf("failed to create '%s': %w", outputFullPath, err)
 	}
 
-	t := obfuscate.NewTask(obfuscate.Encode, input, output)
+	t := obfuscate.NewTask(d.mode, input, output)
 	w := obfuscate.NewWorkUnit(t, d.master, d.whenDone)
-	outName := name + encodedFileExtension
+	w.Size = file.Size()
 	w.Metadata[inputMetadataKey] = name
-	w.Metadata[outputMetadataKey] = outName
+	w.Metadata[outputMetadataKey] = outputName
 	w.Metadata[inputFullMetadataKey] = inputFullPath
 	w.Metadata[outputFullMetadataKey] = outputFullPath
-	if d.report {
-		d.reportProgress(&Result{
-			Status: t.Status(),
-			Input: File{
-				Name: name,
-				Path: inputFullPath,
-			},
-			Output: File{
-				Name: outName,
-				Path: outputFullPath,
-			},
-		})
+	w.Metadata[outputTempMetadataKey] = output.Name()
+	w.Metadata[inputModTimeMetadataKey] = file.ModTime().Format(time.RFC3339Nano)
+	if d.attrKey != nil && d.mode == obfuscate.Encode {
+		// The access time changes once the input gets read
+		if atime, err := accessTime(inputFullPath); err == nil {
+			w.Metadata[inputATimeMetadataKey] = atime.Format(time.RFC3339Nano)
+		}
+	}
+	if d.dedup != nil {
+		if err := d.dedup.track(w); err != nil {
+			input.Close()
+			output.Close()
+			os.Remove(output.Name())
+			d.releaseDirs(outputFullPath)
+			return nil, err
+		}
+	}
+	if d.state != nil {
+		if err := d.state.track(w); err != nil {
+			if d.dedup != nil {
+				d.dedup.discard(w)
+			}
+			input.Close()
+			output.Close()
+			os.Remove(output.Name())
+			d.releaseDirs(outputFullPath)
+			return nil, err
+		}
 	}
+	return w, nil
+}
 
-	d.pipe <- w
+// outputName returns the name of the output file of the input (See WithNameEncryption)
+func (d *DirectoryWatcherTap) outputName(name string) (string, error) {
+	if d.mode == obfuscate.Decode {
+		name = strings.TrimSuffix(name, encodedFileExtension)
+	}
+	if d.names != nil {
+		var err error
+		if name, err = d.mapName(name, false); err != nil {
+			return "", err
+		}
+	}
+	if d.mode == obfuscate.Encode {
+		name += encodedFileExtension
+	}
+	return name, nil
+}
+
+// mapName encrypts (or decrypts) the file name or the relative path based on the operation of the tap
+func (d *DirectoryWatcherTap) mapName(name string, isPath bool) (string, error) {
+	switch {
+	case d.mode == obfuscate.Encode && isPath:
+		encrypted, err := d.names.EncryptPath(name)
+		if err != nil {
+			return "", err
+		}
+		for _, part := range strings.Split(filepath.ToSlash(encrypted), "/") {
+			if len(part)+tempNameOverhead > maxNameLength {
+				return "", fmt.Errorf("%w: '%s'", obfuscate.ErrNameTooLong, name)
+			}
+		}
+		return encrypted, nil
+	case d.mode == obfuscate.Encode:
+		encrypted, err := d.names.EncryptName(name)
+		if err != nil {
+			return "", err
+		}
+		if len(encrypted)+len(encodedFileExtension)+tempNameOverhead > maxNameLength {
+			return "", fmt.Errorf("%w: '%s'", obfuscate.ErrNameTooLong, name)
+		}
+		return encrypted, nil
+	case isPath:
+		return d.names.DecryptPath(name)
+	}
+	token, suffix := splitConflictSuffix(name)
+	decrypted, err := d.names.DecryptName(token)
+	if err != nil {
+		return "", err
+	}
+	return withConflictSuffix(decrypted, suffix), nil
 }
 
 func (d *DirectoryWatcherTap) parseMetadata(metadata obfuscate.MetadataMap) (File, File) {
@@ -355,13 +1051,15 @@ func (d *DirectoryWatcherTap) parseMetadata(metadata obfuscate.MetadataMap) (Fil
 func (d *DirectoryWatcherTap) createTargetSubDirectory(path, name string) {
 	abs, err := filepath.Abs(filepath.Join(d.target, name))
 	if err != nil {
-		d.reportError(fmt.Errorf("failed to resolve the path to '%s': %s", path, err))
+		d.logError("failed to resolve the target sub-directory", err, slog.String(obfuscate.LogKeyInput, path))
+		d.reportError(fmt.Errorf("failed to resolve the path to '%s': %w", path, err))
 		return
 	}
 
 	dir, err := createDirIfNotExist(abs)
 	if err != nil {
-		d.reportError(fmt.Errorf("failed to create '%s': %s", dir, err))
+		d.logError("failed to create the target sub-directory", err, slog.String(obfuscate.LogKeyOutput, dir))
+		d.reportError(fmt.Errorf("failed to create '%s': %w", dir, err))
 		return
 	}
 }
@@ -0,0 +1,478 @@
+package taps
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+func TestDecryptingTap(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	source, encrypted, decrypted := t.TempDir(), t.TempDir(), t.TempDir()
+	readiness := WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond})
+	files := map[string]string{
+		"file.txt":        "content",
+		"dir/another.txt": strings.Repeat("another content", 1000),
+		"empty.txt":       "",
+	}
+	for name, content := range files {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encrypting, err := NewDirectoryWatcherTapWithOptions(source, encrypted, master, readiness)
+	if err != nil {
+		t.Fatalf("failed to create the encrypting tap: %v", err)
+	}
+	runTap(t, encrypting, len(files))
+
+	// The files without the encoded extension are not decrypted
+	if err := os.WriteFile(filepath.Join(encrypted, "plain.txt"), []byte("plain"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	decrypting, err := NewDecryptingDirectoryWatcherTap(encrypted, decrypted, master, readiness)
+	if err != nil {
+		t.Fatalf("failed to create the decrypting tap: %v", err)
+	}
+	for _, r := range processTree(t, decrypting, len(files)) {
+		if r.Status != obfuscate.Completed {
+			t.Errorf("expected '%s' to be decrypted, but received '%v'", r.Input.Path, r.Error)
+		}
+		if strings.HasSuffix(r.Output.Name, encodedFileExtension) {
+			t.Errorf("expected the encoded extension to be removed, actual '%s'", r.Output.Name)
+		}
+	}
+
+	for name, expected := range files {
+		content, err := os.ReadFile(filepath.Join(decrypted, filepath.FromSlash(name)))
+		if err != nil || string(content) != expected {
+			t.Errorf("expected the content of '%s' to be restored, actual '%d' bytes (%v)", name, len(content), err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(decrypted, "plain")); !os.IsNotExist(err) {
+		t.Errorf("expected the plain file not to be decrypted, actual '%v'", err)
+	}
+}
+
+func TestDecryptingTapWrongKey(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	another, _ := obfuscate.KeyFromPassword("another password")
+	source, encrypted, decrypted := t.TempDir(), t.TempDir(), t.TempDir()
+	readiness := WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond})
+	if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypting, err := NewDirectoryWatcherTapWithOptions(source, encrypted, master, readiness)
+	if err != nil {
+		t.Fatalf("failed to create the encrypting tap: %v", err)
+	}
+	runTap(t, encrypting, 1)
+
+	decrypting, err := NewDecryptingDirectoryWatcherTap(encrypted, decrypted, another, readiness, WithDeleteCompleted(true))
+	if err != nil {
+		t.Fatalf("failed to create the decrypting tap: %v", err)
+	}
+	for _, r := range processTree(t, decrypting, 1) {
+		if r.Status != obfuscate.Failed || !errors.Is(r.Error, obfuscate.ErrWrongKey) {
+			t.Errorf("expected '%v' as error, but received '%v'", obfuscate.ErrWrongKey, r.Error)
+		}
+	}
+
+	// The failed output must be removed and the input must be kept
+	if entries, _ := os.ReadDir(decrypted); len(entries) != 0 {
+		t.Errorf("expected no output, actual %v", entries)
+	}
+	if _, err := os.Stat(filepath.Join(encrypted, "file.txt.xv")); err != nil {
+		t.Errorf("expected the input to be kept, actual '%v'", err)
+	}
+}
+
+func TestDecryptingTapDeduplication(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	_, err := NewDecryptingDirectoryWatcherTap(t.TempDir(), t.TempDir(), master, WithDeduplication(DedupSkip))
+	if !errors.Is(err, obfuscate.ErrInvalidConfig) {
+		t.Errorf("expected '%v' as error, but received '%v'", obfuscate.ErrInvalidConfig, err)
+	}
+}
+
+func TestNameEncryption(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	source, encrypted, decrypted := t.TempDir(), t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"file.txt":            "content",
+		"dir/sub/another.txt": "another content",
+	}
+	for name, content := range files {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encrypting, err := NewDirectoryWatcherTapWithOptions(source, encrypted, master, WithNameEncryption(true), WithPersistentState(true), WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to create the encrypting tap: %v", err)
+	}
+	runTap(t, encrypting, len(files))
+
+	// The target tree must not leak the names of the files and the directories
+	err = filepath.Walk(encrypted, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"file", "dir", "sub", "another"} {
+			if strings.Contains(filepath.Base(path), name) && path != encrypted {
+				t.Errorf("expected the encrypted tree not to contain '%s', actual '%s'", name, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(encrypted, DefaultStateFile)); strings.Contains(string(content), ".txt") {
+		t.Errorf("expected the state file not to contain the names of the files, actual '%s'", content)
+	}
+	os.Remove(filepath.Join(encrypted, DefaultStateFile))
+
+	decrypting, err := NewDecryptingDirectoryWatcherTap(encrypted, decrypted, master, WithNameEncryption(true), WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to create the decrypting tap: %v", err)
+	}
+	runTap(t, decrypting, len(files))
+
+	for name, expected := range files {
+		content, err := os.ReadFile(filepath.Join(decrypted, filepath.FromSlash(name)))
+		if err != nil || string(content) != expected {
+			t.Errorf("expected '%s' as the content of '%s', actual '%s' (%v)", expected, name, content, err)
+		}
+	}
+}
+
+func TestNameEncryptionConflicts(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	readiness := WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond})
+	testCases := []struct {
+		title    string
+		policy   ConflictPolicy
+		expected map[string]string
+	}{
+		{
+			title:    "rename",
+			policy:   ConflictRename,
+			expected: map[string]string{"file.txt": "first", "file.txt-1": "second"},
+		},
+		{
+			title:    "timestamp",
+			policy:   ConflictTimestamp,
+			expected: map[string]string{"file.txt": "first"},
+		},
+		{
+			title:    "version",
+			policy:   ConflictVersion,
+			expected: map[string]string{"file.txt": "second"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			source, encrypted, decrypted := t.TempDir(), t.TempDir(), t.TempDir()
+			for _, content := range []string{"first", "second"} {
+				if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+				encrypting, err := NewDirectoryWatcherTapWithOptions(source, encrypted, master, WithNameEncryption(true), WithConflictPolicy(tc.policy), readiness)
+				if err != nil {
+					t.Fatalf("failed to create the encrypting tap: %v", err)
+				}
+				runTap(t, encrypting, 1)
+			}
+
+			entries, _ := os.ReadDir(encrypted)
+			if len(entries) != 2 {
+				t.Fatalf("expected 2 encrypted files, actual %d", len(entries))
+			}
+			// The suffixed name is always the longer one
+			current, previous := entries[0].Name(), entries[1].Name()
+			if len(current) > len(previous) {
+				current, previous = previous, current
+			}
+			if tc.policy == ConflictVersion {
+				// The history keeps the encrypted name intact, so that it can be decrypted once restored
+				if previous != current+".1" {
+					t.Errorf("expected '%s.1' as the previous version, actual '%s'", current, previous)
+				}
+			} else if token, suffix := splitConflictSuffix(strings.TrimSuffix(previous, encodedFileExtension)); token+encodedFileExtension != current || suffix == "" {
+				t.Errorf("expected the conflict suffix of '%s' to be added outside the encrypted name '%s'", previous, current)
+			}
+
+			decrypting, err := NewDecryptingDirectoryWatcherTap(encrypted, decrypted, master, WithNameEncryption(true), readiness)
+			if err != nil {
+				t.Fatalf("failed to create the decrypting tap: %v", err)
+			}
+			expected := len(tc.expected)
+			if tc.policy == ConflictTimestamp {
+				expected = 2
+			}
+			runTap(t, decrypting, expected)
+
+			decryptedEntries, _ := os.ReadDir(decrypted)
+			if len(decryptedEntries) != expected {
+				t.Errorf("expected %d decrypted files, actual %d", expected, len(decryptedEntries))
+			}
+			for _, entry := range decryptedEntries {
+				if tc.policy == ConflictTimestamp && entry.Name() != "file.txt" && !strings.HasPrefix(entry.Name(), "file.txt-") {
+					t.Errorf("expected the timestamp suffix to be added to the decrypted name, actual '%s'", entry.Name())
+				}
+			}
+			for name, content := range tc.expected {
+				actual, err := os.ReadFile(filepath.Join(decrypted, name))
+				if err != nil || string(actual) != content {
+					t.Errorf("expected '%s' as the content of '%s', actual '%s' (%v)", content, name, actual, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNameEncryptionLength(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	target := t.TempDir()
+	tap, err := NewDirectoryWatcherTapWithOptions(t.TempDir(), target, master, WithNameEncryption(true))
+	if err != nil {
+		t.Fatalf("failed to create the tap: %v", err)
+	}
+	defer tap.Close()
+
+	// The longest name which can be encrypted
+	longest := 0
+	for n := 1; n < maxNameLength; n++ {
+		if _, err := tap.outputName(strings.Repeat("a", n)); err != nil {
+			if !errors.Is(err, obfuscate.ErrNameTooLong) {
+				t.Fatalf("expected '%v' as error, but received '%v'", obfuscate.ErrNameTooLong, err)
+			}
+			break
+		}
+		longest = n
+	}
+	if longest == 0 {
+		t.Fatal("expected the short names to be encrypted")
+	}
+
+	name, _ := tap.outputName(strings.Repeat("a", longest))
+	output := filepath.Join(target, name)
+	temp := writeTemp(t, output, "content")
+	if err := commitFile(temp, output); err != nil {
+		t.Fatalf("failed to commit the output: %v", err)
+	}
+	if err := saveAttributes(make([]byte, 32), output, &fileAttributes{}); err != nil {
+		t.Errorf("expected the attributes of the longest output to be stored, but received '%v'", err)
+	}
+	if _, err := tap.outputName(strings.Repeat("a", longest+1)); !errors.Is(err, obfuscate.ErrNameTooLong) {
+		t.Errorf("expected '%v' as error, but received '%v'", obfuscate.ErrNameTooLong, err)
+	}
+}
+
+func TestPreserveAttributes(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	source, encrypted, decrypted := t.TempDir(), t.TempDir(), t.TempDir()
+	readiness := WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond})
+
+	atime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	mtime := time.Date(2002, 3, 4, 5, 6, 7, 0, time.UTC)
+	dir := filepath.Join(source, "read-only")
+	os.Mkdir(dir, 0700)
+	names := []string{"first.txt", "second.txt"}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, atime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dir, atime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700)
+
+	encrypting, err := NewDirectoryWatcherTapWithOptions(source, encrypted, master, WithPreserveAttributes(true), readiness)
+	if err != nil {
+		t.Fatalf("failed to create the encrypting tap: %v", err)
+	}
+	runTap(t, encrypting, len(names))
+
+	decrypting, err := NewDecryptingDirectoryWatcherTap(encrypted, decrypted, master, WithPreserveAttributes(true), readiness)
+	if err != nil {
+		t.Fatalf("failed to create the decrypting tap: %v", err)
+	}
+	runTap(t, decrypting, len(names))
+	defer os.Chmod(filepath.Join(decrypted, "read-only"), 0700)
+
+	for _, name := range append(names, "") {
+		path := filepath.Join(decrypted, "read-only", name)
+		expectedMode := os.FileMode(0640)
+		if name == "" {
+			expectedMode = 0500
+		}
+		attrs, err := captureAttributes(path)
+		if err != nil {
+			t.Fatalf("failed to read the attributes of '%s': %v", path, err)
+		}
+		if attrs.Mode != expectedMode {
+			t.Errorf("expected '%v' as the mode of '%s', actual '%v'", expectedMode, path, attrs.Mode)
+		}
+		if !attrs.MTime.Equal(mtime) {
+			t.Errorf("expected '%v' as the modification time of '%s', actual '%v'", mtime, path, attrs.MTime)
+		}
+		if name != "" && attrs.Owner && !attrs.ATime.Equal(atime) {
+			t.Errorf("expected '%v' as the access time of '%s', actual '%v'", atime, path, attrs.ATime)
+		}
+	}
+}
+
+// runTap processes the existing files of the source directory of the tap successfully
+func TestDispatchSpan(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	source := t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tracer := &parentTracer{parents: make(map[string]string)}
+	tap, err := NewDirectoryWatcherTapWithOptions(source, t.TempDir(), master, WithTracer(tracer), WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to create the tap: %v", err)
+	}
+	processTree(t, tap, 1, obfuscate.WithTracer(tracer))
+
+	tracer.mux.Lock()
+	defer tracer.mux.Unlock()
+	if parent := tracer.parents[obfuscate.SpanDispatch]; parent != "" {
+		t.Errorf("expected the dispatch span to be the root of the trace, actual parent '%s'", parent)
+	}
+	for _, name := range []string{obfuscate.SpanQueue, obfuscate.SpanProcess + obfuscate.Encode.String()} {
+		if parent := tracer.parents[name]; parent != obfuscate.SpanDispatch {
+			t.Errorf("expected '%s' to be the parent of '%s', actual '%s'", obfuscate.SpanDispatch, name, parent)
+		}
+	}
+}
+
+type spanKey struct{}
+
+// parentTracer records the name of the parent span of every span
+type parentTracer struct {
+	parents map[string]string
+	mux     sync.Mutex
+}
+
+func (p *parentTracer) Start(ctx context.Context, name string, w *obfuscate.WorkUnit) (context.Context, obfuscate.Span) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	parent, _ := w.Context().Value(spanKey{}).(string)
+	p.parents[name] = parent
+	return obfuscate.NoopTracer().Start(context.WithValue(ctx, spanKey{}, name), name, w)
+}
+
+func TestPreserveAttributesWithVersions(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	key, _ := master.DeriveKey(attributesKeyPurpose)
+	source, encrypted := t.TempDir(), t.TempDir()
+	input := filepath.Join(source, "file.txt")
+
+	modes := []os.FileMode{0600, 0640, 0644}
+	for _, mode := range modes {
+		if err := os.WriteFile(input, []byte(mode.String()), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(input, mode); err != nil {
+			t.Fatal(err)
+		}
+		tap, err := NewDirectoryWatcherTapWithOptions(source, encrypted, master,
+			WithPreserveAttributes(true),
+			WithConflictPolicy(ConflictVersion),
+			WithVersionRetention(1),
+			WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond}))
+		if err != nil {
+			t.Fatalf("failed to create the tap: %v", err)
+		}
+		runTap(t, tap, 1)
+	}
+
+	// The attributes files of the dropped versions must have been removed
+	entries, _ := os.ReadDir(encrypted)
+	if len(entries) != 4 {
+		t.Errorf("expected 2 versions with their attributes in the target directory, actual %d files", len(entries))
+	}
+	output := filepath.Join(encrypted, "file.txt"+encodedFileExtension)
+	for path, expected := range map[string]os.FileMode{output: modes[2], versionPath(output, 1): modes[1]} {
+		attrs, err := loadAttributes(key, path)
+		if err != nil || attrs == nil {
+			t.Fatalf("failed to load the attributes of '%s': %v", path, err)
+		}
+		if attrs.Mode != expected {
+			t.Errorf("expected '%v' as the mode of '%s', actual '%v'", expected, path, attrs.Mode)
+		}
+	}
+}
+
+func runTap(t *testing.T, tap *DirectoryWatcherTap, expected int) {
+	t.Helper()
+	for _, r := range processTree(t, tap, expected) {
+		if r.Status != obfuscate.Completed {
+			t.Errorf("expected '%s' to be processed, but received '%v'", r.Input.Path, r.Error)
+		}
+	}
+}
+
+// processTree processes the existing files of the source directory of the tap, and returns the results
+func processTree(t *testing.T, tap *DirectoryWatcherTap, expected int, opts ...obfuscate.EngineOption) []*Result {
+	t.Helper()
+	tap.SwitchProgressReport(true)
+	engine, err := obfuscate.NewEngineWithOptions(tap, opts...)
+	if err != nil {
+		t.Fatalf("failed to create the engine: %v", err)
+	}
+
+	// The progress reports must be drained until the engine gets stopped
+	results := make(chan *Result, expected)
+	go func() {
+		for r := range tap.Progress() {
+			if r.Status == obfuscate.Completed || r.Status == obfuscate.Failed {
+				select {
+				case results <- r:
+				default:
+				}
+			}
+		}
+	}()
+
+	engine.Start()
+	defer engine.Stop()
+	processed := make([]*Result, 0, expected)
+	for i := 0; i < expected; i++ {
+		select {
+		case r := <-results:
+			processed = append(processed, r)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected %d files to be processed, actual %d", expected, i)
+		}
+	}
+	return processed
+}
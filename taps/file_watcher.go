@@ -0,0 +1,180 @@
+package taps
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+// Backend is the mechanism the directory watcher tap uses to detect the new files
+type Backend int8
+
+const (
+	// BackendAuto uses the native filesystem notifications (i.e. inotify on Linux) where available,
+	// and falls back to polling on network filesystems or if the native watcher cannot be set up.
+	BackendAuto Backend = iota
+	// BackendNative uses the native filesystem notifications of the operating system
+	BackendNative
+	// BackendPolling checks the whole directory tree for the new files every polling interval
+	BackendPolling
+)
+
+// String returns the string representation of the backend
+func (b Backend) String() string {
+	switch b {
+	case BackendAuto:
+		return "auto"
+	case BackendNative:
+		return "native"
+	case BackendPolling:
+		return "polling"
+	}
+	return "unknown"
+}
+
+// MarshalText returns the text representation of the backend
+func (b Backend) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText parses the text representation of the backend (i.e. "polling")
+func (b *Backend) UnmarshalText(text []byte) error {
+	for backend := BackendAuto; backend <= BackendPolling; backend++ {
+		if backend.String() == string(text) {
+			*b = backend
+			return nil
+		}
+	}
+	return invalidConfig("unknown watcher backend '%s'", text)
+}
+
+// fileEvent represents a new file in the watched directory tree, including the files which have been renamed
+type fileEvent struct {
+	path string
+	info os.FileInfo
+}
+
+// fileWatcher detects the new files of a directory tree. The hidden files are ignored.
+type fileWatcher interface {
+	// backend returns the mechanism of the watcher
+	backend() Backend
+	// files returns the files which existed in the tree when the watcher was created
+	files() map[string]os.FileInfo
+	// start watches the tree until the watcher gets closed
+	start() error
+	// events returns the channel on which the new files will be reported
+	events() <-chan fileEvent
+	// errors returns the channel on which the failures will be reported
+	errors() <-chan error
+	// closed returns a channel which will be closed once the watcher has stopped
+	closed() <-chan struct{}
+	// close stops the watcher
+	close()
+}
+
+// newFileWatcher creates a watcher for the root directory using the requested backend
+func newFileWatcher(root string, backend Backend, interval time.Duration) (fileWatcher, error) {
+	switch backend {
+	case BackendNative:
+		return newNativeWatcher(root)
+	case BackendPolling:
+		return newPollingWatcher(root, interval)
+	}
+
+	if isNetworkFilesystem(root) {
+		return newPollingWatcher(root, interval)
+	}
+	w, err := newNativeWatcher(root)
+	if err != nil {
+		return newPollingWatcher(root, interval)
+	}
+	return w, nil
+}
+
+// pollingWatcher checks the directory tree for the new files every interval
+type pollingWatcher struct {
+	watcher  *watcher.Watcher
+	interval time.Duration
+	ev       chan fileEvent
+	errs     chan error
+	done     chan struct{}
+	// closed if the watcher fails to start
+	failed chan struct{}
+}
+
+func newPollingWatcher(root string, interval time.Duration) (*pollingWatcher, error) {
+	w := watcher.New()
+	// The files written under a temporary name are detected once they've been renamed
+	w.FilterOps(watcher.Create, watcher.Rename, watcher.Move)
+	w.IgnoreHiddenFiles(true)
+
+	if err := w.AddRecursive(root); err != nil {
+		return nil, fmt.Errorf("failed to watch '%s': %w", root, err)
+	}
+
+	return &pollingWatcher{
+		watcher:  w,
+		interval: interval,
+		ev:       make(chan fileEvent),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+		failed:   make(chan struct{}),
+	}, nil
+}
+
+func (p *pollingWatcher) backend() Backend {
+	return BackendPolling
+}
+
+func (p *pollingWatcher) files() map[string]os.FileInfo {
+	return p.watcher.WatchedFiles()
+}
+
+func (p *pollingWatcher) start() error {
+	go func() {
+		defer close(p.done)
+		for {
+			select {
+			case event := <-p.watcher.Event:
+				info := event.FileInfo
+				if event.Op != watcher.Create {
+					// The file info of the renamed files carries the old name
+					var err error
+					if info, err = os.Stat(event.Path); err != nil {
+						continue
+					}
+				}
+				p.ev <- fileEvent{path: event.Path, info: info}
+			case err := <-p.watcher.Error:
+				p.errs <- err
+			case <-p.watcher.Closed:
+				return
+			case <-p.failed:
+				return
+			}
+		}
+	}()
+	err := p.watcher.Start(p.interval)
+	if err != nil {
+		close(p.failed)
+	}
+	return err
+}
+
+func (p *pollingWatcher) events() <-chan fileEvent {
+	return p.ev
+}
+
+func (p *pollingWatcher) errors() <-chan error {
+	return p.errs
+}
+
+func (p *pollingWatcher) closed() <-chan struct{} {
+	return p.done
+}
+
+func (p *pollingWatcher) close() {
+	p.watcher.Close()
+}
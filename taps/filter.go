@@ -0,0 +1,296 @@
+package taps
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// DefaultIgnoreFile is the default name of the per directory ignore files
+const DefaultIgnoreFile = ".xvaultignore"
+
+// Filter selects the files of the source directory which will be processed by the tap.
+// The zero value processes all the files which are not hidden.
+//
+// The patterns are matched against the paths relative to the source directory, using "/" as the separator.
+// The glob patterns support "**" to match any number of directories (i.e. "**/*.pdf").
+// A file is processed if it matches one of the include patterns (if any) and none of the exclude patterns.
+//
+// Every directory of the source tree can also have an ignore file (See IgnoreFile) which follows the syntax
+// of .gitignore: one pattern per line, "#" for comments, "!" to re-include the files, a trailing "/" to only
+// match the directories and a leading "/" to anchor the pattern to the directory of the ignore file.
+// The patterns of the deeper ignore files take precedence.
+type Filter struct {
+	// Include the glob patterns of the files to process. Empty means all the files.
+	Include []string
+	// Exclude the glob patterns of the files to ignore (i.e. "**/*.swp")
+	Exclude []string
+	// IncludeRegex the regular expressions of the files to process. Empty means all the files.
+	IncludeRegex []string
+	// ExcludeRegex the regular expressions of the files to ignore
+	ExcludeRegex []string
+	// MinSize the minimum size of the files in bytes. Zero means no limit.
+	MinSize int64
+	// MaxSize the maximum size of the files in bytes. Zero means no limit.
+	MaxSize int64
+	// MinAge the files are held back until they have not been modified for at least MinAge.
+	MinAge time.Duration
+	// MaxAge the files which have not been modified for longer than MaxAge are ignored. Zero means no limit.
+	MaxAge time.Duration
+	// IgnoreFile the name of the per directory ignore files (Default: DefaultIgnoreFile)
+	IgnoreFile string
+}
+
+// fileFilter is the compiled version of a Filter
+type fileFilter struct {
+	root         string
+	include      []string
+	exclude      []string
+	includeRegex []*regexp.Regexp
+	excludeRegex []*regexp.Regexp
+	minSize      int64
+	maxSize      int64
+	minAge       time.Duration
+	maxAge       time.Duration
+	ignore       *ignoreFiles
+}
+
+func newFileFilter(root string, f Filter) (*fileFilter, error) {
+	if f.MinSize < 0 || f.MaxSize < 0 || (f.MaxSize > 0 && f.MaxSize < f.MinSize) {
+		return nil, invalidConfig("the size limits must satisfy 0 <= min <= max")
+	}
+	if f.MinAge < 0 || f.MaxAge < 0 || (f.MaxAge > 0 && f.MaxAge < f.MinAge) {
+		return nil, invalidConfig("the age limits must satisfy 0 <= min <= max")
+	}
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, invalidConfig("invalid glob pattern '%s'", pattern)
+		}
+	}
+	includeRegex, err := compileRegex(f.IncludeRegex)
+	if err != nil {
+		return nil, err
+	}
+	excludeRegex, err := compileRegex(f.ExcludeRegex)
+	if err != nil {
+		return nil, err
+	}
+	ignoreFile := f.IgnoreFile
+	if ignoreFile == "" {
+		ignoreFile = DefaultIgnoreFile
+	}
+	if strings.ContainsAny(ignoreFile, `/\`) {
+		return nil, invalidConfig("the ignore file must be a file name")
+	}
+
+	return &fileFilter{
+		root:         root,
+		include:      f.Include,
+		exclude:      f.Exclude,
+		includeRegex: includeRegex,
+		excludeRegex: excludeRegex,
+		minSize:      f.MinSize,
+		maxSize:      f.MaxSize,
+		minAge:       f.MinAge,
+		maxAge:       f.MaxAge,
+		ignore:       newIgnoreFiles(root, ignoreFile),
+	}, nil
+}
+
+func compileRegex(expressions []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(expressions))
+	for i, expr := range expressions {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, invalidConfig("invalid regular expression '%s': %s", expr, err)
+		}
+		compiled[i] = re
+	}
+	return compiled, nil
+}
+
+// matches returns true if the file needs to be processed, regardless of its size
+func (f *fileFilter) matches(file string, info os.FileInfo) bool {
+	rel, err := filepath.Rel(f.root, file)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	if f.maxAge > 0 && time.Since(info.ModTime()) > f.maxAge {
+		return false
+	}
+
+	if len(f.include) > 0 || len(f.includeRegex) > 0 {
+		if !matchGlob(f.include, rel) && !matchRegex(f.includeRegex, rel) {
+			return false
+		}
+	}
+	if matchGlob(f.exclude, rel) || matchRegex(f.excludeRegex, rel) {
+		return false
+	}
+	return !f.ignore.ignored(rel)
+}
+
+// matchesSize returns true if the size of the completely written file is within the limits
+func (f *fileFilter) matchesSize(info os.FileInfo) bool {
+	if info.Size() < f.minSize {
+		return false
+	}
+	return f.maxSize == 0 || info.Size() <= f.maxSize
+}
+
+func matchGlob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(expressions []*regexp.Regexp, rel string) bool {
+	for _, re := range expressions {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreRule is a pattern of an ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreList is the parsed content of an ignore file
+type ignoreList struct {
+	rules   []ignoreRule
+	modTime time.Time
+	size    int64
+}
+
+// ignoreFiles loads the ignore files of the source tree on demand.
+// The parsed files are cached until they get modified.
+type ignoreFiles struct {
+	root  string
+	name  string
+	cache map[string]*ignoreList
+	mux   sync.Mutex
+}
+
+func newIgnoreFiles(root, name string) *ignoreFiles {
+	return &ignoreFiles{
+		root:  root,
+		name:  name,
+		cache: make(map[string]*ignoreList),
+	}
+}
+
+// ignored returns true if the file (relative to the root) or one of its parent directories is ignored
+func (i *ignoreFiles) ignored(rel string) bool {
+	parts := strings.Split(rel, "/")
+	for n := 1; n <= len(parts); n++ {
+		// A file cannot be re-included if its parent directory has been ignored
+		if i.matches(parts[:n], n < len(parts)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches applies the ignore files of all the parent directories to the path
+func (i *ignoreFiles) matches(parts []string, isDir bool) bool {
+	ignored := false
+	for depth := 0; depth < len(parts); depth++ {
+		dir := path.Join(parts[:depth]...)
+		list := i.load(dir)
+		if list == nil {
+			continue
+		}
+		rel := path.Join(parts[depth:]...)
+		for _, rule := range list.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			name := rel
+			if !rule.anchored {
+				name = parts[len(parts)-1]
+			}
+			if doublestar.MatchUnvalidated(rule.pattern, name) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// load returns the ignore list of the directory (relative to the root) or nil if it does not have any
+func (i *ignoreFiles) load(dir string) *ignoreList {
+	file := filepath.Join(i.root, filepath.FromSlash(dir), i.name)
+	info, err := os.Stat(file)
+
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if err != nil {
+		delete(i.cache, dir)
+		return nil
+	}
+	if list, ok := i.cache[dir]; ok && list.modTime.Equal(info.ModTime()) && list.size == info.Size() {
+		return list
+	}
+
+	list, err := parseIgnoreFile(file)
+	if err != nil {
+		return nil
+	}
+	list.modTime, list.size = info.ModTime(), info.Size()
+	i.cache[dir] = list
+	return list
+}
+
+func parseIgnoreFile(file string) (*ignoreList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &ignoreList{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" || !doublestar.ValidatePattern(line) {
+			continue
+		}
+		rule.pattern = line
+		list.rules = append(list.rules, rule)
+	}
+	return list, scanner.Err()
+}
@@ -0,0 +1,226 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIgnoreFiles(t *testing.T) {
+	testCases := []struct {
+		title string
+		// the content of the ignore files by directory (relative to the root)
+		ignore   map[string]string
+		path     string
+		expected bool
+	}{
+		{
+			title:    "no_ignore_file",
+			path:     "file.txt",
+			expected: false,
+		},
+		{
+			title:    "comment_and_blank_lines",
+			ignore:   map[string]string{"": "# *.txt\n\n   \n"},
+			path:     "file.txt",
+			expected: false,
+		},
+		{
+			title:    "pattern_matches_the_name_at_any_depth",
+			ignore:   map[string]string{"": "*.log"},
+			path:     "dir/sub/file.log",
+			expected: true,
+		},
+		{
+			title:    "negation",
+			ignore:   map[string]string{"": "*.log\n!keep.log"},
+			path:     "dir/keep.log",
+			expected: false,
+		},
+		{
+			title:    "negation_order",
+			ignore:   map[string]string{"": "!keep.log\n*.log"},
+			path:     "keep.log",
+			expected: true,
+		},
+		{
+			title:    "anchored_pattern_matches_the_root",
+			ignore:   map[string]string{"": "/file.txt"},
+			path:     "file.txt",
+			expected: true,
+		},
+		{
+			title:    "anchored_pattern_does_not_match_the_sub_directories",
+			ignore:   map[string]string{"": "/file.txt"},
+			path:     "dir/file.txt",
+			expected: false,
+		},
+		{
+			title:    "pattern_with_separator_is_anchored",
+			ignore:   map[string]string{"": "dir/*.txt"},
+			path:     "other/dir/file.txt",
+			expected: false,
+		},
+		{
+			title:    "anchored_to_the_directory_of_the_ignore_file",
+			ignore:   map[string]string{"dir": "/file.txt"},
+			path:     "dir/file.txt",
+			expected: true,
+		},
+		{
+			title:    "dir_only_pattern_ignores_the_directory",
+			ignore:   map[string]string{"": "build/"},
+			path:     "build/output.bin",
+			expected: true,
+		},
+		{
+			title:    "dir_only_pattern_does_not_ignore_the_files",
+			ignore:   map[string]string{"": "build/"},
+			path:     "build",
+			expected: false,
+		},
+		{
+			title:    "file_cannot_be_re_included_in_an_ignored_directory",
+			ignore:   map[string]string{"": "build/\n!build/keep.bin"},
+			path:     "build/keep.bin",
+			expected: true,
+		},
+		{
+			title:    "deeper_ignore_file_re_includes",
+			ignore:   map[string]string{"": "*.log", "dir": "!*.log"},
+			path:     "dir/file.log",
+			expected: false,
+		},
+		{
+			title:    "deeper_ignore_file_excludes",
+			ignore:   map[string]string{"": "!*.log", "dir": "*.log"},
+			path:     "dir/file.log",
+			expected: true,
+		},
+		{
+			title:    "deeper_ignore_file_does_not_apply_to_the_parent",
+			ignore:   map[string]string{"dir": "*.log"},
+			path:     "file.log",
+			expected: false,
+		},
+		{
+			title:    "double_star",
+			ignore:   map[string]string{"": "docs/**/*.pdf"},
+			path:     "docs/a/b/file.pdf",
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			root := t.TempDir()
+			for dir, content := range tc.ignore {
+				path := filepath.Join(root, filepath.FromSlash(dir), DefaultIgnoreFile)
+				os.MkdirAll(filepath.Dir(path), 0700)
+				if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			i := newIgnoreFiles(root, DefaultIgnoreFile)
+			if actual := i.ignored(tc.path); actual != tc.expected {
+				t.Errorf("expected '%s' to be ignored %v, actual %v", tc.path, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIgnoreFileReload(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, DefaultIgnoreFile)
+	if err := os.WriteFile(path, []byte("*.log"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	i := newIgnoreFiles(root, DefaultIgnoreFile)
+	if !i.ignored("file.log") {
+		t.Errorf("expected 'file.log' to be ignored")
+	}
+
+	if err := os.WriteFile(path, []byte("*.txt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The cache is invalidated by the size and the modification time of the file
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Minute))
+	if i.ignored("file.log") || !i.ignored("file.txt") {
+		t.Errorf("expected the modified ignore file to be reloaded")
+	}
+
+	os.Remove(path)
+	if i.ignored("file.txt") {
+		t.Errorf("expected the removed ignore file not to apply")
+	}
+}
+
+func TestFileFilter(t *testing.T) {
+	testCases := []struct {
+		title    string
+		filter   Filter
+		path     string
+		age      time.Duration
+		expected bool
+	}{
+		{
+			title:    "zero_value",
+			path:     "dir/file.txt",
+			expected: true,
+		},
+		{
+			title:    "include",
+			filter:   Filter{Include: []string{"**/*.pdf"}},
+			path:     "dir/file.txt",
+			expected: false,
+		},
+		{
+			title:    "include_regex",
+			filter:   Filter{Include: []string{"**/*.pdf"}, IncludeRegex: []string{`\.txt$`}},
+			path:     "dir/file.txt",
+			expected: true,
+		},
+		{
+			title:    "exclude_wins_over_include",
+			filter:   Filter{Include: []string{"**/*.txt"}, Exclude: []string{"dir/**"}},
+			path:     "dir/file.txt",
+			expected: false,
+		},
+		{
+			title:    "exclude_regex",
+			filter:   Filter{ExcludeRegex: []string{`^dir/`}},
+			path:     "dir/file.txt",
+			expected: false,
+		},
+		{
+			title:    "max_age",
+			filter:   Filter{MaxAge: time.Hour},
+			path:     "file.txt",
+			age:      2 * time.Hour,
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			root := t.TempDir()
+			path := filepath.Join(root, filepath.FromSlash(tc.path))
+			os.MkdirAll(filepath.Dir(path), 0700)
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			modTime := time.Now().Add(-tc.age)
+			os.Chtimes(path, modTime, modTime)
+			info, _ := os.Stat(path)
+
+			f, err := newFileFilter(root, tc.filter)
+			if err != nil {
+				t.Fatalf("failed to create the filter: %v", err)
+			}
+			if actual := f.matches(path, info); actual != tc.expected {
+				t.Errorf("expected the filter to match '%s' %v, actual %v", tc.path, tc.expected, actual)
+			}
+		})
+	}
+}
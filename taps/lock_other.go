@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package taps
+
+// isLocked returns true if another process holds an advisory lock on the file.
+// The locks cannot be probed on this platform.
+func isLocked(path string) bool {
+	return false
+}
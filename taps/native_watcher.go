@@ -0,0 +1,211 @@
+package taps
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// nativeWatcher detects the new files using the filesystem notifications of the operating system (i.e. inotify).
+//
+// The notifications are not recursive, so every directory of the tree gets its own watch, including
+// the directories which are created while the tree is being watched. If the kernel's event queue overflows,
+// the events are lost and the whole tree will be rescanned to catch up.
+//
+// A file which gets created or renamed over a file that has already been reported (i.e. an editor
+// saving through a temporary file) is reported again, if its size or modification time has changed.
+type nativeWatcher struct {
+	root    string
+	watcher *fsnotify.Watcher
+	ev      chan fileEvent
+	errs    chan error
+	done    chan struct{}
+	// the files which existed when the watcher was created
+	initial map[string]os.FileInfo
+	// the files which have been reported by path and the watched directories.
+	// They're only accessed by the start loop once the watcher has been created.
+	known map[string]os.FileInfo
+	dirs  map[string]struct{}
+}
+
+func newNativeWatcher(root string) (*nativeWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	n := &nativeWatcher{
+		root:    root,
+		watcher: w,
+		ev:      make(chan fileEvent),
+		errs:    make(chan error),
+		done:    make(chan struct{}),
+		initial: make(map[string]os.FileInfo),
+		known:   make(map[string]os.FileInfo),
+		dirs:    make(map[string]struct{}),
+	}
+
+	err = n.scan(root, func(path string, info os.FileInfo) {
+		n.initial[path] = info
+		n.known[path] = info
+	})
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("failed to watch '%s': %w", root, err)
+	}
+	return n, nil
+}
+
+func (n *nativeWatcher) backend() Backend {
+	return BackendNative
+}
+
+func (n *nativeWatcher) files() map[string]os.FileInfo {
+	return n.initial
+}
+
+func (n *nativeWatcher) start() error {
+	defer close(n.done)
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return nil
+			}
+			n.handle(event)
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				err = n.rescan()
+				if err == nil {
+					continue
+				}
+			}
+			n.errs <- err
+		}
+	}
+}
+
+func (n *nativeWatcher) events() <-chan fileEvent {
+	return n.ev
+}
+
+func (n *nativeWatcher) errors() <-chan error {
+	return n.errs
+}
+
+func (n *nativeWatcher) closed() <-chan struct{} {
+	return n.done
+}
+
+func (n *nativeWatcher) close() {
+	n.watcher.Close()
+}
+
+func (n *nativeWatcher) handle(event fsnotify.Event) {
+	if isHidden(event.Name) {
+		return
+	}
+
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		n.forget(event.Name)
+		return
+	}
+
+	// The files which have been moved into the tree (or over the existing files) are reported as created
+	if !event.Has(fsnotify.Create) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		// The file has already been removed
+		return
+	}
+
+	if !info.IsDir() {
+		n.report(event.Name, info)
+		return
+	}
+
+	// The files might have been created before the new directory got watched
+	err = n.scan(event.Name, n.report)
+	if err != nil {
+		n.errs <- fmt.Errorf("failed to watch '%s': %w", event.Name, err)
+	}
+}
+
+// rescan walks the whole tree to report the files whose events have been lost
+func (n *nativeWatcher) rescan() error {
+	return n.scan(n.root, n.report)
+}
+
+// scan adds a watch to every directory under the root and calls the callback for every file
+func (n *nativeWatcher) scan(root string, callback func(path string, info os.FileInfo)) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path != root && isHidden(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			callback(path, info)
+			return nil
+		}
+		if _, ok := n.dirs[path]; ok {
+			return nil
+		}
+		if err := n.watcher.Add(path); err != nil {
+			return err
+		}
+		n.dirs[path] = struct{}{}
+		return nil
+	})
+}
+
+// report reports the file unless it's already been reported and has not changed since
+func (n *nativeWatcher) report(path string, info os.FileInfo) {
+	if known, ok := n.known[path]; ok && known.Size() == info.Size() && known.ModTime().Equal(info.ModTime()) {
+		return
+	}
+	n.known[path] = info
+	n.ev <- fileEvent{path: path, info: info}
+}
+
+// forget removes the file (or the directory and its content) from the known files,
+// so that it will be reported again if it gets re-created
+func (n *nativeWatcher) forget(path string) {
+	delete(n.known, path)
+	if _, ok := n.dirs[path]; !ok {
+		return
+	}
+	prefix := path + string(filepath.Separator)
+	for dir := range n.dirs {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			// The watches of the renamed directories would otherwise report the old paths
+			n.watcher.Remove(dir)
+			delete(n.dirs, dir)
+		}
+	}
+	for file := range n.known {
+		if strings.HasPrefix(file, prefix) {
+			delete(n.known, file)
+		}
+	}
+}
+
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
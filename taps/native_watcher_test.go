@@ -0,0 +1,57 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNativeWatcherRenameOver(t *testing.T) {
+	root := t.TempDir()
+	existing := filepath.Join(root, "existing.txt")
+	if err := os.WriteFile(existing, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newNativeWatcher(root)
+	if err != nil {
+		t.Fatalf("failed to create the watcher: %v", err)
+	}
+	go w.start()
+	defer w.close()
+
+	if _, ok := w.files()[existing]; !ok {
+		t.Errorf("expected '%s' to be listed as an initial file", existing)
+	}
+
+	// The editors save the files by renaming a temporary file over the original
+	temp := filepath.Join(root, ".existing.txt.swp")
+	if err := os.WriteFile(temp, []byte("new content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(temp, existing); err != nil {
+		t.Fatal(err)
+	}
+	expectWatcherEvent(t, w, existing, int64(len("new content")))
+
+	created := filepath.Join(root, "created.txt")
+	if err := os.WriteFile(created, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectWatcherEvent(t, w, created, 0)
+}
+
+func expectWatcherEvent(t *testing.T, w *nativeWatcher, path string, size int64) {
+	t.Helper()
+	select {
+	case event := <-w.events():
+		if event.path != path || event.info.Size() != size {
+			t.Errorf("expected an event for '%s' of %d bytes, actual '%s' of %d bytes", path, size, event.path, event.info.Size())
+		}
+	case err := <-w.errors():
+		t.Fatalf("expected an event for '%s', but received '%v'", path, err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected an event for '%s'", path)
+	}
+}
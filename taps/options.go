@@ -0,0 +1,343 @@
+package taps
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+// DefaultPollingInterval is the default frequency of checking the source directory for newly created files
+const DefaultPollingInterval = 100 * time.Millisecond
+
+// DirectoryWatcherOption configures a DirectoryWatcherTap
+type DirectoryWatcherOption func(*directoryWatcherOptions) error
+
+type directoryWatcherOptions struct {
+	interval   time.Duration
+	backend    Backend
+	notifyErr  bool
+	report     bool
+	delete     bool
+	logger     *slog.Logger
+	tracer     obfuscate.Tracer
+	dedup      DedupPolicy
+	readiness  ReadinessPolicy
+	filter     Filter
+	conflict   ConflictPolicy
+	retention  int
+	persist    bool
+	names      bool
+	wipe       *SecureDeletePolicy
+	attributes bool
+}
+
+// WithPollingInterval sets the frequency of checking the source directory for newly created files
+// (Default: DefaultPollingInterval). The interval cannot be less than a millisecond.
+func WithPollingInterval(interval time.Duration) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if interval < time.Millisecond {
+			return invalidConfig("the polling interval cannot be less than a millisecond")
+		}
+		o.interval = interval
+		return nil
+	}
+}
+
+// WithBackend sets the mechanism the tap uses to detect the new files (Default: BackendAuto).
+//
+// The polling interval only applies to the polling backend. The native backend reports the new files
+// as soon as they've been created and does not need to walk the whole directory tree periodically.
+func WithBackend(backend Backend) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if backend < BackendAuto || backend > BackendPolling {
+			return invalidConfig("unknown watcher backend %d", backend)
+		}
+		o.backend = backend
+		return nil
+	}
+}
+
+// WithErrorNotification switches error notification ON/OFF (See DirectoryWatcherTap.Errors).
+//
+// If you enable error notification, you need to make sure that you read off the Errors channel,
+// otherwise the tap will get blocked on the full channel.
+func WithErrorNotification(on bool) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.notifyErr = on
+		return nil
+	}
+}
+
+// WithProgressReport switches progress report ON/OFF (See DirectoryWatcherTap.Progress).
+//
+// If you enable progress report, you need to make sure that you read off the Progress channel,
+// otherwise the tap will get blocked on the full channel.
+func WithProgressReport(on bool) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.report = on
+		return nil
+	}
+}
+
+// WithDeleteCompleted deletes the input files, only if the operation has been finished successfully.
+// The files are only unlinked, so their content might still be recoverable from the disk (See WithSecureDelete).
+func WithDeleteCompleted(on bool) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.delete = on
+		return nil
+	}
+}
+
+// WithSecureDelete securely deletes the input files, only if the operation has been finished successfully
+// (See SecureDeletePolicy). It implies WithDeleteCompleted.
+//
+// The encrypting taps decode every output and compare it with the input before wiping the input.
+// The input will be kept if the verification fails.
+func WithSecureDelete(policy SecureDeletePolicy) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if policy.Passes < 0 {
+			return invalidConfig("the number of overwrite passes cannot be negative")
+		}
+		if policy.Pattern < WipeRandom || policy.Pattern > WipeZero {
+			return invalidConfig("unknown wipe pattern %d", policy.Pattern)
+		}
+		if policy.Passes == 0 {
+			policy.Passes = 1
+		}
+		o.wipe = &policy
+		return nil
+	}
+}
+
+// WithPreserveAttributes preserves the permissions, ownership, access and modification times and the extended
+// attributes of the input files and directories.
+//
+// The encrypting taps save the attributes of every input into an encrypted hidden file next to its output
+// (i.e. ".name.xv.meta"). The decrypting taps restore the saved attributes on the decrypted files and directories.
+// The ownership and the extended attributes which need more privileges than the process has will not be restored.
+// The attributes of the decrypted directories are restored once the last file being decrypted into them has been
+// completed, so the read-only directories still accept the decrypted files until then.
+func WithPreserveAttributes(on bool) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.attributes = on
+		return nil
+	}
+}
+
+// WithLogger sets the structured logger of the tap (See DirectoryWatcherTap.SetLogger).
+func WithLogger(logger *slog.Logger) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithTracer sets the tracer of the tap (See DirectoryWatcherTap.SetTracer).
+func WithTracer(tracer obfuscate.Tracer) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.tracer = tracer
+		return nil
+	}
+}
+
+// WithDeduplication enables the deduplication of the encrypted files (See DirectoryWatcherTap.SetDeduplication).
+func WithDeduplication(policy DedupPolicy) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if policy < DedupOff || policy > DedupVersion {
+			return invalidConfig("unknown deduplication policy %d", policy)
+		}
+		o.dedup = policy
+		return nil
+	}
+}
+
+// WithReadiness sets the policy which decides when a new file has been completely written (See ReadinessPolicy).
+func WithReadiness(policy ReadinessPolicy) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if policy.StabilityWindow < 0 {
+			return invalidConfig("the stability window cannot be negative")
+		}
+		o.readiness = policy
+		return nil
+	}
+}
+
+// WithFilter sets the filter which selects the files of the source directory to be processed (See Filter).
+func WithFilter(filter Filter) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.filter = filter
+		return nil
+	}
+}
+
+// WithConflictPolicy sets what happens to a new output whose target file already exists (Default: ConflictOverwrite).
+// The decision will be included in the progress results (See Result.Conflict).
+func WithConflictPolicy(policy ConflictPolicy) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if policy < ConflictOverwrite || policy > ConflictVersion {
+			return invalidConfig("unknown conflict policy %d", policy)
+		}
+		o.conflict = policy
+		return nil
+	}
+}
+
+// WithVersionRetention sets the maximum number of the previous versions of a target file
+// which will be kept by the ConflictVersion policy. Zero (default) keeps all the versions.
+func WithVersionRetention(n int) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		if n < 0 {
+			return invalidConfig("the version retention cannot be negative")
+		}
+		o.retention = n
+		return nil
+	}
+}
+
+// WithPersistentState records the input files which have been processed in a state file in the target directory
+// (See DefaultStateFile), including their size, modification time and a keyed hash of their content.
+// The files are identified by a keyed hash of their path, so the state file does not leak their names.
+//
+// After a restart, only the new files and the files which have been modified since they were processed
+// will be re-processed. The files whose modification time has changed while their content has not, will be skipped.
+func WithPersistentState(on bool) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.persist = on
+		return nil
+	}
+}
+
+// WithNameEncryption encrypts the name of every output file and directory in the target tree (See obfuscate.NameCipher).
+//
+// The names are encrypted deterministically, so the same name always maps to the same encrypted name.
+// The decrypting taps created with this option restore the original names. The names which are too long
+// to be encrypted (including the room needed for the extension and the temporary files of the outputs)
+// will fail the processing with obfuscate.ErrNameTooLong.
+func WithNameEncryption(on bool) DirectoryWatcherOption {
+	return func(o *directoryWatcherOptions) error {
+		o.names = on
+		return nil
+	}
+}
+
+// DirectoryWatcherConfig is the configuration of a DirectoryWatcherTap which can be loaded from a file
+// (i.e. using encoding/json). The zero values mean the default settings.
+type DirectoryWatcherConfig struct {
+	// PollingInterval the frequency of checking the source directory (See WithPollingInterval)
+	PollingInterval obfuscate.Duration `json:"polling_interval"`
+	// Backend the mechanism of detecting the new files (i.e. "polling"). See WithBackend.
+	Backend Backend `json:"backend"`
+	// NotifyErrors enables error notification (See WithErrorNotification)
+	NotifyErrors bool `json:"notify_errors"`
+	// ReportProgress enables progress report (See WithProgressReport)
+	ReportProgress bool `json:"report_progress"`
+	// DeleteCompleted deletes the successfully processed input files (See WithDeleteCompleted)
+	DeleteCompleted bool `json:"delete_completed"`
+	// Dedup the deduplication policy (i.e. "skip"). See WithDeduplication.
+	Dedup DedupPolicy `json:"dedup"`
+	// StabilityWindow the time during which a new file must not change (See ReadinessPolicy)
+	StabilityWindow obfuscate.Duration `json:"stability_window"`
+	// CloseWrite the new files get ready once they've been closed by the writer (See ReadinessPolicy)
+	CloseWrite bool `json:"close_write"`
+	// LockProbe the new files are not ready while they are locked (See ReadinessPolicy)
+	LockProbe bool `json:"lock_probe"`
+	// TempSuffixes the suffixes of the files which are still being written (See ReadinessPolicy)
+	TempSuffixes []string `json:"temp_suffixes"`
+	// Include the glob patterns of the files to process (See Filter)
+	Include []string `json:"include"`
+	// Exclude the glob patterns of the files to ignore (See Filter)
+	Exclude []string `json:"exclude"`
+	// IncludeRegex the regular expressions of the files to process (See Filter)
+	IncludeRegex []string `json:"include_regex"`
+	// ExcludeRegex the regular expressions of the files to ignore (See Filter)
+	ExcludeRegex []string `json:"exclude_regex"`
+	// MinSize the minimum size of the files in bytes (See Filter)
+	MinSize int64 `json:"min_size"`
+	// MaxSize the maximum size of the files in bytes (See Filter)
+	MaxSize int64 `json:"max_size"`
+	// MinAge the minimum time since the last modification of the files (See Filter)
+	MinAge obfuscate.Duration `json:"min_age"`
+	// MaxAge the maximum time since the last modification of the files (See Filter)
+	MaxAge obfuscate.Duration `json:"max_age"`
+	// IgnoreFile the name of the per directory ignore files (See Filter)
+	IgnoreFile string `json:"ignore_file"`
+	// Conflict the policy of the existing target files (i.e. "version"). See WithConflictPolicy.
+	Conflict ConflictPolicy `json:"conflict"`
+	// VersionRetention the maximum number of the previous versions to keep (See WithVersionRetention)
+	VersionRetention int `json:"version_retention"`
+	// PersistState records the processed input files in the target directory (See WithPersistentState)
+	PersistState bool `json:"persist_state"`
+	// EncryptNames encrypts the names of the output files and directories (See WithNameEncryption)
+	EncryptNames bool `json:"encrypt_names"`
+	// SecureDelete securely deletes the successfully processed input files (See WithSecureDelete)
+	SecureDelete bool `json:"secure_delete"`
+	// WipePasses the number of times the content of the deleted files gets overwritten (See SecureDeletePolicy)
+	WipePasses int `json:"wipe_passes"`
+	// WipePattern the data which the content of the deleted files gets overwritten with (See SecureDeletePolicy)
+	WipePattern WipePattern `json:"wipe_pattern"`
+	// PreserveAttributes preserves the attributes of the input files (See WithPreserveAttributes)
+	PreserveAttributes bool `json:"preserve_attributes"`
+}
+
+// Options returns the tap options of the config
+func (c DirectoryWatcherConfig) Options() []DirectoryWatcherOption {
+	opts := []DirectoryWatcherOption{
+		WithErrorNotification(c.NotifyErrors),
+		WithProgressReport(c.ReportProgress),
+		WithDeleteCompleted(c.DeleteCompleted),
+		WithDeduplication(c.Dedup),
+		WithBackend(c.Backend),
+		WithReadiness(ReadinessPolicy{
+			StabilityWindow: time.Duration(c.StabilityWindow),
+			CloseWrite:      c.CloseWrite,
+			LockProbe:       c.LockProbe,
+			TempSuffixes:    c.TempSuffixes,
+		}),
+		WithFilter(Filter{
+			Include:      c.Include,
+			Exclude:      c.Exclude,
+			IncludeRegex: c.IncludeRegex,
+			ExcludeRegex: c.ExcludeRegex,
+			MinSize:      c.MinSize,
+			MaxSize:      c.MaxSize,
+			MinAge:       time.Duration(c.MinAge),
+			MaxAge:       time.Duration(c.MaxAge),
+			IgnoreFile:   c.IgnoreFile,
+		}),
+		WithConflictPolicy(c.Conflict),
+		WithVersionRetention(c.VersionRetention),
+		WithPersistentState(c.PersistState),
+		WithNameEncryption(c.EncryptNames),
+		WithPreserveAttributes(c.PreserveAttributes),
+	}
+	if c.SecureDelete {
+		opts = append(opts, WithSecureDelete(SecureDeletePolicy{
+			Passes:  c.WipePasses,
+			Pattern: c.WipePattern,
+		}))
+	}
+	if c.PollingInterval != 0 {
+		opts = append(opts, WithPollingInterval(time.Duration(c.PollingInterval)))
+	}
+	return opts
+}
+
+func newDirectoryWatcherOptions(opts []DirectoryWatcherOption) (*directoryWatcherOptions, error) {
+	o := &directoryWatcherOptions{
+		interval: DefaultPollingInterval,
+		logger:   slog.New(slog.DiscardHandler),
+		tracer:   obfuscate.NoopTracer(),
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func invalidConfig(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", obfuscate.ErrInvalidConfig, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,196 @@
+package taps
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStabilityWindow is the default time during which the size and the modification time
+	// of a new file must not change before it's considered completely written
+	DefaultStabilityWindow = time.Second
+	// readinessCheckInterval the maximum interval of checking the pending files
+	readinessCheckInterval = 100 * time.Millisecond
+)
+
+// DefaultTempSuffixes are the default suffixes of the files which are still being written.
+// The writers following the "write to a temporary file then rename" convention use these suffixes.
+var DefaultTempSuffixes = []string{".tmp", ".part", ".partial", ".crdownload"}
+
+// ReadinessPolicy decides when a new file of the source directory has been completely written
+// and is ready to be processed. The zero value is the default policy.
+//
+// A new file is ready once its size and modification time have not changed during the stability window.
+// The files which match the temporary suffixes are ignored until they get renamed.
+type ReadinessPolicy struct {
+	// StabilityWindow the time during which the size and the modification time of the file must not change
+	// (Default: DefaultStabilityWindow). The window must be longer than the pauses of the slowest writer.
+	StabilityWindow time.Duration
+	// CloseWrite the file gets ready as soon as a writer closes it, without waiting for the stability window.
+	// It's only supported on Linux (IN_CLOSE_WRITE). The stability window still applies to the files
+	// which had been closed before the tap detected them.
+	CloseWrite bool
+	// LockProbe the file is not ready while another process holds an advisory lock on it (i.e. flock).
+	// It's only supported on the Unix like systems.
+	LockProbe bool
+	// TempSuffixes the suffixes of the files which are still being written (Default: DefaultTempSuffixes).
+	// Use an empty, non-nil slice to process all the files.
+	TempSuffixes []string
+}
+
+func (p ReadinessPolicy) withDefaults() ReadinessPolicy {
+	if p.StabilityWindow <= 0 {
+		p.StabilityWindow = DefaultStabilityWindow
+	}
+	if p.TempSuffixes == nil {
+		p.TempSuffixes = DefaultTempSuffixes
+	}
+	return p
+}
+
+// isTemporary returns true if the file is still being written under a temporary name
+func (p ReadinessPolicy) isTemporary(name string) bool {
+	for _, suffix := range p.TempSuffixes {
+		if suffix != "" && strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingFile is a new file which is being watched until it's been completely written
+type pendingFile struct {
+	info   os.FileInfo
+	since  time.Time
+	closed bool
+}
+
+// readinessTracker holds the new files back until they are ready to be processed
+type readinessTracker struct {
+	policy   ReadinessPolicy
+	pending  map[string]*pendingFile
+	notifier *closeWriteNotifier
+	incoming chan fileEvent
+	ready    func(path string, info os.FileInfo)
+	// the minimum time since the last modification of the files (See Filter.MinAge)
+	minAge time.Duration
+}
+
+func newReadinessTracker(policy ReadinessPolicy, minAge time.Duration, ready func(path string, info os.FileInfo)) *readinessTracker {
+	t := &readinessTracker{
+		policy:   policy,
+		minAge:   minAge,
+		pending:  make(map[string]*pendingFile),
+		incoming: make(chan fileEvent),
+		ready:    ready,
+	}
+	if policy.CloseWrite {
+		// The stability window will be used if close-write is not supported
+		t.notifier, _ = newCloseWriteNotifier()
+	}
+	return t
+}
+
+// add starts tracking the new file. It returns false if the tracker has been stopped.
+func (t *readinessTracker) add(path string, info os.FileInfo, done <-chan struct{}) bool {
+	select {
+	case t.incoming <- fileEvent{path: path, info: info}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// run tracks the pending files until done gets closed
+func (t *readinessTracker) run(done <-chan struct{}) {
+	interval := t.policy.StabilityWindow / 4
+	if interval > readinessCheckInterval {
+		interval = readinessCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var closed <-chan string
+	if t.notifier != nil {
+		defer t.notifier.close()
+		closed = t.notifier.events
+	}
+
+	for {
+		select {
+		case e := <-t.incoming:
+			t.track(e)
+		case path := <-closed:
+			if p, ok := t.pending[path]; ok {
+				if info, err := os.Stat(path); err == nil {
+					p.info, p.closed = info, true
+				}
+			}
+		case <-ticker.C:
+			t.check(done)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (t *readinessTracker) track(e fileEvent) {
+	if _, ok := t.pending[e.path]; ok {
+		return
+	}
+	if t.notifier != nil {
+		// A failed watch only means that the file needs to wait for the stability window
+		t.notifier.watch(e.path)
+	}
+	t.pending[e.path] = &pendingFile{
+		info:  e.info,
+		since: time.Now(),
+	}
+}
+
+// check hands the files which are ready over to the tap
+func (t *readinessTracker) check(done <-chan struct{}) {
+	for path, p := range t.pending {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// The file has been removed or renamed before it got ready
+			t.forget(path)
+			continue
+		}
+
+		if info.Size() != p.info.Size() || !info.ModTime().Equal(p.info.ModTime()) {
+			// Still being written
+			p.info, p.since, p.closed = info, time.Now(), false
+			continue
+		}
+
+		if !p.closed && time.Now().Sub(p.since) < t.policy.StabilityWindow {
+			continue
+		}
+
+		if t.minAge > 0 && time.Since(info.ModTime()) < t.minAge {
+			continue
+		}
+
+		if t.policy.LockProbe && isLocked(path) {
+			continue
+		}
+
+		t.forget(path)
+		t.ready(path, info)
+	}
+}
+
+func (t *readinessTracker) forget(path string) {
+	delete(t.pending, path)
+	if t.notifier != nil {
+		t.notifier.unwatch(path)
+	}
+}
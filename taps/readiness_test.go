@@ -0,0 +1,178 @@
+package taps
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+func TestReadinessPolicyTempSuffixes(t *testing.T) {
+	testCases := []struct {
+		title    string
+		suffixes []string
+		name     string
+		expected bool
+	}{
+		{
+			title:    "default_tmp",
+			name:     "file.txt.tmp",
+			expected: true,
+		},
+		{
+			title:    "default_crdownload",
+			name:     "file.zip.crdownload",
+			expected: true,
+		},
+		{
+			title:    "default_complete_file",
+			name:     "file.txt",
+			expected: false,
+		},
+		{
+			title:    "custom",
+			suffixes: []string{".downloading"},
+			name:     "file.txt.downloading",
+			expected: true,
+		},
+		{
+			title:    "custom_replaces_the_defaults",
+			suffixes: []string{".downloading"},
+			name:     "file.txt.tmp",
+			expected: false,
+		},
+		{
+			title:    "empty_processes_all_the_files",
+			suffixes: []string{},
+			name:     "file.txt.tmp",
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			policy := ReadinessPolicy{TempSuffixes: tc.suffixes}.withDefaults()
+			if actual := policy.isTemporary(tc.name); actual != tc.expected {
+				t.Errorf("expected '%s' to be temporary %v, actual %v", tc.name, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReadinessStabilityWindow(t *testing.T) {
+	const window = 100 * time.Millisecond
+	dir := t.TempDir()
+	ready := make(chan string, 2)
+	tracker := newReadinessTracker(ReadinessPolicy{StabilityWindow: window}.withDefaults(), 0, func(path string, info os.FileInfo) {
+		ready <- path
+	})
+	done := make(chan struct{})
+	defer close(done)
+	go tracker.run(done)
+
+	growing := filepath.Join(dir, "growing.txt")
+	removed := filepath.Join(dir, "removed.txt")
+	for _, path := range []string{growing, removed} {
+		if err := os.WriteFile(path, []byte("0"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		tracker.add(path, info, done)
+	}
+	os.Remove(removed)
+
+	// The file must be held back while it's being written
+	file, err := os.OpenFile(growing, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, lastWrite := time.Now(), time.Now()
+	for time.Since(start) < 3*window {
+		file.WriteString("1")
+		lastWrite = time.Now()
+		select {
+		case path := <-ready:
+			t.Fatalf("expected '%s' to be held back while being written", path)
+		case <-time.After(window / 5):
+		}
+	}
+	file.Close()
+
+	select {
+	case path := <-ready:
+		if path != growing {
+			t.Errorf("expected '%s' to be ready, actual '%s'", growing, path)
+		}
+		if elapsed := time.Since(lastWrite); elapsed < window {
+			t.Errorf("expected the file to be held back for the stability window, actual %v", elapsed)
+		}
+	case <-time.After(10 * window):
+		t.Fatalf("expected '%s' to get ready", growing)
+	}
+
+	select {
+	case path := <-ready:
+		t.Errorf("expected the removed file to be forgotten, actual '%s'", path)
+	case <-time.After(2 * window):
+	}
+}
+
+func TestCloseWithPendingReadiness(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	testCases := []struct {
+		title string
+		// wait for the file to be dispatched before closing the tap
+		dispatched bool
+	}{
+		{
+			title: "stability_window_pending",
+		},
+		{
+			title:      "work_unit_being_dispatched",
+			dispatched: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			source, target := t.TempDir(), t.TempDir()
+			if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			tap, err := NewDirectoryWatcherTapWithOptions(source, target, master, WithReadiness(ReadinessPolicy{StabilityWindow: 50 * time.Millisecond}))
+			if err != nil {
+				t.Fatalf("failed to create the tap: %v", err)
+			}
+			tap.SwitchProgressReport(tc.dispatched)
+			// Nothing consumes the pipe of the tap
+			tap.Open()
+			if tc.dispatched {
+				select {
+				case <-tap.Progress():
+				case <-time.After(5 * time.Second):
+					t.Fatal("expected the file to be dispatched")
+				}
+			}
+
+			closed := make(chan struct{})
+			go func() {
+				tap.Close()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the tap to be closed while the file was pending")
+			}
+
+			for w := range tap.Pipe() {
+				t.Errorf("expected no work unit to be dispatched after closing the tap, actual '%s'", w.ID)
+			}
+			if entries, _ := os.ReadDir(target); len(entries) != 0 {
+				t.Errorf("expected the temporary output to be removed, actual %d files", len(entries))
+			}
+		})
+	}
+}
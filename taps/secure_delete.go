@@ -0,0 +1,176 @@
+package taps
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/NebulousLabs/fastrand"
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+// wipeBufferSize is the size of the chunks in which the files get overwritten
+const wipeBufferSize = 64 * 1024
+
+// WipePattern is the data which the content of the securely deleted files will be overwritten with
+type WipePattern int8
+
+const (
+	// WipeRandom overwrites the content with cryptographically secure random bytes
+	WipeRandom WipePattern = iota
+	// WipeZero overwrites the content with zeros
+	WipeZero
+)
+
+// String returns the string representation of the pattern
+func (p WipePattern) String() string {
+	switch p {
+	case WipeRandom:
+		return "random"
+	case WipeZero:
+		return "zero"
+	}
+	return "unknown"
+}
+
+// MarshalText returns the text representation of the pattern
+func (p WipePattern) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText parses the text representation of the pattern (i.e. "zero")
+func (p *WipePattern) UnmarshalText(text []byte) error {
+	for pattern := WipeRandom; pattern <= WipeZero; pattern++ {
+		if pattern.String() == string(text) {
+			*p = pattern
+			return nil
+		}
+	}
+	return invalidConfig("unknown wipe pattern '%s'", text)
+}
+
+// SecureDeletePolicy specifies how the input files get securely deleted (See WithSecureDelete).
+//
+// The content of the file is overwritten in place, the file is truncated, renamed to a random name and
+// finally unlinked, so that neither the content nor the name can be recovered from the file's disk blocks.
+//
+// NOTE: Overwriting a file in place does NOT guarantee that the old content has been destroyed on the
+// SSDs and flash storage (due to wear levelling), the copy-on-write and log-structured filesystems
+// (i.e. Btrfs, ZFS, APFS), the journaling filesystems in data journaling mode, the network filesystems,
+// or if the file has been captured by snapshots or backups. Use full disk encryption on these devices.
+type SecureDeletePolicy struct {
+	// Passes the number of times the content gets overwritten (Default: 1)
+	Passes int
+	// Pattern the data which the content gets overwritten with
+	Pattern WipePattern
+}
+
+// wipeFile securely deletes the file based on the policy (See SecureDeletePolicy)
+func wipeFile(path string, policy SecureDeletePolicy) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = overwrite(file, policy)
+	if err == nil {
+		err = file.Truncate(0)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cErr := file.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// The hidden names are ignored by the watchers
+	random := filepath.Join(filepath.Dir(path), "."+hex.EncodeToString(fastrand.Bytes(16)))
+	if err := os.Rename(path, random); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return os.Remove(random)
+}
+
+func overwrite(file *os.File, policy SecureDeletePolicy) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	buffer := make([]byte, wipeBufferSize)
+	for pass := 0; pass < policy.Passes; pass++ {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		for remaining := info.Size(); remaining > 0; {
+			chunk := buffer
+			if remaining < int64(len(chunk)) {
+				chunk = chunk[:remaining]
+			}
+			if policy.Pattern == WipeRandom {
+				fastrand.Read(chunk)
+			}
+			n, err := file.Write(chunk)
+			if err != nil {
+				return err
+			}
+			remaining -= int64(n)
+		}
+		// Every pass must reach the disk, otherwise the writes might get merged in the cache
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyOutput makes sure that the encoded output decodes back into the content of the input
+func verifyOutput(master *obfuscate.MasterKey, input, output string) error {
+	expected, err := hashFile(input)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	decoder, err := obfuscate.NewDecoderWithOptions(master, file, h)
+	if err != nil {
+		return err
+	}
+	status, err := decoder.Decode()
+	if err != nil {
+		return err
+	}
+	if status != obfuscate.Completed {
+		return fmt.Errorf("the decoding has been %s", status)
+	}
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return errors.New("the decoded content does not match the input")
+	}
+	return nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
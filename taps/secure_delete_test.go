@@ -0,0 +1,125 @@
+package taps
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+func TestOverwrite(t *testing.T) {
+	testCases := []struct {
+		title   string
+		policy  SecureDeletePolicy
+		content []byte
+	}{
+		{
+			title:   "zero",
+			policy:  SecureDeletePolicy{Passes: 1, Pattern: WipeZero},
+			content: bytes.Repeat([]byte("content"), 20000),
+		},
+		{
+			title:   "random_multiple_passes",
+			policy:  SecureDeletePolicy{Passes: 3, Pattern: WipeRandom},
+			content: bytes.Repeat([]byte("content"), 20000),
+		},
+		{
+			title:  "empty_file",
+			policy: SecureDeletePolicy{Passes: 1, Pattern: WipeZero},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(path, tc.content, 0600); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.OpenFile(path, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = overwrite(file, tc.policy)
+			file.Close()
+			if err != nil {
+				t.Fatalf("expected no error, but received '%v'", err)
+			}
+
+			actual, _ := os.ReadFile(path)
+			if len(actual) != len(tc.content) {
+				t.Fatalf("expected the size to remain %d, actual %d", len(tc.content), len(actual))
+			}
+			if len(actual) > 0 && bytes.Contains(actual, []byte("content")) {
+				t.Errorf("expected the content to be overwritten")
+			}
+			if tc.policy.Pattern == WipeZero && !bytes.Equal(actual, make([]byte, len(tc.content))) {
+				t.Errorf("expected the content to be overwritten with zeros")
+			}
+		})
+	}
+}
+
+func TestWipeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(path, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The link shares the disk blocks of the wiped file
+	witness := filepath.Join(t.TempDir(), "witness")
+	if err := os.Link(path, witness); err != nil {
+		t.Skipf("hard links are not supported: %v", err)
+	}
+
+	if err := wipeFile(path, SecureDeletePolicy{Passes: 1, Pattern: WipeZero}); err != nil {
+		t.Fatalf("expected no error, but received '%v'", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the file to be removed without leftovers, actual %v", entries)
+	}
+	if content, err := os.ReadFile(witness); err != nil || len(content) != 0 {
+		t.Errorf("expected the content of the file to be truncated, actual '%s' (%v)", content, err)
+	}
+
+	if err := wipeFile(path, SecureDeletePolicy{Passes: 1}); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, but received '%v'", err)
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "file.txt"), filepath.Join(dir, "file.txt.xv")
+	if err := os.WriteFile(input, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var encoded bytes.Buffer
+	encoder, err := obfuscate.NewEncoderWithOptions(master, bytes.NewReader([]byte("content")), &encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encoder.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(output, encoded.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyOutput(master, input, output); err != nil {
+		t.Errorf("expected no error, but received '%v'", err)
+	}
+
+	if err := os.WriteFile(input, []byte("modified"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyOutput(master, input, output); err == nil {
+		t.Errorf("expected the modified input not to match the output")
+	}
+
+	another, _ := obfuscate.KeyFromPassword("another password")
+	if err := verifyOutput(another, input, output); err == nil {
+		t.Errorf("expected the output of another key not to be verified")
+	}
+}
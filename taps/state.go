@@ -0,0 +1,259 @@
+package taps
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	gohash "hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xitonix/xvault/hash"
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+const (
+	// DefaultStateFile is the name of the file in the target directory which holds the processing state of the tap.
+	// The file is hidden, so that the other taps watching the target directory ignore it.
+	DefaultStateFile = ".xvault.state"
+	// stateKeyPurpose is the purpose of the key derived from the master key to calculate the content and the path hashes
+	stateKeyPurpose = "xvault/state"
+)
+
+// fileState is a record of the state file which represents an input file which has been processed.
+// The state file lives in the target directory, so it never holds the names of the files in plain text.
+type fileState struct {
+	// Path the keyed hash of the path to the input file relative to the source directory (See statePathKey)
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Hash the keyed hash of the input's content
+	Hash string `json:"hash,omitempty"`
+	// Removed marks the file as no longer processed
+	Removed bool `json:"removed,omitempty"`
+}
+
+// stateStore is an append-only, file based key/value store which records the input files which
+// have been processed, so that the unchanged files do not get re-processed after a restart.
+//
+// Every record is written to the file as a single line of JSON and gets flushed to the disk.
+// The file will be compacted every time the store gets opened (See obfuscate.RecordLog).
+type stateStore struct {
+	root  string
+	key   []byte
+	log   *obfuscate.RecordLog
+	files map[string]fileState
+	// the content hashes of the in-progress work units by ID
+	units map[string]gohash.Hash
+	mux   sync.Mutex
+}
+
+// openStateStore opens the state file at the specified path or creates a new one if it does not exist.
+// The inputs are recorded relative to the root (the source directory).
+func openStateStore(path, root string, master *obfuscate.MasterKey) (*stateStore, error) {
+	key, err := master.DeriveKey(stateKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	s := &stateStore{
+		root:  root,
+		key:   key,
+		files: make(map[string]fileState),
+		units: make(map[string]gohash.Hash),
+	}
+	s.log, err = obfuscate.OpenRecordLog(path, s.replay, s.snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// unchanged returns true if the input file has already been processed and its size
+// and modification time have not changed since
+func (s *stateStore) unchanged(path string) bool {
+	state, ok := s.lookup(path)
+	if !ok {
+		return false
+	}
+	// The file might have been modified since the watcher has listed it
+	info, err := os.Stat(path)
+	return err == nil && state.Size == info.Size() && state.ModTime.Equal(info.ModTime())
+}
+
+// sameContent returns true if the input file has already been processed and its content has not changed,
+// even if it's been touched since. The modification time of the unchanged file will be updated in the state.
+func (s *stateStore) sameContent(path string, info os.FileInfo) (bool, error) {
+	state, ok := s.lookup(path)
+	if !ok || state.Size != info.Size() || state.Hash == "" {
+		return false, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	h := hash.NewHMAC256(s.key)
+	if _, err := io.Copy(h, file); err != nil {
+		return false, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != state.Hash {
+		return false, nil
+	}
+	state.ModTime = info.ModTime()
+	return true, s.record(state)
+}
+
+// track starts hashing the input of the work unit
+func (s *stateStore) track(w *obfuscate.WorkUnit) error {
+	h := hash.NewHMAC256(s.key)
+	err := w.Task.WrapInput(func(input io.Reader) io.Reader {
+		return io.TeeReader(input, h)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.units[w.ID] = h
+	return nil
+}
+
+// discard stops tracking the work unit which has not been completed
+func (s *stateStore) discard(w *obfuscate.WorkUnit) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.units, w.ID)
+}
+
+// processed records the input of the completed work unit
+func (s *stateStore) processed(w *obfuscate.WorkUnit, path string, size int64, modTime time.Time) error {
+	s.mux.Lock()
+	h, ok := s.units[w.ID]
+	delete(s.units, w.ID)
+	s.mux.Unlock()
+
+	key, err := s.pathKey(path)
+	if err != nil {
+		return err
+	}
+	state := fileState{
+		Path:    key,
+		Size:    size,
+		ModTime: modTime,
+	}
+	if ok {
+		state.Hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return s.record(state)
+}
+
+// remove removes the input file from the state
+func (s *stateStore) remove(path string) error {
+	state, ok := s.lookup(path)
+	if !ok {
+		return nil
+	}
+	state.Removed = true
+	return s.record(state)
+}
+
+// prune removes the input files which do not exist in the source directory anymore
+func (s *stateStore) prune(existing map[string]os.FileInfo) error {
+	keep := make(map[string]struct{}, len(existing))
+	for path := range existing {
+		if key, err := s.pathKey(path); err == nil {
+			keep[key] = struct{}{}
+		}
+	}
+
+	s.mux.Lock()
+	var removed []fileState
+	for key, state := range s.files {
+		if _, ok := keep[key]; !ok {
+			state.Removed = true
+			removed = append(removed, state)
+		}
+	}
+	s.mux.Unlock()
+
+	for _, state := range removed {
+		if err := s.record(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes the underlying state file
+func (s *stateStore) close() error {
+	return s.log.Close()
+}
+
+func (s *stateStore) lookup(path string) (fileState, bool) {
+	key, err := s.pathKey(path)
+	if err != nil {
+		return fileState{}, false
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	state, ok := s.files[key]
+	return state, ok
+}
+
+// pathKey returns the key of the input file in the state (See statePathKey)
+func (s *stateStore) pathKey(path string) (string, error) {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return "", err
+	}
+	return statePathKey(s.key, rel), nil
+}
+
+// statePathKey returns the keyed hash of the relative path, so that the state file does not leak the names of the inputs
+func statePathKey(key []byte, rel string) string {
+	h := hash.NewHMAC256(key)
+	h.Write([]byte(filepath.ToSlash(rel)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// record durably appends the state of the input file to the state file
+func (s *stateStore) record(state fileState) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.log.Append(state); err != nil {
+		return err
+	}
+	s.apply(state)
+	return nil
+}
+
+func (s *stateStore) apply(state fileState) {
+	if state.Removed {
+		delete(s.files, state.Path)
+		return
+	}
+	s.files[state.Path] = state
+}
+
+func (s *stateStore) replay(record []byte) error {
+	var state fileState
+	if err := json.Unmarshal(record, &state); err != nil {
+		return err
+	}
+	s.apply(state)
+	return nil
+}
+
+// snapshot returns the current states which will be kept once the state file has been compacted.
+// It is called while the store is locked (See record).
+func (s *stateStore) snapshot() []interface{} {
+	records := make([]interface{}, 0, len(s.files))
+	for _, state := range s.files {
+		records = append(records, state)
+	}
+	return records
+}
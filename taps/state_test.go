@@ -0,0 +1,133 @@
+package taps
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+func TestStateStoreRecovery(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	key, _ := master.DeriveKey(stateKeyPurpose)
+	root := t.TempDir()
+	path := filepath.Join(t.TempDir(), DefaultStateFile)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var content strings.Builder
+	for _, state := range []fileState{
+		{Path: statePathKey(key, "a.txt"), Size: 1, ModTime: modTime},
+		{Path: statePathKey(key, "b.txt"), Size: 2, ModTime: modTime},
+		{Path: statePathKey(key, "a.txt"), Removed: true},
+		{Path: statePathKey(key, "c.txt"), Size: 3, ModTime: modTime},
+	} {
+		line, _ := json.Marshal(state)
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+	// The last record has been torn by a crash
+	content.WriteString(`{"path":"` + statePathKey(key, "d.txt") + `","si`)
+	if err := os.WriteFile(path, []byte(content.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openStateStore(path, root, master)
+	if err != nil {
+		t.Fatalf("failed to open the state store: %v", err)
+	}
+
+	for name, expected := range map[string]bool{"a.txt": false, "b.txt": true, "c.txt": true, "d.txt": false} {
+		if _, ok := store.lookup(filepath.Join(root, name)); ok != expected {
+			t.Errorf("expected the state of '%s' to exist %v, actual %v", name, expected, ok)
+		}
+	}
+
+	w := &obfuscate.WorkUnit{ID: "1"}
+	if err := store.processed(w, filepath.Join(root, "sub", "e.txt"), 5, modTime); err != nil {
+		t.Fatalf("failed to record the state: %v", err)
+	}
+	if err := store.close(); err != nil {
+		t.Fatalf("failed to close the state store: %v", err)
+	}
+
+	// The removed and the torn records must have been compacted away
+	records := readStateRecords(t, path)
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records in the compacted file, actual %d: %v", len(records), records)
+	}
+	for _, name := range []string{"b.txt", "c.txt", "sub/e.txt"} {
+		if _, ok := records[statePathKey(key, name)]; !ok {
+			t.Errorf("expected '%s' to be recorded, actual %v", name, records)
+		}
+	}
+	// The names of the files must not be leaked by the state file
+	if content, _ := os.ReadFile(path); strings.Contains(string(content), "e.txt") {
+		t.Errorf("expected the state file not to contain the names of the files, actual '%s'", content)
+	}
+	if temps, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp")); len(temps) > 0 {
+		t.Errorf("expected the temporary files to be removed, actual %v", temps)
+	}
+
+	if err := store.record(fileState{Path: statePathKey(key, "f.txt")}); err != os.ErrClosed {
+		t.Errorf("expected '%v' as error, but received '%v'", os.ErrClosed, err)
+	}
+}
+
+func readStateRecords(t *testing.T, path string) map[string]fileState {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records := make(map[string]fileState)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var state fileState
+		if err := json.Unmarshal(scanner.Bytes(), &state); err != nil {
+			t.Fatalf("failed to parse the record '%s': %v", scanner.Text(), err)
+		}
+		records[state.Path] = state
+	}
+	return records
+}
+
+func TestFailedCommitIsNotTracked(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	source, target := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The output cannot replace a non-empty directory
+	blocker := filepath.Join(target, "file.txt"+encodedFileExtension)
+	os.MkdirAll(filepath.Join(blocker, "dir"), 0700)
+
+	tap, err := NewDirectoryWatcherTapWithOptions(source, target, master,
+		WithPersistentState(true),
+		WithDeduplication(DedupSkip),
+		WithReadiness(ReadinessPolicy{StabilityWindow: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("failed to create the tap: %v", err)
+	}
+	results := processTree(t, tap, 1)
+	if results[0].Status != obfuscate.Failed {
+		t.Fatalf("expected the commit to fail, actual '%s'", results[0].Status)
+	}
+
+	tap.state.mux.Lock()
+	defer tap.state.mux.Unlock()
+	if len(tap.state.units) != 0 {
+		t.Errorf("expected no work unit to be tracked by the state store, actual %d", len(tap.state.units))
+	}
+	tap.dedup.mux.Lock()
+	defer tap.dedup.mux.Unlock()
+	if len(tap.dedup.units) != 0 {
+		t.Errorf("expected no work unit to be tracked by the deduplicator, actual %d", len(tap.dedup.units))
+	}
+}
@@ -0,0 +1,26 @@
+package taps
+
+import "syscall"
+
+// The magic numbers of the network filesystems which do not support inotify
+const (
+	nfsMagic  = 0x6969
+	smbMagic  = 0x517b
+	cifsMagic = 0xff534d42
+	smb2Magic = 0xfe534d42
+	fuseMagic = 0x65735546
+)
+
+// isNetworkFilesystem returns true if the path is on a network filesystem.
+// The changes made by the other machines on a network filesystem do not trigger any inotify events.
+func isNetworkFilesystem(path string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false
+	}
+	switch uint32(stat.Type) {
+	case nfsMagic, smbMagic, cifsMagic, smb2Magic, fuseMagic:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package taps
+
+// isNetworkFilesystem returns true if the path is on a network filesystem
+func isNetworkFilesystem(path string) bool {
+	return false
+}
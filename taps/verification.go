@@ -0,0 +1,204 @@
+package taps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+// FileHealth represents the verification result of an encoded file
+type FileHealth struct {
+	File
+	// Health the integrity of the file
+	Health obfuscate.Health
+	// Error the reason of the failure (if any)
+	Error error
+}
+
+// VerificationReport represents the outcome of verifying the encoded files of a directory tree
+type VerificationReport struct {
+	// Files the health of every encoded file in the directory tree
+	Files []FileHealth
+	// Healthy the number of the healthy files
+	Healthy int
+	// Unhealthy the number of the files which failed the verification
+	Unhealthy int
+	// Bytes the total number of the verified bytes
+	Bytes int64
+}
+
+// VerifyDirectory checks that every encoded file under the root directory can be decrypted
+// using the master key, without writing the plaintext anywhere (See obfuscate.Verify).
+//
+// The files will be verified by the engine, so that the engine's workers, limits and interceptors
+// apply to the verification too. The engine must be running, otherwise the call will block until
+// it's been started or the context is done. The verification is not recorded in the engine's journal.
+func VerifyDirectory(ctx context.Context, engine *obfuscate.Engine, root string, master *obfuscate.MasterKey) (*VerificationReport, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	err = filepath.Walk(abs, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), encodedFileExtension) {
+			files = append(files, File{Name: info.Name(), Path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	job := engine.NewJob(false)
+	units := make([]*obfuscate.WorkUnit, len(files))
+	for i, file := range files {
+		t := obfuscate.NewTask(obfuscate.Verify, &lazyFile{path: file.Path}, nil)
+		w := obfuscate.NewWorkUnit(t, master, func(w *obfuscate.WorkUnit) {
+			w.Task.CloseInput()
+		})
+		if info, err := os.Stat(file.Path); err == nil {
+			w.Size = info.Size()
+		}
+		w.Metadata[inputMetadataKey] = file.Name
+		w.Metadata[inputFullMetadataKey] = file.Path
+		job.Add(w, nil)
+		units[i] = w
+	}
+	job.Seal()
+
+	tap := newListTap(units)
+	name := "verify:" + abs
+	if err := engine.Attach(name, tap); err != nil {
+		return nil, err
+	}
+	defer engine.Detach(name)
+
+	// The unhealthy files are reported individually
+	if err := job.Wait(ctx); err != nil && ctx.Err() != nil {
+		for _, w := range units {
+			engine.Cancel(w.ID)
+		}
+		return nil, err
+	}
+
+	report := &VerificationReport{
+		Files: make([]FileHealth, len(files)),
+		Bytes: job.Stats().Bytes,
+	}
+	for i, w := range units {
+		health := obfuscate.CheckHealth(w.Task.Status(), w.Error)
+		if health == obfuscate.Healthy {
+			report.Healthy++
+		} else {
+			report.Unhealthy++
+		}
+		report.Files[i] = FileHealth{
+			File:   files[i],
+			Health: health,
+			Error:  w.Error,
+		}
+	}
+	return report, nil
+}
+
+// listTap is a tap which pushes a predefined list of work units into the engine
+type listTap struct {
+	units  []*obfuscate.WorkUnit
+	pipe   obfuscate.WorkList
+	done   chan obfuscate.None
+	wg     sync.WaitGroup
+	isOpen bool
+
+	openOnce  sync.Once
+	closeOnce sync.Once
+	mux       sync.Mutex
+}
+
+func newListTap(units []*obfuscate.WorkUnit) *listTap {
+	return &listTap{
+		units: units,
+		pipe:  make(obfuscate.WorkList),
+		done:  make(chan obfuscate.None),
+	}
+}
+
+func (l *listTap) Open() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.openOnce.Do(func() {
+		l.isOpen = true
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			for _, w := range l.units {
+				select {
+				case l.pipe <- w:
+				case <-l.done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+func (l *listTap) Close() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+		close(l.pipe)
+		l.isOpen = false
+	})
+}
+
+func (l *listTap) IsOpen() bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.isOpen
+}
+
+func (l *listTap) Pipe() obfuscate.WorkList {
+	return l.pipe
+}
+
+// Transient returns true, since the listed work units cannot be rebuilt after a restart
+func (l *listTap) Transient() bool {
+	return true
+}
+
+// lazyFile is a file which will only be opened once it's been read for the first time,
+// so that a large number of queued work units do not hold the file handles.
+type lazyFile struct {
+	path string
+	file *os.File
+}
+
+func (l *lazyFile) Read(b []byte) (int, error) {
+	if l.file == nil {
+		file, err := os.Open(l.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open '%s': %w", l.path, err)
+		}
+		l.file = file
+	}
+	return l.file.Read(b)
+}
+
+func (l *lazyFile) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
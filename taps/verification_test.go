@@ -0,0 +1,62 @@
+package taps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xitonix/xvault/obfuscate"
+)
+
+func TestVerifyDirectoryWithJournal(t *testing.T) {
+	master, _ := obfuscate.KeyFromPassword("password")
+	root := t.TempDir()
+	for _, name := range []string{"first", "second"} {
+		output, err := os.Create(filepath.Join(root, name+encodedFileExtension))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoder, err := obfuscate.NewEncoderWithOptions(master, strings.NewReader(name), output)
+		if err != nil {
+			t.Fatalf("failed to create the encoder: %v", err)
+		}
+		if _, err := encoder.Encode(); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+		output.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "journal")
+	journal, err := obfuscate.OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("failed to open the journal: %v", err)
+	}
+	defer journal.Close()
+	engine, err := obfuscate.NewEngineWithOptions(nil, obfuscate.WithJournal(journal))
+	if err != nil {
+		t.Fatalf("failed to create the engine: %v", err)
+	}
+	engine.Start()
+	defer engine.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	report, err := VerifyDirectory(ctx, engine, root, master)
+	if err != nil {
+		t.Fatalf("failed to verify the directory: %v", err)
+	}
+	if report.Healthy != 2 || report.Unhealthy != 0 {
+		t.Errorf("expected 2 healthy files, actual %d healthy and %d unhealthy", report.Healthy, report.Unhealthy)
+	}
+
+	// The verification must not be replayed once the engine restarts
+	if pending, _ := journal.Pending(); len(pending) != 0 {
+		t.Errorf("expected no pending entry in the journal, actual %+v", pending)
+	}
+	if content, _ := os.ReadFile(path); len(content) != 0 {
+		t.Errorf("expected the verification not to be recorded in the journal, actual '%s'", content)
+	}
+}
@@ -0,0 +1,117 @@
+// Package tracing provides an OpenTelemetry implementation of the obfuscate.Tracer interface
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xitonix/xvault/obfuscate"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the OpenTelemetry tracer
+const instrumentationName = "github.com/xitonix/xvault"
+
+// Tracer is an OpenTelemetry tracer for the work units.
+//
+// The trace context of every work unit is also stored in its Metadata using the W3C trace context format,
+// so that the work units which have been recovered from the engine's journal continue their original traces.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewTracer creates a new tracer using the specified provider.
+// The global provider will be used if the provider is nil.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// Start starts a new span for the work unit as a child of the trace carried by the unit.
+func (t *Tracer) Start(ctx context.Context, name string, w *obfuscate.WorkUnit) (context.Context, obfuscate.Span) {
+	parent := trace.SpanContextFromContext(w.Context())
+	if !parent.IsValid() {
+		parent = trace.SpanContextFromContext(t.propagator.Extract(context.Background(), metadataCarrier(w.Metadata)))
+	}
+	if parent.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, parent)
+	}
+
+	ctx, span := t.tracer.Start(ctx, name)
+	if !parent.IsValid() {
+		// The first span of the work unit is the root of its trace
+		w.SetContext(trace.ContextWithSpanContext(w.Context(), span.SpanContext()))
+		t.propagator.Inject(w.Context(), metadataCarrier(w.Metadata))
+	}
+	return ctx, &otelSpan{span: span}
+}
+
+// Propagate sets the upstream trace context of the work unit.
+// The spans of the work unit will be the children of the current span of the context.
+func (t *Tracer) Propagate(ctx context.Context, w *obfuscate.WorkUnit) {
+	w.SetContext(ctx)
+	t.propagator.Inject(ctx, metadataCarrier(w.Metadata))
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SetAttribute(key string, value interface{}) {
+	var attr attribute.KeyValue
+	switch v := value.(type) {
+	case string:
+		attr = attribute.String(key, v)
+	case int:
+		attr = attribute.Int(key, v)
+	case int64:
+		attr = attribute.Int64(key, v)
+	case bool:
+		attr = attribute.Bool(key, v)
+	case float64:
+		attr = attribute.Float64(key, v)
+	default:
+		attr = attribute.String(key, fmt.Sprint(v))
+	}
+	s.span.SetAttributes(attr)
+}
+
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// metadataCarrier stores the trace context in the metadata of a work unit
+type metadataCarrier obfuscate.MetadataMap
+
+func (m metadataCarrier) Get(key string) string {
+	value, _ := m[key].(string)
+	return value
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key, value := range m {
+		if _, ok := value.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,230 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/xitonix/xvault/obfuscate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+func newTestTracer() (*Tracer, *spanRecorder) {
+	recorder := &spanRecorder{}
+	return NewTracer(recorder), recorder
+}
+
+// spanRecorder is a minimal trace provider which records the ended spans,
+// so that the tests do not depend on the OpenTelemetry SDK
+type spanRecorder struct {
+	embedded.TracerProvider
+	spans []*recordedSpan
+	mux   sync.Mutex
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{recorder: r}
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+	recorder *spanRecorder
+}
+
+func (r recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent := trace.SpanContextFromContext(ctx)
+	config := trace.SpanContextConfig{
+		TraceID:    parent.TraceID(),
+		TraceFlags: trace.FlagsSampled,
+	}
+	if !parent.IsValid() {
+		rand.Read(config.TraceID[:])
+	}
+	rand.Read(config.SpanID[:])
+	span := &recordedSpan{
+		recorder:    r.recorder,
+		name:        name,
+		parent:      parent,
+		spanContext: trace.NewSpanContext(config),
+	}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// Ended returns the spans which have been ended in order
+func (r *spanRecorder) Ended() []*recordedSpan {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]*recordedSpan{}, r.spans...)
+}
+
+type recordedSpan struct {
+	embedded.Span
+	recorder    *spanRecorder
+	name        string
+	parent      trace.SpanContext
+	spanContext trace.SpanContext
+	attributes  []attribute.KeyValue
+	status      codes.Code
+	description string
+	errors      []error
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.recorder.mux.Lock()
+	defer s.recorder.mux.Unlock()
+	s.recorder.spans = append(s.recorder.spans, s)
+}
+
+func (s *recordedSpan) AddEvent(string, ...trace.EventOption) {}
+
+func (s *recordedSpan) AddLink(trace.Link) {}
+
+func (s *recordedSpan) IsRecording() bool {
+	return true
+}
+
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.errors = append(s.errors, err)
+}
+
+func (s *recordedSpan) SpanContext() trace.SpanContext {
+	return s.spanContext
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, description string) {
+	s.status, s.description = code, description
+}
+
+func (s *recordedSpan) SetName(name string) {
+	s.name = name
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attributes = append(s.attributes, kv...)
+}
+
+func (s *recordedSpan) TracerProvider() trace.TracerProvider {
+	return s.recorder
+}
+
+func TestSpansOfTheWorkUnit(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	w := obfuscate.NewWorkUnit(nil, nil, nil)
+
+	_, root := tracer.Start(context.Background(), obfuscate.SpanDispatch, w)
+	root.End(nil)
+	if _, ok := w.Metadata["traceparent"].(string); !ok {
+		t.Errorf("expected the trace context to be stored in the metadata, actual %v", w.Metadata)
+	}
+	_, child := tracer.Start(context.Background(), obfuscate.SpanProcess, w)
+	child.End(nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, actual %d", len(spans))
+	}
+	if spans[0].parent.IsValid() {
+		t.Errorf("expected the first span to be the root of the trace, actual parent %v", spans[0].parent)
+	}
+	if spans[1].SpanContext().TraceID() != spans[0].SpanContext().TraceID() {
+		t.Errorf("expected the spans to belong to the same trace")
+	}
+	if spans[1].parent.SpanID() != spans[0].SpanContext().SpanID() {
+		t.Errorf("expected '%s' to be the parent, actual '%s'", spans[0].SpanContext().SpanID(), spans[1].parent.SpanID())
+	}
+}
+
+func TestRecoveredWorkUnit(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	w := obfuscate.NewWorkUnit(nil, nil, nil)
+	_, span := tracer.Start(context.Background(), obfuscate.SpanDispatch, w)
+	span.End(nil)
+
+	// The recovered work unit only carries the metadata of the journal entry
+	recovered := obfuscate.NewWorkUnit(nil, nil, nil)
+	for key, value := range w.Metadata {
+		recovered.Metadata[key] = value
+	}
+	_, span = tracer.Start(context.Background(), obfuscate.SpanProcess, recovered)
+	span.End(nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, actual %d", len(spans))
+	}
+	if spans[1].SpanContext().TraceID() != spans[0].SpanContext().TraceID() {
+		t.Errorf("expected the recovered work unit to continue the original trace")
+	}
+	if !spans[1].parent.IsRemote() {
+		t.Errorf("expected the parent of the recovered span to be extracted from the metadata")
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	upstream, parent := tracer.tracer.Start(context.Background(), "upstream")
+	w := obfuscate.NewWorkUnit(nil, nil, nil)
+	tracer.Propagate(upstream, w)
+
+	_, span := tracer.Start(context.Background(), obfuscate.SpanDispatch, w)
+	span.End(nil)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, actual %d", len(spans))
+	}
+	if spans[0].parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected the span to be the child of the upstream span")
+	}
+	if _, ok := w.Metadata["traceparent"].(string); !ok {
+		t.Errorf("expected the upstream trace context to be stored in the metadata, actual %v", w.Metadata)
+	}
+}
+
+func TestSpanAttributesAndErrors(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	w := obfuscate.NewWorkUnit(nil, nil, nil)
+
+	_, span := tracer.Start(context.Background(), obfuscate.SpanProcess, w)
+	span.SetAttribute("string", "value")
+	span.SetAttribute("int", 1)
+	span.SetAttribute("int64", int64(2))
+	span.SetAttribute("bool", true)
+	span.SetAttribute("float", 1.5)
+	span.SetAttribute("other", obfuscate.Completed)
+	span.End(errors.New("failed"))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, actual %d", len(spans))
+	}
+	expected := map[attribute.Key]attribute.Value{
+		"string": attribute.StringValue("value"),
+		"int":    attribute.IntValue(1),
+		"int64":  attribute.Int64Value(2),
+		"bool":   attribute.BoolValue(true),
+		"float":  attribute.Float64Value(1.5),
+		"other":  attribute.StringValue(obfuscate.Completed.String()),
+	}
+	actual := make(map[attribute.Key]attribute.Value)
+	for _, attr := range spans[0].attributes {
+		actual[attr.Key] = attr.Value
+	}
+	for key, value := range expected {
+		if actual[key] != value {
+			t.Errorf("expected '%v' as the value of '%s', actual '%v'", value.Emit(), key, actual[key].Emit())
+		}
+	}
+	if spans[0].status != codes.Error || spans[0].description != "failed" {
+		t.Errorf("expected the error status, actual '%v' (%s)", spans[0].status, spans[0].description)
+	}
+	if len(spans[0].errors) != 1 {
+		t.Errorf("expected the error to be recorded, actual %v", spans[0].errors)
+	}
+}